@@ -1,12 +1,17 @@
 package main
 
 import (
+	"log"
 	"os"
 
 	"github.com/codepnw/go-ecommerce/config"
 	"github.com/codepnw/go-ecommerce/internal/server"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
 	"github.com/codepnw/go-ecommerce/pkg/database"
-	_ "github.com/joho/godotenv/autoload"
+	"github.com/codepnw/go-ecommerce/pkg/logger"
+	"github.com/codepnw/go-ecommerce/pkg/mailer"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
 )
 
 func envPath() string {
@@ -20,9 +25,66 @@ func envPath() string {
 func main() {
 	cfg := config.LoadConfig(envPath())
 
+	if err := logger.Init(cfg.Log()); err != nil {
+		log.Fatalf("init logger failed: %v", err)
+	}
+
 	db := database.DBConnect(cfg)
 	db.Health()
-	defer db.Close()
 
-	server.NewServer(db, cfg).Start()
+	if cfg.Db().AutoMigrate() {
+		migrator, err := database.NewMigrator(db)
+		if err != nil {
+			db.Close()
+			log.Fatalf("init migrator failed: %v", err)
+		}
+		if err := migrator.Up(0); err != nil {
+			db.Close()
+			log.Fatalf("migrate database failed: %v", err)
+		}
+	}
+
+	if err := auth.Init(cfg.Jwt()); err != nil {
+		db.Close()
+		log.Fatalf("init jwt keys failed: %v", err)
+	}
+
+	store, err := storage.NewStorage(cfg.Storage())
+	if err != nil {
+		db.Close()
+		log.Fatalf("init storage failed: %v", err)
+	}
+
+	mail, err := mailer.NewMailer(cfg.Mail())
+	if err != nil {
+		db.Close()
+		log.Fatalf("init mailer failed: %v", err)
+	}
+
+	limiter, err := ratelimit.NewStore(cfg.RateLimit())
+	if err != nil {
+		db.Close()
+		log.Fatalf("init rate limit store failed: %v", err)
+	}
+
+	watcher, err := config.NewWatcher(cfg, envPath())
+	if err != nil {
+		db.Close()
+		log.Fatalf("init config watcher failed: %v", err)
+	}
+	watcher.OnReload(func(cfg config.Config) {
+		if err := logger.SetLevel(cfg.Log().Level()); err != nil {
+			log.Printf("set log level failed: %v", err)
+		}
+	})
+	watcher.Start()
+
+	// Database is closed by server when it stops
+	err = server.NewServer(db, store, limiter, mail, watcher, cfg).Start()
+	watcher.Stop()
+	auth.Stop()
+	if err != nil {
+		log.Fatalf("server stopped: %v", err)
+	}
+	log.Println("server stopped")
 }
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/pkg/database"
+)
+
+const usage = `usage: migrate [-env .env] <command>
+
+commands:
+  up [N]      apply all or N pending migrations
+  down N      revert N applied migrations
+  down --all  revert all applied migrations
+  status      show current version and migrations
+  force V     set version V without running migrations, clears dirty state
+
+upgrade notes:
+  000004      stock of existing products is PGOPTIONS='-c stock.initial_qty=N', default 0,
+              products without stock can not be ordered until restocked
+`
+
+func main() {
+	envPath := flag.String("env", ".env", "path of env file")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	args := flag.Args()
+	if len(args) == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	cfg := config.LoadConfig(*envPath)
+	db := database.DBConnect(cfg)
+	defer db.Close()
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		log.Fatalf("init migrator failed: %v", err)
+	}
+
+	if err := run(migrator, args[0], args[1:]); err != nil {
+		db.Close()
+		log.Fatalf("%s failed: %v", args[0], err)
+	}
+}
+
+func run(migrator database.IMigrator, cmd string, args []string) error {
+	switch cmd {
+	case "up":
+		steps, err := number(args, 0)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Up(steps); err != nil {
+			return err
+		}
+	case "down":
+		// Reverting drops data, so all is never the default
+		steps := 0
+		if len(args) == 0 || args[0] != "--all" {
+			n, err := number(args, 0)
+			if err != nil {
+				return err
+			}
+			if n < 1 {
+				return fmt.Errorf("number of migrations or --all is required")
+			}
+			steps = n
+		}
+		if err := migrator.Down(steps); err != nil {
+			return err
+		}
+	case "force":
+		if len(args) == 0 {
+			return fmt.Errorf("version is required")
+		}
+		version, err := number(args, 0)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Force(version); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	return printStatus(migrator)
+}
+
+func number(args []string, fallback int) (int, error) {
+	if len(args) == 0 {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%q is not a valid number", args[0])
+	}
+	return n, nil
+}
+
+func printStatus(migrator database.IMigrator) error {
+	status, err := migrator.Status()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("version: %d", status.Version)
+	if status.Dirty {
+		fmt.Print(" (dirty)")
+	}
+	fmt.Println()
+
+	for _, m := range status.Migrations {
+		state := "pending"
+		if m.Applied {
+			state = "applied"
+		}
+		fmt.Printf("  %06d  %-8s %s\n", m.Version, state, m.Name)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/apikeys"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysRepositories"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysUsecases"
+	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
+	"github.com/codepnw/go-ecommerce/internal/products/productRepositories"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/users"
+	"github.com/codepnw/go-ecommerce/internal/users/usersRepositories"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+	"github.com/codepnw/go-ecommerce/pkg/database"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
+)
+
+const seedApiKeyName = "seed"
+
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// Seed is safe to run many times, existing rows are kept
+func main() {
+	envPath := flag.String("env", ".env", "path of env file")
+	email := flag.String("admin-email", envOr("SEED_ADMIN_EMAIL", "admin@mail.com"), "email of first admin")
+	username := flag.String("admin-username", envOr("SEED_ADMIN_USERNAME", "admin"), "username of first admin")
+	password := flag.String("admin-password", os.Getenv("SEED_ADMIN_PASSWORD"), "password of first admin, default from SEED_ADMIN_PASSWORD")
+	samples := flag.Bool("samples", true, "insert sample categories and products")
+	mfaEnroll := flag.String("mfa-enroll", "", "only issue mfa enroll token of admin with this email, when no enrolled admin can issue it")
+	flag.Parse()
+
+	cfg := config.LoadConfig(*envPath)
+	db := database.DBConnect(cfg)
+	defer db.Close()
+
+	if *mfaEnroll != "" {
+		if err := seedMfaEnroll(cfg, db.Get(), *mfaEnroll); err != nil {
+			db.Close()
+			log.Fatalf("issue mfa enroll token failed: %v", err)
+		}
+		return
+	}
+
+	if err := seed(cfg, db, *email, *username, *password, *samples); err != nil {
+		db.Close()
+		log.Fatalf("seed failed: %v", err)
+	}
+}
+
+func seed(cfg config.Config, db database.Service, email, username, password string, samples bool) error {
+	if err := seedRoles(db.Get()); err != nil {
+		return err
+	}
+
+	adminId, err := seedAdmin(db.Get(), email, username, password)
+	if err != nil {
+		return err
+	}
+
+	// First admin has no other admin to issue its enroll token
+	if cfg.Mfa().RequireAdmin() {
+		if err := seedMfaEnroll(cfg, db.Get(), email); err != nil {
+			return err
+		}
+	}
+
+	if samples {
+		store, err := storage.NewStorage(cfg.Storage())
+		if err != nil {
+			return fmt.Errorf("init storage failed: %v", err)
+		}
+
+		categories, err := seedCategories(db.Get())
+		if err != nil {
+			return err
+		}
+
+		filesUsecase := filesUsecases.FilesUsecase(cfg, store)
+		productRepo := productRepositories.ProductRepository(db.Get(), cfg, filesUsecase)
+		if err := seedProducts(db.Get(), filesUsecase, productRepo, categories); err != nil {
+			return err
+		}
+	}
+
+	return seedApiKey(cfg, db.Get(), adminId)
+}
+
+func seedRoles(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Role ids are used in code, 1 customer and 2 admin
+	query := `
+		INSERT INTO "roles" (
+			"id",
+			"title"
+		)
+		VALUES
+			(1, 'customer'),
+			(2, 'admin')
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("insert roles failed: %v", err)
+	}
+
+	query = `SELECT setval(pg_get_serial_sequence('roles', 'id'), (SELECT MAX("id") FROM "roles"));`
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("update roles sequence failed: %v", err)
+	}
+
+	// Admin has all permissions, new permissions are granted on every seed
+	query = `
+		INSERT INTO "roles_permissions" (
+			"role_id",
+			"permission_code"
+		)
+		SELECT $1::INT, "code" FROM "permissions"
+		UNION ALL
+		SELECT $2::INT, "code" FROM "permissions" WHERE "code" = $3
+		ON CONFLICT DO NOTHING;
+	`
+	if _, err := db.ExecContext(ctx, query, roles.AdminRoleId, roles.CustomerRoleId, roles.PermOrdersCancel); err != nil {
+		return fmt.Errorf("insert role permissions failed: %v", err)
+	}
+
+	fmt.Println("roles: ok")
+	return nil
+}
+
+// seedAdmin returns id of admin, existing admin is kept
+func seedAdmin(db *sql.DB, email, username, password string) (string, error) {
+	repo := usersRepositories.UsersRepository(db)
+
+	if user, err := repo.FindOneUserByEmail(email); err == nil {
+		fmt.Printf("admin: %s exists, skipped\n", email)
+		return user.Id, nil
+	}
+
+	if password == "" {
+		return "", fmt.Errorf("admin password is required, use -admin-password or SEED_ADMIN_PASSWORD")
+	}
+
+	req := &users.UserRegisterReq{
+		Email:    email,
+		Password: password,
+		Username: username,
+	}
+	if !req.IsEmail() {
+		return "", fmt.Errorf("email pattern is invalid")
+	}
+	if err := req.BcryptHashing(); err != nil {
+		return "", err
+	}
+
+	admin, err := repo.InsertUser(req, true)
+	if err != nil {
+		return "", fmt.Errorf("insert admin failed: %v", err)
+	}
+
+	fmt.Printf("admin: %s created (%s)\n", email, admin.User.Id)
+	return admin.User.Id, nil
+}
+
+// seedMfaEnroll issues enroll token of admin who has not enrolled mfa, token is printed only here.
+// It is the recovery path when MFA_REQUIRE_ADMIN is on and no enrolled admin can issue tokens
+func seedMfaEnroll(cfg config.Config, db *sql.DB, email string) error {
+	if !cfg.Mfa().RequireAdmin() {
+		return fmt.Errorf("mfa is not required for admins, MFA_REQUIRE_ADMIN is off")
+	}
+
+	repo := usersRepositories.UsersRepository(db)
+	user, err := repo.FindOneUserByEmail(email)
+	if err != nil {
+		return fmt.Errorf("user %s not found", email)
+	}
+	if user.RoleId != roles.AdminRoleId {
+		return fmt.Errorf("user %s is not admin", email)
+	}
+	if user.Status != users.ActiveStatus {
+		return fmt.Errorf("user %s is %s", email, user.Status)
+	}
+
+	mfa, err := repo.FindMfa(user.Id)
+	if err != nil && err.Error() != "mfa not found" {
+		return err
+	}
+	if mfa != nil && mfa.Enabled {
+		fmt.Printf("mfa: %s enrolled, skipped\n", email)
+		return nil
+	}
+
+	token, err := users.NewVerificationToken()
+	if err != nil {
+		return err
+	}
+	expires := cfg.Mfa().EnrollExpires()
+	if err := repo.InsertVerification(&users.Verification{
+		UserId:    user.Id,
+		Purpose:   users.MfaEnrollPurpose,
+		Email:     user.Email,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(expires),
+	}); err != nil {
+		return err
+	}
+
+	fmt.Printf("mfa: enroll token of %s, use it in POST /v1/users/mfa/enroll within %s, it is not shown again\n%s\n", email, expires, token)
+	return nil
+}
+
+// seedApiKey creates key of all scopes owned by admin, key is printed only when created
+func seedApiKey(cfg config.Config, db *sql.DB, adminId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		SELECT EXISTS (
+			SELECT 1
+			FROM "api_keys"
+			WHERE "name" = $1
+			AND "revoked_at" IS NULL
+		);
+	`
+	var exists bool
+	if err := db.QueryRowContext(ctx, query, seedApiKeyName).Scan(&exists); err != nil {
+		return fmt.Errorf("find api key failed: %v", err)
+	}
+	if exists {
+		fmt.Printf("api key: %s exists, skipped\n", seedApiKeyName)
+		return nil
+	}
+
+	req := &apikeys.ApiKey{
+		Name:    seedApiKeyName,
+		OwnerId: adminId,
+		Scopes:  apikeys.Scopes,
+	}
+	if err := apikeysUsecases.ApiKeysUsecase(apikeysRepositories.ApiKeysRepository(db), auth.NewTokenCache(cfg.Jwt())).InsertApiKey(req); err != nil {
+		return err
+	}
+
+	fmt.Printf("api key: %s created, it is not shown again\n%s\n", seedApiKeyName, req.Key)
+	return nil
+}
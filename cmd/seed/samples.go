@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"fmt"
+	"image"
+	"image/color"
+	"mime/multipart"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/appinfo"
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/files"
+	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
+	"github.com/codepnw/go-ecommerce/internal/products"
+	"github.com/codepnw/go-ecommerce/internal/products/productRepositories"
+	"github.com/codepnw/go-ecommerce/pkg/imaging"
+	"github.com/codepnw/go-ecommerce/pkg/utils"
+)
+
+type sampleProduct struct {
+	title       string
+	description string
+	category    string
+	price       float64
+	stock       int
+}
+
+// Placeholder image color of each category
+var sampleCategories = map[string]color.RGBA{
+	"food & beverage": {R: 214, G: 137, B: 16, A: 255},
+	"fashion":         {R: 176, G: 58, B: 46, A: 255},
+	"gadget":          {R: 40, G: 116, B: 166, A: 255},
+}
+
+var sampleProducts = []*sampleProduct{
+	{title: "Green Tea", description: "Sample food & beverage product", category: "food & beverage", price: 90, stock: 100},
+	{title: "Croissant", description: "Sample food & beverage product", category: "food & beverage", price: 65, stock: 50},
+	{title: "Hoodie", description: "Sample fashion product", category: "fashion", price: 890, stock: 30},
+	{title: "Sneakers", description: "Sample fashion product", category: "fashion", price: 2590, stock: 20},
+	{title: "Headphones", description: "Sample gadget product", category: "gadget", price: 3490, stock: 15},
+	{title: "Smartwatch", description: "Sample gadget product", category: "gadget", price: 7990, stock: 10},
+}
+
+func seedCategories(db *sql.DB) (map[string]int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	categories := make(map[string]int)
+	for title := range sampleCategories {
+		query := `
+			INSERT INTO "categories" (
+				"title"
+			)
+			VALUES ($1)
+			ON CONFLICT ("title") DO UPDATE SET "title" = EXCLUDED."title"
+			RETURNING "id";
+		`
+
+		var id int
+		if err := db.QueryRowContext(ctx, query, title).Scan(&id); err != nil {
+			return nil, fmt.Errorf("insert category failed: %v", err)
+		}
+		categories[title] = id
+	}
+
+	fmt.Println("categories: ok")
+	return categories, nil
+}
+
+func seedProducts(db *sql.DB, filesUsecase filesUsecases.IFilesUsecase, repo productRepositories.IProductRepository, categories map[string]int) error {
+	for _, p := range sampleProducts {
+		var exists bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM "products" WHERE "title" = $1);`, p.title).Scan(&exists); err != nil {
+			return fmt.Errorf("find product failed: %v", err)
+		}
+		if exists {
+			fmt.Printf("product: %s exists, skipped\n", p.title)
+			continue
+		}
+
+		images, err := uploadSampleImage(filesUsecase, sampleCategories[p.category])
+		if err != nil {
+			return err
+		}
+
+		product, err := repo.InsertProduct(&products.Product{
+			Title:       p.title,
+			Description: p.description,
+			Price:       p.price,
+			Stock:       p.stock,
+			Category:    &appinfo.Category{Id: categories[p.category]},
+			Images:      images,
+		})
+		if err != nil {
+			return fmt.Errorf("insert product %s failed: %v", p.title, err)
+		}
+		fmt.Printf("product: %s created (%s)\n", p.title, product.Id)
+	}
+	return nil
+}
+
+// uploadSampleImage stores a generated placeholder the same way as uploaded images
+func uploadSampleImage(filesUsecase filesUsecases.IFilesUsecase, c color.RGBA) ([]*entities.Image, error) {
+	img := image.NewRGBA(image.Rect(0, 0, 800, 800))
+	for y := 0; y < 800; y++ {
+		// Darker to the bottom
+		shade := 255 - y*80/800
+		row := color.RGBA{
+			R: uint8(int(c.R) * shade / 255),
+			G: uint8(int(c.G) * shade / 255),
+			B: uint8(int(c.B) * shade / 255),
+			A: 255,
+		}
+		for x := 0; x < 800; x++ {
+			img.SetRGBA(x, y, row)
+		}
+	}
+
+	buf := new(bytes.Buffer)
+	if err := imaging.Encode(buf, img, imaging.FormatPng, 0); err != nil {
+		return nil, fmt.Errorf("encode sample image failed: %v", err)
+	}
+
+	filename := utils.RandFileName(imaging.Extension(imaging.FormatPng))
+	header, err := fileHeader(filename, buf.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := filesUsecase.UploadToStorage([]*files.FileReq{
+		{
+			File:         header,
+			Destination:  "images/products/" + filename,
+			FileName:     filename,
+			Extension:    imaging.Extension(imaging.FormatPng),
+			WithVariants: true,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	images := make([]*entities.Image, 0, len(res))
+	for _, r := range res {
+		images = append(images, &entities.Image{
+			FileName: r.FileName,
+			Url:      r.Url,
+			Variants: r.Variants,
+		})
+	}
+	return images, nil
+}
+
+// fileHeader wraps data as an uploaded multipart file
+func fileHeader(filename string, data []byte) (*multipart.FileHeader, error) {
+	body := new(bytes.Buffer)
+	w := multipart.NewWriter(body)
+
+	part, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := part.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	form, err := multipart.NewReader(body, w.Boundary()).ReadForm(int64(len(data)) + 1024)
+	if err != nil {
+		return nil, fmt.Errorf("read sample image failed: %v", err)
+	}
+	return form.File["file"][0], nil
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"fmt"
+	"sync"
 	"time"
 )
 
@@ -13,31 +14,94 @@ type AppConfig interface {
 	Version() string
 	ReadTimeout() time.Duration
 	WriteTimeout() time.Duration
+	ShutdownTimeout() time.Duration
 	BodyLimit() int
 	FileLimit() int
+	TaxRate() float64
+	ShippingFee() float64
 }
 
 type app struct {
-	host         string
-	port         int
-	name         string
-	version      string
-	readTimeout  time.Duration
-	writeTimeout time.Duration
-	bodyLimit    int // byte
-	fileLimit    int // byte
+	mu              sync.RWMutex // guards reloadable fields
+	host            string
+	port            int
+	name            string
+	version         string
+	readTimeout     time.Duration
+	writeTimeout    time.Duration
+	shutdownTimeout time.Duration
+	bodyLimit       int     // byte
+	fileLimit       int     // byte
+	taxRate         float64 // percent
+	shippingFee     float64
 }
 
 func (c *config) App() AppConfig {
 	return c.app
 }
 
-func (a *app) Host() string                { return a.host }
-func (a *app) Port() int                   { return a.port }
-func (a *app) Url() string                 { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
-func (a *app) Name() string                { return a.name }
-func (a *app) Version() string             { return a.version }
-func (a *app) ReadTimeout() time.Duration  { return a.readTimeout }
-func (a *app) WriteTimeout() time.Duration { return a.writeTimeout }
-func (a *app) BodyLimit() int              { return a.bodyLimit }
-func (a *app) FileLimit() int              { return a.fileLimit }
+func (a *app) Host() string                   { return a.host }
+func (a *app) Port() int                      { return a.port }
+func (a *app) Url() string                    { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
+func (a *app) Name() string                   { return a.name }
+func (a *app) Version() string                { return a.version }
+func (a *app) ReadTimeout() time.Duration     { return a.readTimeout }
+func (a *app) WriteTimeout() time.Duration    { return a.writeTimeout }
+func (a *app) ShutdownTimeout() time.Duration { return a.shutdownTimeout }
+func (a *app) BodyLimit() int                 { return a.bodyLimit }
+func (a *app) FileLimit() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.fileLimit
+}
+func (a *app) TaxRate() float64     { return a.taxRate }
+func (a *app) ShippingFee() float64 { return a.shippingFee }
+
+func (a *app) effective() map[string]any {
+	return map[string]any{
+		"host":             a.host,
+		"port":             a.port,
+		"name":             a.name,
+		"version":          a.version,
+		"read_timeout":     a.readTimeout.String(),
+		"write_timeout":    a.writeTimeout.String(),
+		"shutdown_timeout": a.shutdownTimeout.String(),
+		"body_limit":       a.bodyLimit,
+		"file_limit":       a.FileLimit(),
+		"tax_rate":         a.taxRate,
+		"shipping_fee":     a.shippingFee,
+	}
+}
+
+func (a *app) reload(next *app) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.fileLimit = next.fileLimit
+}
+
+func (a *app) validate(r *reader) {
+	if a.port < 1 || a.port > 65535 {
+		r.fail("APP_PORT", "%d is not a valid port", a.port)
+	}
+	for key, timeout := range map[string]time.Duration{
+		"APP_READ_TIMEOUT":     a.readTimeout,
+		"APP_WRITE_TIMEOUT":    a.writeTimeout,
+		"APP_SHUTDOWN_TIMEOUT": a.shutdownTimeout,
+	} {
+		if timeout <= 0 {
+			r.fail(key, "must be positive")
+		}
+	}
+	if a.bodyLimit < 1 {
+		r.fail("APP_BODY_LIMIT", "must be positive")
+	}
+	if a.fileLimit < 1 || a.fileLimit > a.bodyLimit {
+		r.fail("APP_FILE_LIMIT", "must be positive and not exceed APP_BODY_LIMIT")
+	}
+	if a.taxRate < 0 || a.taxRate > 100 {
+		r.fail("APP_TAX_RATE", "must be 0-100")
+	}
+	if a.shippingFee < 0 {
+		r.fail("APP_SHIPPING_FEE", "must not be negative")
+	}
+}
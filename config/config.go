@@ -1,115 +1,220 @@
 package config
 
 import (
+	"errors"
+	"fmt"
 	"log"
-	"math"
-	"strconv"
 	"time"
-
-	"github.com/joho/godotenv"
-	_ "github.com/joho/godotenv/autoload"
 )
 
 type Config interface {
 	App() AppConfig
 	Db() DbConfig
 	Jwt() JwtConfig
+	Storage() StorageConfig
+	Image() ImageConfig
+	Log() LogConfig
+	Cors() CorsConfig
+	RateLimit() RateLimitConfig
+	Mail() MailConfig
+	Mfa() MfaConfig
+	Effective() map[string]map[string]any
 }
 
 type config struct {
-	app *app
-	db  *db
-	jwt *jwt
+	app       *app
+	db        *db
+	jwt       *jwt
+	storage   *storage
+	image     *image
+	log       *logging
+	cors      *cors
+	rateLimit *rateLimit
+	mail      *mailConfig
+	mfa       *mfa
+}
+
+// Effective returns values in use by section, secrets are masked
+func (c *config) Effective() map[string]map[string]any {
+	return map[string]map[string]any{
+		"app":        c.app.effective(),
+		"db":         c.db.effective(),
+		"jwt":        c.jwt.effective(),
+		"storage":    c.storage.effective(),
+		"image":      c.image.effective(),
+		"log":        c.log.effective(),
+		"cors":       c.cors.effective(),
+		"rate_limit": c.rateLimit.effective(),
+		"mail":       c.mail.effective(),
+		"mfa":        c.mfa.effective(),
+	}
 }
 
+// LoadConfig is Load, it exits when config is invalid
 func LoadConfig(path string) Config {
-	env, err := godotenv.Read(path)
+	cfg, err := Load(path)
+	if err != nil {
+		log.Fatalf("load config failed:\n%v", err)
+	}
+	return cfg
+}
+
+// Load merges defaults, then yaml, json or dotenv file by extension, then environment variables.
+// Keys are env names, nested file keys are joined e.g. app.port is APP_PORT.
+// Every invalid field is returned in one error.
+func Load(path string) (Config, error) {
+	r, err := newReader(path)
 	if err != nil {
-		log.Fatalf("load dotenv failed: %v", err)
-	} 
+		return nil, err
+	}
 
-	return &config{
+	cfg := &config{
 		app: &app{
-			host: env["APP_HOST"],
-			port: func() int {
-				result, err := strconv.Atoi(env["APP_PORT"])
-				if err != nil {
-					log.Fatalf("load APP_PORT failed: %v", err)
-				}
-				return result
-			}(),
-			name:    env["APP_NAME"],
-			version: env["APP_VERSION"],
-			readTimeout: func() time.Duration {
-				res, err := strconv.Atoi(env["APP_READ_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load APP_READ_TIMEOUT failed: %v", err)
-				}
-				return time.Duration(int64(res) * int64(math.Pow10(9)))
-			}(),
-			writeTimeout: func() time.Duration {
-				res, err := strconv.Atoi(env["APP_WRITE_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load APP_WRITE_TIMEOUT failed: %v", err)
-				}
-				return time.Duration(int64(res) * int64(math.Pow10(9)))
-			}(),
-			bodyLimit: func() int {
-				result, err := strconv.Atoi(env["APP_BODY_LIMIT"])
-				if err != nil {
-					log.Fatalf("load APP_BODY_LIMIT failed: %v", err)
-				}
-				return result
-			}(),
-			fileLimit: func() int {
-				result, err := strconv.Atoi(env["APP_FILE_LIMIT"])
-				if err != nil {
-					log.Fatalf("load APP_FILE_LIMIT failed: %v", err)
-				}
-				return result
-			}(),
+			host:            r.string("APP_HOST", "localhost"),
+			port:            r.int("APP_PORT", 3000),
+			name:            r.string("APP_NAME", "go-ecommerce"),
+			version:         r.string("APP_VERSION", "v1.0.0"),
+			readTimeout:     r.duration("APP_READ_TIMEOUT", 60*time.Second),
+			writeTimeout:    r.duration("APP_WRITE_TIMEOUT", 60*time.Second),
+			shutdownTimeout: r.duration("APP_SHUTDOWN_TIMEOUT", 10*time.Second),
+			bodyLimit:       r.int("APP_BODY_LIMIT", 10*1024*1024),
+			fileLimit:       r.int("APP_FILE_LIMIT", 2*1024*1024),
+			taxRate:         r.float("APP_TAX_RATE", 0),
+			shippingFee:     r.float("APP_SHIPPING_FEE", 0),
 		},
 		db: &db{
-			driver: env["DB_DRIVER"],
-			host:   env["DB_HOST"],
-			port: func() int {
-				result, err := strconv.Atoi(env["DB_PORT"])
-				if err != nil {
-					log.Fatalf("load DB_PORT failed: %v", err)
-				}
-				return result
-			}(),
-			protocal: env["DB_PROTOCAL"],
-			username: env["DB_USERNAME"],
-			password: env["DB_PASSWORD"],
-			database: env["DB_DATABASE"],
-			sslMode:  env["DB_SSL_MODE"],
-			maxConnections: func() int {
-				result, err := strconv.Atoi(env["DB_MAX_CONNECTIONS"])
-				if err != nil {
-					log.Fatalf("load DB_MAX_CONNECTIONS failed: %v", err)
-				}
-				return result
-			}(),
+			driver:         r.string("DB_DRIVER", "postgres"),
+			host:           r.string("DB_HOST", "localhost"),
+			port:           r.int("DB_PORT", 5432),
+			username:       r.required("DB_USERNAME"),
+			password:       r.string("DB_PASSWORD", ""),
+			database:       r.required("DB_DATABASE"),
+			sslMode:        r.string("DB_SSL_MODE", "disable"),
+			maxConnections: r.int("DB_MAX_CONNECTIONS", 25),
+			autoMigrate:    r.bool("DB_AUTO_MIGRATE", false),
 		},
 		jwt: &jwt{
-			adminKey:  env["JWT_ADMIN_KEY"],
-			secertKey: env["JWT_SECRET_KEY"],
-			apiKey:    env["JWT_API_KEY"],
-			accessExpiresAt: func() int {
-				result, err := strconv.Atoi(env["JWT_ACCESS_EXPIRES"])
-				if err != nil {
-					log.Fatalf("load JWT_ACCESS_EXPIRES failed: %v", err)
-				}
-				return result
-			}(),
-			refreshExpiresAt: func() int {
-				result, err := strconv.Atoi(env["JWT_REFRESH_EXPIRES"])
-				if err != nil {
-					log.Fatalf("load JWT_REFRESH_EXPIRES failed: %v", err)
-				}
-				return result
-			}(),
+			adminKey:         r.required("JWT_ADMIN_KEY"),
+			secertKey:        r.required("JWT_SECRET_KEY"),
+			accessExpiresAt:  int(r.duration("JWT_ACCESS_EXPIRES", 24*time.Hour).Seconds()),
+			refreshExpiresAt: int(r.duration("JWT_REFRESH_EXPIRES", 7*24*time.Hour).Seconds()),
+			sessionMaxAge:    r.duration("JWT_SESSION_MAX_AGE", 30*24*time.Hour),
+			cacheSize:        r.int("JWT_CACHE_SIZE", 10000),
+			cacheTTL:         r.duration("JWT_CACHE_TTL", time.Minute),
+			algorithm:        r.string("JWT_ALGORITHM", "HS256"),
+			keysDir:          r.string("JWT_KEYS_DIR", "keys"),
+			keyRotation:      r.duration("JWT_KEY_ROTATION", 30*24*time.Hour),
+		},
+		image: &image{
+			variants:  r.variants("IMAGE_VARIANTS", "thumbnail:200,medium:800"),
+			quality:   r.int("IMAGE_QUALITY", 85),
+			webp:      r.bool("IMAGE_WEBP", true),
+			maxPixels: r.int("IMAGE_MAX_PIXELS", 40000000),
+		},
+		log: &logging{
+			level:      r.string("LOG_LEVEL", "info"),
+			dir:        r.string("LOG_DIR", "./logs"),
+			maxSize:    r.int("LOG_MAX_SIZE", 100*1024*1024),
+			maxAge:     r.int("LOG_MAX_AGE", 7),
+			bufferSize: r.int("LOG_BUFFER_SIZE", 1024),
+			stdout:     r.bool("LOG_STDOUT", true),
+			redact:     append(append([]string{}, DefaultRedactFields...), r.list("LOG_REDACT_FIELDS", nil)...),
+			routes:     append(append([]string{}, DefaultRedactRoutes...), r.list("LOG_REDACT_ROUTES", nil)...),
 		},
 	}
+
+	cfg.cors = loadCors(r)
+	cfg.rateLimit = &rateLimit{
+		enabled:   r.bool("RATE_LIMIT_ENABLED", true),
+		store:     r.string("RATE_LIMIT_STORE", "memory"),
+		ip:        r.rate("RATE_LIMIT_IP", RateLimit{Requests: 20, Period: time.Minute}),
+		apiKey:    r.rate("RATE_LIMIT_API_KEY", RateLimit{Requests: 600, Period: time.Minute}),
+		email:     r.rate("RATE_LIMIT_EMAIL", RateLimit{Requests: 5, Period: time.Minute}),
+		threshold: r.int("RATE_LIMIT_LOCKOUT_THRESHOLD", 5),
+		window:    r.duration("RATE_LIMIT_LOCKOUT_WINDOW", 15*time.Minute),
+		base:      r.duration("RATE_LIMIT_LOCKOUT_BASE", time.Minute),
+		max:       r.duration("RATE_LIMIT_LOCKOUT_MAX", time.Hour),
+	}
+
+	// Old keys verify refresh tokens signed by them
+	cfg.jwt.keyGrace = r.duration("JWT_KEY_GRACE", time.Duration(cfg.jwt.refreshExpiresAt)*time.Second)
+
+	// Storage defaults depend on app
+	cfg.storage = &storage{
+		driver:    r.string("STORAGE_DRIVER", "local"),
+		localPath: r.string("STORAGE_LOCAL_PATH", "./assets"),
+		baseUrl:   r.string("STORAGE_BASE_URL", fmt.Sprintf("http://%s:%d", cfg.app.host, cfg.app.port)),
+		signKey:   r.required("STORAGE_SIGN_KEY"),
+		endpoint:  r.string("STORAGE_S3_ENDPOINT", ""),
+		region:    r.string("STORAGE_S3_REGION", "us-east-1"),
+		bucket:    r.string("STORAGE_S3_BUCKET", ""),
+		accessKey: r.string("STORAGE_S3_ACCESS_KEY", ""),
+		secretKey: r.string("STORAGE_S3_SECRET_KEY", ""),
+		public:    r.list("STORAGE_PUBLIC_DESTINATIONS", []string{"images"}),
+		private:   r.list("STORAGE_PRIVATE_DESTINATIONS", []string{"slips"}),
+		maxAge:    r.int("STORAGE_CACHE_MAX_AGE", 86400),
+	}
+
+	cfg.mail = &mailConfig{
+		driver:        r.string("MAIL_DRIVER", "log"),
+		from:          r.string("MAIL_FROM", "no-reply@localhost"),
+		dir:           r.string("MAIL_DIR", "./mails"),
+		smtpHost:      r.string("MAIL_SMTP_HOST", ""),
+		smtpPort:      r.int("MAIL_SMTP_PORT", 587),
+		smtpUsername:  r.string("MAIL_SMTP_USERNAME", ""),
+		smtpPassword:  r.string("MAIL_SMTP_PASSWORD", ""),
+		linkBaseUrl:   r.string("MAIL_LINK_BASE_URL", fmt.Sprintf("http://%s:%d", cfg.app.host, cfg.app.port)),
+		verifyExpires: r.duration("MAIL_VERIFY_EXPIRES", 24*time.Hour),
+		resetExpires:  r.duration("MAIL_RESET_EXPIRES", time.Hour),
+	}
+
+	// Mfa secrets are encrypted by this key, deployments upgraded from shared key set it to
+	// former JWT_SECRET_KEY and change JWT_SECRET_KEY, enrolled secrets stay readable
+	cfg.mfa = &mfa{
+		issuer:           r.string("MFA_ISSUER", cfg.app.name),
+		secretKey:        r.required("MFA_SECRET_KEY"),
+		requireAdmin:     r.bool("MFA_REQUIRE_ADMIN", false),
+		challengeExpires: r.duration("MFA_CHALLENGE_EXPIRES", 5*time.Minute),
+		enrollExpires:    r.duration("MFA_ENROLL_EXPIRES", 24*time.Hour),
+		recoveryCodes:    r.int("MFA_RECOVERY_CODES", 10),
+	}
+
+	cfg.app.validate(r)
+	cfg.db.validate(r)
+	cfg.jwt.validate(r)
+	cfg.storage.validate(r)
+	cfg.image.validate(r)
+	cfg.log.validate(r)
+	cfg.cors.validate(r)
+	cfg.rateLimit.validate(r)
+	cfg.mail.validate(r)
+	cfg.mfa.validate(r)
+	validateDistinctKeys(r, []keyValue{
+		{"JWT_SECRET_KEY", cfg.jwt.secertKey},
+		{"JWT_ADMIN_KEY", cfg.jwt.adminKey},
+		{"STORAGE_SIGN_KEY", cfg.storage.signKey},
+		{"MFA_SECRET_KEY", cfg.mfa.secretKey},
+	})
+
+	if err := errors.Join(r.errs...); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type keyValue struct {
+	name  string
+	value string
+}
+
+// validateDistinctKeys refuses one secret of many purposes, one token type would pass as
+// another and rotating it would break all of them
+func validateDistinctKeys(r *reader, keys []keyValue) {
+	for i, key := range keys {
+		for _, other := range keys[:i] {
+			if key.value != "" && key.value == other.value {
+				r.fail(key.name, "must differ from %s", other.name)
+			}
+		}
+	}
 }
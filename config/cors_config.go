@@ -0,0 +1,176 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+type CorsConfig interface {
+	Name() string
+	Paths() []string
+	AllowOrigins() []string
+	AllowMethods() []string
+	AllowHeaders() []string
+	ExposeHeaders() []string
+	AllowCredentials() bool
+	MaxAge() int
+	Groups() []CorsConfig
+}
+
+// Route groups with their own policy, CORS_<NAME>_* overrides default values
+var corsGroups = []struct {
+	name  string
+	paths string
+}{
+	{"admin", "/v1/users/admin,/v1/users/signup-admin,/v1/config,/v1/files,/v1/roles,/v1/apikeys,/v1/users/*/sessions,=/v1/users,/v1/users/*/suspend,/v1/users/*/mfa/enroll-token,/v1/products/*/stocks,/v1/appinfo/warehouses,!/v1/users/me"},
+	{"appinfo", "/v1/appinfo"},
+}
+
+type cors struct {
+	mu          sync.RWMutex // guards origins
+	name        string
+	paths       []string // route prefixes, =path is exact, !path excludes, * is one segment
+	origins     []string // e.g. https://shop.com, https://*.shop.com
+	methods     []string
+	headers     []string
+	expose      []string
+	credentials bool
+	maxAge      int // sec, preflight cache
+	groups      []*cors
+}
+
+func (c *config) Cors() CorsConfig {
+	return c.cors
+}
+
+func (c *cors) Name() string    { return c.name }
+func (c *cors) Paths() []string { return c.paths }
+
+func (c *cors) AllowOrigins() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.origins
+}
+
+func (c *cors) AllowMethods() []string  { return c.methods }
+func (c *cors) AllowHeaders() []string  { return c.headers }
+func (c *cors) ExposeHeaders() []string { return c.expose }
+func (c *cors) AllowCredentials() bool  { return c.credentials }
+func (c *cors) MaxAge() int             { return c.maxAge }
+
+func (c *cors) Groups() []CorsConfig {
+	groups := make([]CorsConfig, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, g)
+	}
+	return groups
+}
+
+func loadCors(r *reader) *cors {
+	def := &cors{
+		name:        "default",
+		origins:     r.list("CORS_ALLOW_ORIGINS", []string{"*"}),
+		methods:     r.list("CORS_ALLOW_METHODS", []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH"}),
+		headers:     r.list("CORS_ALLOW_HEADERS", []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Api-Key", "X-Request-Id"}),
+		expose:      r.list("CORS_EXPOSE_HEADERS", []string{"X-Request-Id"}),
+		credentials: r.bool("CORS_ALLOW_CREDENTIALS", false),
+		maxAge:      r.int("CORS_MAX_AGE", 600),
+	}
+
+	for _, g := range corsGroups {
+		prefix := "CORS_" + strings.ToUpper(g.name) + "_"
+		def.groups = append(def.groups, &cors{
+			name:        g.name,
+			paths:       r.list(prefix+"PATHS", strings.Split(g.paths, ",")),
+			origins:     r.list(prefix+"ALLOW_ORIGINS", def.origins),
+			methods:     r.list(prefix+"ALLOW_METHODS", def.methods),
+			headers:     r.list(prefix+"ALLOW_HEADERS", def.headers),
+			expose:      r.list(prefix+"EXPOSE_HEADERS", def.expose),
+			credentials: r.bool(prefix+"ALLOW_CREDENTIALS", def.credentials),
+			maxAge:      r.int(prefix+"MAX_AGE", def.maxAge),
+		})
+	}
+	return def
+}
+
+// keyPrefix of env and effective keys, empty for default policy
+func (c *cors) keyPrefix() string {
+	if c.name == "default" {
+		return ""
+	}
+	return c.name + "_"
+}
+
+func (c *cors) effective() map[string]any {
+	values := make(map[string]any)
+	for _, p := range append([]*cors{c}, c.groups...) {
+		prefix := p.keyPrefix()
+		if p != c {
+			values[prefix+"paths"] = p.paths
+		}
+		values[prefix+"allow_origins"] = p.AllowOrigins()
+		values[prefix+"allow_methods"] = p.methods
+		values[prefix+"allow_headers"] = p.headers
+		values[prefix+"expose_headers"] = p.expose
+		values[prefix+"allow_credentials"] = p.credentials
+		values[prefix+"max_age"] = p.maxAge
+	}
+	return values
+}
+
+func (c *cors) reload(next *cors) {
+	c.mu.Lock()
+	c.origins = next.origins
+	c.mu.Unlock()
+
+	for i := range c.groups {
+		c.groups[i].reload(next.groups[i])
+	}
+}
+
+func (c *cors) validate(r *reader) {
+	key := "CORS_" + strings.ToUpper(c.keyPrefix())
+	switch {
+	case len(c.origins) == 0:
+		r.fail(key+"ALLOW_ORIGINS", "is required")
+	case len(c.origins) == 1 && c.origins[0] == "*":
+		if c.credentials {
+			r.fail(key+"ALLOW_ORIGINS", "* is not allowed with credentials")
+		}
+	default:
+		for _, origin := range c.origins {
+			if origin == "*" {
+				r.fail(key+"ALLOW_ORIGINS", "* must be the only origin")
+				continue
+			}
+			if err := validOrigin(origin); err != nil {
+				r.fail(key+"ALLOW_ORIGINS", "%q %v", origin, err)
+			}
+		}
+	}
+	if c.maxAge < 0 {
+		r.fail(key+"MAX_AGE", "must not be negative")
+	}
+
+	for _, g := range c.groups {
+		for _, p := range g.paths {
+			if !strings.HasPrefix(strings.TrimLeft(p, "=!"), "/") {
+				r.fail("CORS_"+strings.ToUpper(g.name)+"_PATHS", "%q must start with /", p)
+			}
+		}
+		g.validate(r)
+	}
+}
+
+// validOrigin accepts http(s)://host[:port], host may start with *. for any
+// subdomain. Rules are of fiber cors, it panics on other origins
+func validOrigin(origin string) error {
+	u, err := url.Parse(strings.Replace(origin, "://*.", "://", 1))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || strings.Contains(u.Host, "*") ||
+		(u.Path != "" && u.Path != "/") || u.RawQuery != "" || u.ForceQuery || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("must be http(s)://host[:port]")
+	}
+	return nil
+}
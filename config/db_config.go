@@ -5,22 +5,25 @@ import (
 	"strconv"
 )
 
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
 type DbConfig interface {
 	Url() string
 	MaxOpenConns() int
 	Driver() string
+	AutoMigrate() bool
 }
 
 type db struct {
 	driver         string
 	host           string
 	port           int
-	protocal       string
 	username       string
 	password       string
 	database       string
 	sslMode        string
 	maxConnections int
+	autoMigrate    bool // run pending migrations on start
 }
 
 func (c *config) Db() DbConfig {
@@ -42,3 +45,30 @@ func (d *db) Url() string {
 
 func (d *db) MaxOpenConns() int { return d.maxConnections }
 func (d *db) Driver() string    { return d.driver }
+func (d *db) AutoMigrate() bool { return d.autoMigrate }
+
+func (d *db) effective() map[string]any {
+	return map[string]any{
+		"driver":          d.driver,
+		"host":            d.host,
+		"port":            d.port,
+		"username":        d.username,
+		"password":        mask(d.password),
+		"database":        d.database,
+		"ssl_mode":        d.sslMode,
+		"max_connections": d.maxConnections,
+		"auto_migrate":    d.autoMigrate,
+	}
+}
+
+func (d *db) validate(r *reader) {
+	if d.port < 1 || d.port > 65535 {
+		r.fail("DB_PORT", "%d is not a valid port", d.port)
+	}
+	if !contains(sslModes, d.sslMode) {
+		r.fail("DB_SSL_MODE", "%q must be one of %v", d.sslMode, sslModes)
+	}
+	if d.maxConnections < 1 {
+		r.fail("DB_MAX_CONNECTIONS", "must be positive")
+	}
+}
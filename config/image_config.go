@@ -0,0 +1,54 @@
+package config
+
+import "fmt"
+
+type ImageConfig interface {
+	Variants() []ImageVariant
+	Quality() int
+	Webp() bool
+	MaxPixels() int
+}
+
+// ImageVariant is a resized copy of uploaded images, width 0 keeps original size
+type ImageVariant struct {
+	Name  string
+	Width int
+}
+
+type image struct {
+	variants  []ImageVariant
+	quality   int // 1-100, jpeg quality and webp compression effort
+	webp      bool
+	maxPixels int // width * height
+}
+
+func (c *config) Image() ImageConfig {
+	return c.image
+}
+
+func (i *image) Variants() []ImageVariant { return i.variants }
+func (i *image) Quality() int             { return i.quality }
+func (i *image) Webp() bool               { return i.webp }
+func (i *image) MaxPixels() int           { return i.maxPixels }
+
+func (i *image) effective() map[string]any {
+	variants := make([]string, 0, len(i.variants))
+	for _, v := range i.variants {
+		variants = append(variants, fmt.Sprintf("%s:%d", v.Name, v.Width))
+	}
+	return map[string]any{
+		"variants":   variants,
+		"quality":    i.quality,
+		"webp":       i.webp,
+		"max_pixels": i.maxPixels,
+	}
+}
+
+func (i *image) validate(r *reader) {
+	if i.quality < 1 || i.quality > 100 {
+		r.fail("IMAGE_QUALITY", "must be 1-100")
+	}
+	if i.maxPixels < 1 {
+		r.fail("IMAGE_MAX_PIXELS", "must be positive")
+	}
+}
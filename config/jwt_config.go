@@ -1,30 +1,164 @@
 package config
 
+import (
+	"sync"
+	"time"
+)
+
+// HS256 keys shorter than the hash size are rejected
+const jwtMinKeyLength = 32
+
+// Access and refresh tokens are signed by one of algorithms,
+// admin token is always HS256
+var jwtAlgorithms = []string{"HS256", "RS256", "EdDSA"}
+
 type JwtConfig interface {
 	SecretKey() []byte
 	AdminKey() []byte
-	ApiKey() []byte
 	AccessExpiresAt() int
 	RefreshExpiresAt() int
+	SessionMaxAge() time.Duration
+	CacheSize() int
+	CacheTTL() time.Duration
+	Algorithm() string
+	KeysDir() string
+	KeyRotation() time.Duration
+	KeyGrace() time.Duration
 	SetJwtAccessExpires(t int)
 	SetJwtRefreshExpires(t int)
 }
 
 type jwt struct {
+	mu               sync.RWMutex // guards expires
 	secertKey        string
 	adminKey         string
-	apiKey           string
 	accessExpiresAt  int //sec
 	refreshExpiresAt int //sec
+	sessionMaxAge    time.Duration
+	cacheSize        int
+	cacheTTL         time.Duration
+	algorithm        string
+	keysDir          string
+	keyRotation      time.Duration
+	keyGrace         time.Duration
 }
 
 func (c *config) Jwt() JwtConfig {
 	return c.jwt
 }
-func (j *jwt) SecretKey() []byte          { return []byte(j.secertKey) }
-func (j *jwt) AdminKey() []byte           { return []byte(j.adminKey) }
-func (j *jwt) ApiKey() []byte             { return []byte(j.apiKey) }
-func (j *jwt) AccessExpiresAt() int       { return j.accessExpiresAt }
-func (j *jwt) RefreshExpiresAt() int      { return j.refreshExpiresAt }
-func (j *jwt) SetJwtAccessExpires(t int)  { j.accessExpiresAt = t }
-func (j *jwt) SetJwtRefreshExpires(t int) { j.refreshExpiresAt = t }
+func (j *jwt) SecretKey() []byte { return []byte(j.secertKey) }
+func (j *jwt) AdminKey() []byte  { return []byte(j.adminKey) }
+
+func (j *jwt) AccessExpiresAt() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.accessExpiresAt
+}
+
+func (j *jwt) RefreshExpiresAt() int {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	return j.refreshExpiresAt
+}
+
+// SessionMaxAge is absolute lifetime of sign in, refresh tokens never expire after it
+func (j *jwt) SessionMaxAge() time.Duration { return j.sessionMaxAge }
+
+// CacheSize is max access tokens remembered as valid, 0 checks database every request
+func (j *jwt) CacheSize() int          { return j.cacheSize }
+func (j *jwt) CacheTTL() time.Duration { return j.cacheTTL }
+
+func (j *jwt) Algorithm() string { return j.algorithm }
+
+// KeysDir holds private keys of RS256 and EdDSA, one pem file per key id
+func (j *jwt) KeysDir() string { return j.keysDir }
+
+// KeyRotation is how long a key signs tokens, 0 rotates only by adding key files
+func (j *jwt) KeyRotation() time.Duration { return j.keyRotation }
+
+// KeyGrace is how long a key verifies tokens after a newer key signs
+func (j *jwt) KeyGrace() time.Duration { return j.keyGrace }
+
+func (j *jwt) SetJwtAccessExpires(t int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.accessExpiresAt = t
+}
+
+func (j *jwt) SetJwtRefreshExpires(t int) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.refreshExpiresAt = t
+}
+
+func (j *jwt) effective() map[string]any {
+	return map[string]any{
+		"secret_key":      mask(j.secertKey),
+		"admin_key":       mask(j.adminKey),
+		"access_expires":  j.AccessExpiresAt(),
+		"refresh_expires": j.RefreshExpiresAt(),
+		"session_max_age": j.sessionMaxAge.String(),
+		"cache_size":      j.cacheSize,
+		"cache_ttl":       j.cacheTTL.String(),
+		"algorithm":       j.algorithm,
+		"keys_dir":        j.keysDir,
+		"key_rotation":    j.keyRotation.String(),
+		"key_grace":       j.keyGrace.String(),
+	}
+}
+
+// reload sets both expires at once, readers never see a mix of old and new
+func (j *jwt) reload(next *jwt) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.accessExpiresAt = next.accessExpiresAt
+	j.refreshExpiresAt = next.refreshExpiresAt
+}
+
+func (j *jwt) validate(r *reader) {
+	keys := []struct {
+		name  string
+		value string
+	}{
+		{"JWT_SECRET_KEY", j.secertKey},
+		{"JWT_ADMIN_KEY", j.adminKey},
+	}
+	// Keys differing from each other is checked by validateDistinctKeys
+	for _, key := range keys {
+		if key.value != "" && len(key.value) < jwtMinKeyLength {
+			r.fail(key.name, "must be at least %d bytes", jwtMinKeyLength)
+		}
+	}
+
+	if j.accessExpiresAt < 1 {
+		r.fail("JWT_ACCESS_EXPIRES", "must be positive")
+	}
+	if j.refreshExpiresAt < j.accessExpiresAt {
+		r.fail("JWT_REFRESH_EXPIRES", "must not be shorter than JWT_ACCESS_EXPIRES")
+	}
+	if j.sessionMaxAge < time.Duration(j.refreshExpiresAt)*time.Second {
+		r.fail("JWT_SESSION_MAX_AGE", "must not be shorter than JWT_REFRESH_EXPIRES")
+	}
+	if j.cacheSize < 0 {
+		r.fail("JWT_CACHE_SIZE", "must not be negative")
+	}
+	if j.cacheSize > 0 && j.cacheTTL <= 0 {
+		r.fail("JWT_CACHE_TTL", "must be positive")
+	}
+
+	if !contains(jwtAlgorithms, j.algorithm) {
+		r.fail("JWT_ALGORITHM", "%q is not one of %v", j.algorithm, jwtAlgorithms)
+	}
+	if j.algorithm != "HS256" {
+		if j.keysDir == "" {
+			r.fail("JWT_KEYS_DIR", "is required for %s", j.algorithm)
+		}
+		if j.keyRotation != 0 && j.keyRotation < time.Hour {
+			r.fail("JWT_KEY_ROTATION", "must be 0 or at least 1h")
+		}
+		// Refresh tokens are verified by key that signed them
+		if j.keyGrace < time.Duration(j.refreshExpiresAt)*time.Second {
+			r.fail("JWT_KEY_GRACE", "must not be shorter than JWT_REFRESH_EXPIRES")
+		}
+	}
+}
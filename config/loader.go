@@ -0,0 +1,231 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// reader resolves a key from environment variables, then config file, then default.
+// Parse errors are collected so all of them are reported at once.
+type reader struct {
+	file map[string]string
+	errs []error
+}
+
+func newReader(path string) (*reader, error) {
+	r := &reader{file: make(map[string]string)}
+	if path == "" {
+		return r, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read config file failed: %v", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		var values map[string]any
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, fmt.Errorf("parse %s failed: %v", path, err)
+		}
+		flatten("", values, r.file)
+	case ".json":
+		var values map[string]any
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		if err := decoder.Decode(&values); err != nil {
+			return nil, fmt.Errorf("parse %s failed: %v", path, err)
+		}
+		flatten("", values, r.file)
+	default:
+		env, err := godotenv.Unmarshal(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("parse %s failed: %v", path, err)
+		}
+		r.file = env
+	}
+	return r, nil
+}
+
+// flatten maps nested keys to env names, e.g. app.port -> APP_PORT, lists are joined by comma
+func flatten(prefix string, value any, out map[string]string) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, child := range v {
+			name := strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+			if prefix != "" {
+				name = prefix + "_" + name
+			}
+			flatten(name, child, out)
+		}
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		out[prefix] = strings.Join(items, ",")
+	case nil:
+		out[prefix] = ""
+	default:
+		out[prefix] = fmt.Sprint(v)
+	}
+}
+
+func (r *reader) lookup(key string) (string, bool) {
+	if v := strings.TrimSpace(os.Getenv(key)); v != "" {
+		return v, true
+	}
+	if v := strings.TrimSpace(r.file[key]); v != "" {
+		return v, true
+	}
+	return "", false
+}
+
+func (r *reader) fail(key string, format string, args ...any) {
+	r.errs = append(r.errs, fmt.Errorf("%s: %s", key, fmt.Sprintf(format, args...)))
+}
+
+func (r *reader) string(key, fallback string) string {
+	if v, ok := r.lookup(key); ok {
+		return v
+	}
+	return fallback
+}
+
+// required is a string without default
+func (r *reader) required(key string) string {
+	v, ok := r.lookup(key)
+	if !ok {
+		r.fail(key, "is required")
+	}
+	return v
+}
+
+func (r *reader) int(key string, fallback int) int {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	result, err := strconv.Atoi(v)
+	if err != nil {
+		r.fail(key, "%q is not an integer", v)
+		return fallback
+	}
+	return result
+}
+
+func (r *reader) float(key string, fallback float64) float64 {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	result, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		r.fail(key, "%q is not a number", v)
+		return fallback
+	}
+	return result
+}
+
+func (r *reader) bool(key string, fallback bool) bool {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	result, err := strconv.ParseBool(v)
+	if err != nil {
+		r.fail(key, "%q is not a boolean", v)
+		return fallback
+	}
+	return result
+}
+
+// duration accepts go duration e.g. 15s, 1h30m, a plain integer is seconds
+func (r *reader) duration(key string, fallback time.Duration) time.Duration {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second
+	}
+	result, err := time.ParseDuration(v)
+	if err != nil {
+		r.fail(key, "%q is not a duration", v)
+		return fallback
+	}
+	return result
+}
+
+// list splits comma separated values, empty items are skipped
+func (r *reader) list(key string, fallback []string) []string {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+	result := make([]string, 0)
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// variants parses name:width,name:width, original is always appended
+func (r *reader) variants(key string, fallback string) []ImageVariant {
+	value := r.string(key, fallback)
+
+	result := make([]ImageVariant, 0)
+	for _, v := range strings.Split(value, ",") {
+		name, width, found := strings.Cut(strings.TrimSpace(v), ":")
+		w, err := strconv.Atoi(width)
+		if !found || !isVariantName(name) || name == "original" || err != nil || w < 1 || containsVariant(result, name) {
+			r.fail(key, "invalid variant %q", v)
+			continue
+		}
+		result = append(result, ImageVariant{Name: name, Width: w})
+	}
+	return append(result, ImageVariant{Name: "original"})
+}
+
+// isVariantName allows lower case letters, digits and -, name is part of file names
+func isVariantName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+func containsVariant(variants []ImageVariant, name string) bool {
+	for _, v := range variants {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
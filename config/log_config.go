@@ -0,0 +1,86 @@
+package config
+
+import "sync"
+
+type LogConfig interface {
+	Level() string
+	Dir() string
+	MaxSize() int
+	MaxAge() int
+	BufferSize() int
+	Stdout() bool
+	RedactFields() []string
+	RedactRoutes() []string
+}
+
+// Always redacted, LOG_REDACT_FIELDS and LOG_REDACT_ROUTES are added to these
+var (
+	DefaultRedactFields = []string{"password", "access_token", "refresh_token", "token", "x-api-key", "authorization", "mfa_token", "secret", "recovery_codes", "old_password", "new_password", "key", "enroll_token"}
+	DefaultRedactRoutes = []string{"/v1/users/admin/secret", "/v1/apikeys", "/v1/apikeys/*/rotate", "/v1/users/me/mfa", "/v1/users/me/mfa/*"}
+)
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+type logging struct {
+	mu         sync.RWMutex // guards level
+	level      string       // debug | info | warn | error
+	dir        string
+	maxSize    int // byte, file is rotated when exceeded
+	maxAge     int // day, older files are removed
+	bufferSize int // records waiting to be written
+	stdout     bool
+	redact     []string // json field names, case and -_ insensitive
+	routes     []string // path patterns, payload is redacted entirely
+}
+
+func (c *config) Log() LogConfig {
+	return c.log
+}
+
+func (l *logging) Level() string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.level
+}
+
+func (l *logging) Dir() string            { return l.dir }
+func (l *logging) MaxSize() int           { return l.maxSize }
+func (l *logging) MaxAge() int            { return l.maxAge }
+func (l *logging) BufferSize() int        { return l.bufferSize }
+func (l *logging) Stdout() bool           { return l.stdout }
+func (l *logging) RedactFields() []string { return l.redact }
+func (l *logging) RedactRoutes() []string { return l.routes }
+
+func (l *logging) effective() map[string]any {
+	return map[string]any{
+		"level":         l.Level(),
+		"dir":           l.dir,
+		"max_size":      l.maxSize,
+		"max_age":       l.maxAge,
+		"buffer_size":   l.bufferSize,
+		"stdout":        l.stdout,
+		"redact_fields": l.redact,
+		"redact_routes": l.routes,
+	}
+}
+
+func (l *logging) reload(next *logging) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.level = next.level
+}
+
+func (l *logging) validate(r *reader) {
+	if !contains(logLevels, l.level) {
+		r.fail("LOG_LEVEL", "%q must be one of %v", l.level, logLevels)
+	}
+	if l.maxSize < 0 {
+		r.fail("LOG_MAX_SIZE", "must not be negative")
+	}
+	if l.maxAge < 0 {
+		r.fail("LOG_MAX_AGE", "must not be negative")
+	}
+	if l.bufferSize < 1 {
+		r.fail("LOG_BUFFER_SIZE", "must be positive")
+	}
+}
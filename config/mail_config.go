@@ -0,0 +1,92 @@
+package config
+
+import (
+	"net/mail"
+	"time"
+)
+
+var mailDrivers = []string{"smtp", "file", "log"}
+
+type MailConfig interface {
+	Driver() string
+	From() string
+	Dir() string
+	SmtpHost() string
+	SmtpPort() int
+	SmtpUsername() string
+	SmtpPassword() string
+	LinkBaseUrl() string
+	VerifyExpires() time.Duration
+	ResetExpires() time.Duration
+}
+
+type mailConfig struct {
+	driver        string // smtp | file | log, file and log are for local testing, log does not write bodies
+	from          string
+	dir           string // messages of file driver
+	smtpHost      string
+	smtpPort      int // 465 is implicit tls, other ports use starttls if offered
+	smtpUsername  string
+	smtpPassword  string
+	linkBaseUrl   string // url of web app, links in mails are under it
+	verifyExpires time.Duration
+	resetExpires  time.Duration
+}
+
+func (c *config) Mail() MailConfig {
+	return c.mail
+}
+
+func (m *mailConfig) Driver() string               { return m.driver }
+func (m *mailConfig) From() string                 { return m.from }
+func (m *mailConfig) Dir() string                  { return m.dir }
+func (m *mailConfig) SmtpHost() string             { return m.smtpHost }
+func (m *mailConfig) SmtpPort() int                { return m.smtpPort }
+func (m *mailConfig) SmtpUsername() string         { return m.smtpUsername }
+func (m *mailConfig) SmtpPassword() string         { return m.smtpPassword }
+func (m *mailConfig) LinkBaseUrl() string          { return m.linkBaseUrl }
+func (m *mailConfig) VerifyExpires() time.Duration { return m.verifyExpires }
+func (m *mailConfig) ResetExpires() time.Duration  { return m.resetExpires }
+
+func (m *mailConfig) effective() map[string]any {
+	return map[string]any{
+		"driver":         m.driver,
+		"from":           m.from,
+		"dir":            m.dir,
+		"smtp_host":      m.smtpHost,
+		"smtp_port":      m.smtpPort,
+		"smtp_username":  m.smtpUsername,
+		"smtp_password":  mask(m.smtpPassword),
+		"link_base_url":  m.linkBaseUrl,
+		"verify_expires": m.verifyExpires.String(),
+		"reset_expires":  m.resetExpires.String(),
+	}
+}
+
+func (m *mailConfig) validate(r *reader) {
+	if !contains(mailDrivers, m.driver) {
+		r.fail("MAIL_DRIVER", "%q is not one of %v", m.driver, mailDrivers)
+	}
+	if _, err := mail.ParseAddress(m.from); err != nil {
+		r.fail("MAIL_FROM", "%q is not an email address", m.from)
+	}
+	switch m.driver {
+	case "smtp":
+		if m.smtpHost == "" {
+			r.fail("MAIL_SMTP_HOST", "is required by smtp driver")
+		}
+		if m.smtpPort < 1 || m.smtpPort > 65535 {
+			r.fail("MAIL_SMTP_PORT", "must be between 1 and 65535")
+		}
+	case "file":
+		if m.dir == "" {
+			r.fail("MAIL_DIR", "is required by file driver")
+		}
+	}
+	if m.verifyExpires <= 0 {
+		r.fail("MAIL_VERIFY_EXPIRES", "must be positive")
+	}
+	if m.resetExpires <= 0 {
+		r.fail("MAIL_RESET_EXPIRES", "must be positive")
+	}
+}
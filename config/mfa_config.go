@@ -0,0 +1,61 @@
+package config
+
+import "time"
+
+type MfaConfig interface {
+	Issuer() string
+	SecretKey() []byte
+	RequireAdmin() bool
+	ChallengeExpires() time.Duration
+	EnrollExpires() time.Duration
+	RecoveryCodes() int
+}
+
+type mfa struct {
+	issuer           string // shown by authenticator apps
+	secretKey        string // encrypts totp secrets in database
+	requireAdmin     bool   // admins enroll by token issued by another admin
+	challengeExpires time.Duration
+	enrollExpires    time.Duration
+	recoveryCodes    int
+}
+
+func (c *config) Mfa() MfaConfig {
+	return c.mfa
+}
+
+func (m *mfa) Issuer() string                  { return m.issuer }
+func (m *mfa) SecretKey() []byte               { return []byte(m.secretKey) }
+func (m *mfa) RequireAdmin() bool              { return m.requireAdmin }
+func (m *mfa) ChallengeExpires() time.Duration { return m.challengeExpires }
+func (m *mfa) EnrollExpires() time.Duration    { return m.enrollExpires }
+func (m *mfa) RecoveryCodes() int              { return m.recoveryCodes }
+
+func (m *mfa) effective() map[string]any {
+	return map[string]any{
+		"issuer":            m.issuer,
+		"secret_key":        mask(m.secretKey),
+		"require_admin":     m.requireAdmin,
+		"challenge_expires": m.challengeExpires.String(),
+		"enroll_expires":    m.enrollExpires.String(),
+		"recovery_codes":    m.recoveryCodes,
+	}
+}
+
+func (m *mfa) validate(r *reader) {
+	if m.issuer == "" {
+		r.fail("MFA_ISSUER", "is required")
+	}
+	if len(m.secretKey) < jwtMinKeyLength {
+		r.fail("MFA_SECRET_KEY", "must be at least %d bytes", jwtMinKeyLength)
+	}
+	if m.challengeExpires < time.Minute {
+		r.fail("MFA_CHALLENGE_EXPIRES", "must be at least 1m")
+	}
+	if m.enrollExpires < time.Minute {
+		r.fail("MFA_ENROLL_EXPIRES", "must be at least 1m")
+	}
+	if m.recoveryCodes < 1 || m.recoveryCodes > 20 {
+		r.fail("MFA_RECOVERY_CODES", "must be between 1 and 20")
+	}
+}
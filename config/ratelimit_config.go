@@ -0,0 +1,147 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type RateLimitConfig interface {
+	Enabled() bool
+	Store() string
+	Ip() RateLimit
+	ApiKey() RateLimit
+	Email() RateLimit
+	LockoutThreshold() int
+	LockoutWindow() time.Duration
+	LockoutBase() time.Duration
+	LockoutMax() time.Duration
+}
+
+// RateLimit allows Requests per Period, bursts up to Requests
+type RateLimit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l RateLimit) String() string { return fmt.Sprintf("%d/%s", l.Requests, l.Period) }
+
+type rateLimit struct {
+	mu        sync.RWMutex // guards limits
+	enabled   bool
+	store     string // memory
+	ip        RateLimit
+	apiKey    RateLimit
+	email     RateLimit
+	threshold int           // failed signins before lockout
+	window    time.Duration // failed signins are counted in
+	base      time.Duration // first lockout, doubled on every next failure
+	max       time.Duration
+}
+
+func (c *config) RateLimit() RateLimitConfig {
+	return c.rateLimit
+}
+
+func (l *rateLimit) Enabled() bool { return l.enabled }
+func (l *rateLimit) Store() string { return l.store }
+
+func (l *rateLimit) Ip() RateLimit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.ip
+}
+
+func (l *rateLimit) ApiKey() RateLimit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.apiKey
+}
+
+func (l *rateLimit) Email() RateLimit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.email
+}
+
+func (l *rateLimit) LockoutThreshold() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.threshold
+}
+
+func (l *rateLimit) LockoutWindow() time.Duration { return l.window }
+func (l *rateLimit) LockoutBase() time.Duration   { return l.base }
+func (l *rateLimit) LockoutMax() time.Duration    { return l.max }
+
+func (l *rateLimit) effective() map[string]any {
+	return map[string]any{
+		"enabled":           l.enabled,
+		"store":             l.store,
+		"ip":                l.Ip().String(),
+		"api_key":           l.ApiKey().String(),
+		"email":             l.Email().String(),
+		"lockout_threshold": l.LockoutThreshold(),
+		"lockout_window":    l.window.String(),
+		"lockout_base":      l.base.String(),
+		"lockout_max":       l.max.String(),
+	}
+}
+
+func (l *rateLimit) reload(next *rateLimit) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.ip = next.ip
+	l.apiKey = next.apiKey
+	l.email = next.email
+	l.threshold = next.threshold
+}
+
+func (l *rateLimit) validate(r *reader) {
+	if l.store != "memory" {
+		r.fail("RATE_LIMIT_STORE", "%q must be memory", l.store)
+	}
+	if l.threshold < 1 {
+		r.fail("RATE_LIMIT_LOCKOUT_THRESHOLD", "must be positive")
+	}
+	for key, d := range map[string]time.Duration{
+		"RATE_LIMIT_LOCKOUT_WINDOW": l.window,
+		"RATE_LIMIT_LOCKOUT_BASE":   l.base,
+		"RATE_LIMIT_LOCKOUT_MAX":    l.max,
+	} {
+		if d <= 0 {
+			r.fail(key, "must be positive")
+		}
+	}
+	if l.max < l.base {
+		r.fail("RATE_LIMIT_LOCKOUT_MAX", "must not be shorter than RATE_LIMIT_LOCKOUT_BASE")
+	}
+}
+
+// rate parses requests/period e.g. 10/1m, period of plain integer is seconds
+func (r *reader) rate(key string, fallback RateLimit) RateLimit {
+	v, ok := r.lookup(key)
+	if !ok {
+		return fallback
+	}
+
+	requests, period, found := strings.Cut(v, "/")
+	n, err := strconv.Atoi(strings.TrimSpace(requests))
+	if !found || err != nil || n < 1 {
+		r.fail(key, "%q must be requests/period e.g. 10/1m", v)
+		return fallback
+	}
+
+	period = strings.TrimSpace(period)
+	d, err := time.ParseDuration(period)
+	if sec, convErr := strconv.Atoi(period); convErr == nil {
+		d, err = time.Duration(sec)*time.Second, nil
+	}
+	if err != nil || d <= 0 {
+		r.fail(key, "%q must be requests/period e.g. 10/1m", v)
+		return fallback
+	}
+	return RateLimit{Requests: n, Period: d}
+}
@@ -0,0 +1,94 @@
+package config
+
+import (
+	"net/url"
+	"strings"
+)
+
+type StorageConfig interface {
+	Driver() string
+	LocalPath() string
+	BaseUrl() string
+	SignKey() []byte
+	Endpoint() string
+	Region() string
+	Bucket() string
+	AccessKey() string
+	SecretKey() string
+	PublicDestinations() []string
+	PrivateDestinations() []string
+	CacheMaxAge() int
+}
+
+type storage struct {
+	driver    string // local | s3
+	localPath string
+	baseUrl   string // public url of objects
+	signKey   string
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	public    []string // served to everyone
+	private   []string // served with jwt or signed url only
+	maxAge    int      // sec
+}
+
+func (c *config) Storage() StorageConfig {
+	return c.storage
+}
+
+func (s *storage) Driver() string                { return s.driver }
+func (s *storage) LocalPath() string             { return s.localPath }
+func (s *storage) BaseUrl() string               { return s.baseUrl }
+func (s *storage) SignKey() []byte               { return []byte(s.signKey) }
+func (s *storage) Endpoint() string              { return s.endpoint }
+func (s *storage) Region() string                { return s.region }
+func (s *storage) Bucket() string                { return s.bucket }
+func (s *storage) AccessKey() string             { return s.accessKey }
+func (s *storage) SecretKey() string             { return s.secretKey }
+func (s *storage) PublicDestinations() []string  { return s.public }
+func (s *storage) PrivateDestinations() []string { return s.private }
+func (s *storage) CacheMaxAge() int              { return s.maxAge }
+
+func (s *storage) effective() map[string]any {
+	return map[string]any{
+		"driver":               s.driver,
+		"local_path":           s.localPath,
+		"base_url":             s.baseUrl,
+		"sign_key":             mask(s.signKey),
+		"s3_endpoint":          s.endpoint,
+		"s3_region":            s.region,
+		"s3_bucket":            s.bucket,
+		"s3_access_key":        mask(s.accessKey),
+		"s3_secret_key":        mask(s.secretKey),
+		"public_destinations":  s.public,
+		"private_destinations": s.private,
+		"cache_max_age":        s.maxAge,
+	}
+}
+
+func (s *storage) validate(r *reader) {
+	switch s.driver {
+	case "local":
+	case "s3":
+		// Region has a default, s3 compatible stores mostly ignore it
+		if s.endpoint == "" {
+			r.fail("STORAGE_S3_ENDPOINT", "is required by s3 driver")
+		} else if u, err := url.Parse(strings.TrimSuffix(s.endpoint, "/")); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			r.fail("STORAGE_S3_ENDPOINT", "%q must be http or https url", s.endpoint)
+		}
+		if s.bucket == "" {
+			r.fail("STORAGE_S3_BUCKET", "is required by s3 driver")
+		}
+	default:
+		r.fail("STORAGE_DRIVER", "%q must be local or s3", s.driver)
+	}
+	if len(s.signKey) < jwtMinKeyLength {
+		r.fail("STORAGE_SIGN_KEY", "must be at least %d bytes", jwtMinKeyLength)
+	}
+	if s.maxAge < 0 {
+		r.fail("STORAGE_CACHE_MAX_AGE", "must not be negative")
+	}
+}
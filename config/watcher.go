@@ -0,0 +1,210 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"reflect"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Values applied without restart, section.key of Effective
+var reloadable = map[string]bool{
+	"app.file_limit":      true,
+	"jwt.access_expires":  true,
+	"jwt.refresh_expires": true,
+	"log.level":           true,
+	"cors.allow_origins":  true,
+
+	"cors.admin_allow_origins":   true,
+	"cors.appinfo_allow_origins": true,
+
+	"rate_limit.ip":                true,
+	"rate_limit.api_key":           true,
+	"rate_limit.email":             true,
+	"rate_limit.lockout_threshold": true,
+}
+
+// How often config file is checked for changes
+const watchInterval = 2 * time.Second
+
+type IWatcher interface {
+	OnValidate(fn func(next Config) error)
+	OnReload(fn func(cfg Config))
+	Start()
+	Stop()
+	Reload() error
+}
+
+// watcher reloads config file on SIGHUP or when the file changes
+type watcher struct {
+	cfg     *config
+	path    string
+	mu      sync.Mutex
+	checks  []func(next Config) error
+	hooks   []func(cfg Config)
+	modTime time.Time
+	size    int64
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewWatcher(cfg Config, path string) (IWatcher, error) {
+	c, ok := cfg.(*config)
+	if !ok {
+		return nil, fmt.Errorf("config is not reloadable")
+	}
+
+	w := &watcher{
+		cfg:  c,
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	w.modTime, w.size = w.stat()
+	return w, nil
+}
+
+// OnValidate registers fn, it is called with loaded config before values
+// are applied. An error rejects reload, e.g. values other packages can not use
+func (w *watcher) OnValidate(fn func(next Config) error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.checks = append(w.checks, fn)
+}
+
+// OnReload registers fn, it is called after values are applied
+func (w *watcher) OnReload(fn func(cfg Config)) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.hooks = append(w.hooks, fn)
+}
+
+func (w *watcher) Start() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		defer close(w.done)
+		defer signal.Stop(hup)
+
+		ticker := time.NewTicker(watchInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.stop:
+				return
+			case <-hup:
+			case <-ticker.C:
+				modTime, size := w.stat()
+				if modTime.Equal(w.modTime) && size == w.size {
+					continue
+				}
+			}
+
+			if err := w.Reload(); err != nil {
+				slog.Error("reload config failed", slog.String("path", w.path), slog.String("error", err.Error()))
+			}
+		}
+	}()
+}
+
+func (w *watcher) Stop() {
+	select {
+	case <-w.stop:
+		return
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+// Reload loads config file again and applies reloadable values,
+// invalid file keeps current config
+func (w *watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.modTime, w.size = w.stat()
+
+	loaded, err := Load(w.path)
+	if err != nil {
+		return err
+	}
+	next := loaded.(*config)
+
+	// Body limit is not reloadable, file limit must still fit in it
+	if next.app.fileLimit > w.cfg.app.bodyLimit {
+		return fmt.Errorf("APP_FILE_LIMIT: must not exceed APP_BODY_LIMIT %d", w.cfg.app.bodyLimit)
+	}
+	// Key grace is not reloadable, refresh tokens must still be verified by key that signed them
+	if w.cfg.jwt.algorithm != "HS256" && time.Duration(next.jwt.refreshExpiresAt)*time.Second > w.cfg.jwt.keyGrace {
+		return fmt.Errorf("JWT_REFRESH_EXPIRES: must not exceed JWT_KEY_GRACE %s", w.cfg.jwt.keyGrace)
+	}
+	for _, fn := range w.checks {
+		if err := fn(next); err != nil {
+			return err
+		}
+	}
+
+	applied, restart := changes(w.cfg.Effective(), next.Effective())
+
+	w.cfg.app.reload(next.app)
+	w.cfg.jwt.reload(next.jwt)
+	w.cfg.log.reload(next.log)
+	w.cfg.cors.reload(next.cors)
+	w.cfg.rateLimit.reload(next.rateLimit)
+
+	if len(restart) > 0 {
+		slog.Warn("config changed, restart is required to apply", slog.Any("keys", restart))
+	}
+	slog.Info("config reloaded", slog.String("path", w.path), slog.Any("applied", applied))
+
+	for _, fn := range w.hooks {
+		fn(w.cfg)
+	}
+	return nil
+}
+
+func (w *watcher) stat() (time.Time, int64) {
+	info, err := os.Stat(w.path)
+	if err != nil {
+		return time.Time{}, 0
+	}
+	return info.ModTime(), info.Size()
+}
+
+// changes returns changed section.key, split by reloadable or not
+func changes(current, next map[string]map[string]any) ([]string, []string) {
+	applied := make([]string, 0)
+	restart := make([]string, 0)
+	for section, values := range next {
+		for key, v := range values {
+			if reflect.DeepEqual(current[section][key], v) {
+				continue
+			}
+			name := section + "." + key
+			if reloadable[name] {
+				applied = append(applied, name)
+			} else {
+				restart = append(restart, name)
+			}
+		}
+	}
+	sort.Strings(applied)
+	sort.Strings(restart)
+	return applied, restart
+}
+
+// mask hides secrets in Effective, only whether it is set is shown
+func mask(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "******"
+}
@@ -0,0 +1,121 @@
+package apikeys
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+)
+
+// Keys are keyPrefix and 32 random bytes, prefixLength chars are shown in lists
+const (
+	keyPrefix    = "gek_"
+	prefixLength = len(keyPrefix) + 8
+)
+
+// Scopes are resource:action allowed to api key, auth covers sign up, in, refresh and out
+const (
+	ScopeAuth           = "auth"
+	ScopeCategoriesRead = "categories:read"
+	ScopeProductsRead   = "products:read"
+)
+
+var Scopes = []string{ScopeAuth, ScopeCategoriesRead, ScopeProductsRead}
+
+type ApiKey struct {
+	Id             string     `db:"id" json:"id"`
+	Name           string     `db:"name" json:"name"`
+	Prefix         string     `db:"prefix" json:"prefix"`
+	OwnerId        string     `db:"owner_id" json:"owner_id"`
+	Scopes         []string   `db:"scopes" json:"scopes"`
+	AllowedOrigins []string   `db:"allowed_origins" json:"allowed_origins"`
+	AllowedIps     []string   `db:"allowed_ips" json:"allowed_ips"`
+	ExpiresAt      *time.Time `db:"expires_at" json:"expires_at"`
+	LastUsedAt     *time.Time `db:"last_used_at" json:"last_used_at"`
+	RevokedAt      *time.Time `db:"revoked_at" json:"revoked_at"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	// Key is returned once by create and rotate, only its hash is stored
+	Key     string `json:"key,omitempty"`
+	KeyHash string `db:"key_hash" json:"-"`
+}
+
+// NewKey sets Key, Prefix and KeyHash to a new random key
+func (obj *ApiKey) NewKey() error {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Errorf("generate api key failed: %v", err)
+	}
+	obj.Key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	obj.Prefix = obj.Key[:prefixLength]
+	obj.KeyHash = auth.HashToken(obj.Key)
+	return nil
+}
+
+func (obj *ApiKey) HasScope(scope string) bool {
+	for _, s := range obj.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Allows checks origin and ip of request, empty lists allow any,
+// requests without Origin header are refused by origin list
+func (obj *ApiKey) Allows(origin, ip string) error {
+	if len(obj.AllowedOrigins) > 0 {
+		origin = NormalizeOrigin(origin)
+		found := false
+		for _, o := range obj.AllowedOrigins {
+			if o == origin {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("origin is not allowed")
+		}
+	}
+
+	if len(obj.AllowedIps) > 0 {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return fmt.Errorf("ip is not allowed")
+		}
+		addr = addr.Unmap()
+		for _, allowed := range obj.AllowedIps {
+			prefix, err := ParseIp(allowed)
+			if err == nil && prefix.Contains(addr) {
+				return nil
+			}
+		}
+		return fmt.Errorf("ip is not allowed")
+	}
+	return nil
+}
+
+// ParseIp accepts an ip or cidr, an ip is a prefix of full length
+func ParseIp(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// NormalizeOrigin compares origins without case and trailing slash
+func NormalizeOrigin(origin string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(origin)), "/")
+}
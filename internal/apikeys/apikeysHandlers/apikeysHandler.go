@@ -0,0 +1,146 @@
+package apikeysHandlers
+
+import (
+	"strings"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/apikeys"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysUsecases"
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/gofiber/fiber/v2"
+)
+
+type apiKeysErrCode string
+
+const (
+	findApiKeysErrCode   apiKeysErrCode = "apikeys-001"
+	findOneApiKeyErrCode apiKeysErrCode = "apikeys-002"
+	insertApiKeyErrCode  apiKeysErrCode = "apikeys-003"
+	rotateApiKeyErrCode  apiKeysErrCode = "apikeys-004"
+	revokeApiKeyErrCode  apiKeysErrCode = "apikeys-005"
+)
+
+type IApiKeysHandler interface {
+	FindApiKeys(c *fiber.Ctx) error
+	FindOneApiKey(c *fiber.Ctx) error
+	InsertApiKey(c *fiber.Ctx) error
+	RotateApiKey(c *fiber.Ctx) error
+	RevokeApiKey(c *fiber.Ctx) error
+}
+
+type apiKeysHandler struct {
+	cfg     config.Config
+	usecase apikeysUsecases.IApiKeysUsecase
+}
+
+func ApiKeysHandler(cfg config.Config, usecase apikeysUsecases.IApiKeysUsecase) IApiKeysHandler {
+	return &apiKeysHandler{
+		cfg:     cfg,
+		usecase: usecase,
+	}
+}
+
+func (h *apiKeysHandler) FindApiKeys(c *fiber.Ctx) error {
+	result, err := h.usecase.FindApiKeys()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findApiKeysErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *apiKeysHandler) FindOneApiKey(c *fiber.Ctx) error {
+	key, err := h.usecase.FindOneApiKey(strings.Trim(c.Params("apikey_id"), " "))
+	if err != nil {
+		return apiKeyError(c, findOneApiKeyErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, key).Res()
+}
+
+// InsertApiKey returns the key once, owner is the admin if owner_id is empty
+func (h *apiKeysHandler) InsertApiKey(c *fiber.Ctx) error {
+	req := new(apikeys.ApiKey)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertApiKeyErrCode),
+			err.Error(),
+		).Res()
+	}
+	owner := strings.TrimSpace(req.OwnerId)
+	if owner == "" {
+		owner, _ = c.Locals("userId").(string)
+	}
+	*req = apikeys.ApiKey{
+		Name:           req.Name,
+		OwnerId:        owner,
+		Scopes:         req.Scopes,
+		AllowedOrigins: req.AllowedOrigins,
+		AllowedIps:     req.AllowedIps,
+		ExpiresAt:      req.ExpiresAt,
+	}
+
+	if err := h.usecase.InsertApiKey(req); err != nil {
+		return apiKeyError(c, insertApiKeyErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, req).Res()
+}
+
+// RotateApiKey returns the new key once, old key is refused at once
+func (h *apiKeysHandler) RotateApiKey(c *fiber.Ctx) error {
+	key, err := h.usecase.RotateApiKey(strings.Trim(c.Params("apikey_id"), " "))
+	if err != nil {
+		return apiKeyError(c, rotateApiKeyErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, key).Res()
+}
+
+func (h *apiKeysHandler) RevokeApiKey(c *fiber.Ctx) error {
+	apiKeyId := strings.Trim(c.Params("apikey_id"), " ")
+	if err := h.usecase.RevokeApiKey(apiKeyId); err != nil {
+		return apiKeyError(c, revokeApiKeyErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			ApiKeyId string `json:"apikey_id"`
+		}{
+			ApiKeyId: apiKeyId,
+		},
+	).Res()
+}
+
+// apiKeyError maps usecase errors to status code
+func apiKeyError(c *fiber.Ctx, code apiKeysErrCode, err error) error {
+	status := fiber.ErrInternalServerError.Code
+	msg := err.Error()
+	switch {
+	case msg == "api key not found":
+		status = fiber.ErrNotFound.Code
+	case msg == "api key has been revoked":
+		status = fiber.ErrConflict.Code
+	case strings.HasSuffix(msg, " is required"),
+		strings.HasSuffix(msg, " are required"),
+		strings.HasPrefix(msg, "scope "),
+		strings.HasPrefix(msg, "allowed "),
+		strings.HasPrefix(msg, "expires_at "):
+		status = fiber.ErrBadRequest.Code
+	case strings.Contains(msg, "foreign key"):
+		status = fiber.ErrBadRequest.Code
+		msg = "owner not found"
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		msg,
+	).Res()
+}
@@ -0,0 +1,236 @@
+package apikeysRepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/apikeys"
+)
+
+type IApiKeysRepository interface {
+	FindApiKeys() ([]*apikeys.ApiKey, error)
+	FindOneApiKey(id string) (*apikeys.ApiKey, error)
+	FindOneApiKeyByHash(keyHash string) (*apikeys.ApiKey, error)
+	InsertApiKey(req *apikeys.ApiKey) error
+	RotateApiKey(req *apikeys.ApiKey) error
+	RevokeApiKey(id string) error
+	UpdateLastUsed(id string, usedAt time.Time) error
+}
+
+type apiKeysRepository struct {
+	db *sql.DB
+}
+
+func ApiKeysRepository(db *sql.DB) IApiKeysRepository {
+	return &apiKeysRepository{db: db}
+}
+
+const selectApiKey = `
+	SELECT
+		"id",
+		"name",
+		"prefix",
+		"key_hash",
+		"owner_id",
+		"scopes",
+		"allowed_origins",
+		"allowed_ips",
+		"expires_at",
+		"last_used_at",
+		"revoked_at",
+		"created_at"
+	FROM "api_keys"
+`
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanApiKey(row scanner) (*apikeys.ApiKey, error) {
+	key := new(apikeys.ApiKey)
+	var scopes, origins, ips []byte
+	if err := row.Scan(
+		&key.Id,
+		&key.Name,
+		&key.Prefix,
+		&key.KeyHash,
+		&key.OwnerId,
+		&scopes,
+		&origins,
+		&ips,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+		&key.RevokedAt,
+		&key.CreatedAt,
+	); err != nil {
+		return nil, err
+	}
+
+	for _, f := range []struct {
+		data []byte
+		dest *[]string
+	}{
+		{scopes, &key.Scopes},
+		{origins, &key.AllowedOrigins},
+		{ips, &key.AllowedIps},
+	} {
+		if err := json.Unmarshal(f.data, f.dest); err != nil {
+			return nil, fmt.Errorf("unmarshal api key failed: %v", err)
+		}
+	}
+	return key, nil
+}
+
+func (r *apiKeysRepository) FindApiKeys() ([]*apikeys.ApiKey, error) {
+	rows, err := r.db.Query(selectApiKey + `ORDER BY "created_at" DESC;`)
+	if err != nil {
+		return nil, fmt.Errorf("query api keys failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := make([]*apikeys.ApiKey, 0)
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api keys failed: %v", err)
+		}
+		result = append(result, key)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return result, nil
+}
+
+func (r *apiKeysRepository) FindOneApiKey(id string) (*apikeys.ApiKey, error) {
+	key, err := scanApiKey(r.db.QueryRow(selectApiKey+`WHERE "id"::TEXT = $1;`, id))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("get api key failed: %v", err)
+	}
+	return key, nil
+}
+
+func (r *apiKeysRepository) FindOneApiKeyByHash(keyHash string) (*apikeys.ApiKey, error) {
+	key, err := scanApiKey(r.db.QueryRow(selectApiKey+`WHERE "key_hash" = $1;`, keyHash))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("api key not found")
+		}
+		return nil, fmt.Errorf("get api key failed: %v", err)
+	}
+	return key, nil
+}
+
+func (r *apiKeysRepository) InsertApiKey(req *apikeys.ApiKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	scopes, err := json.Marshal(req.Scopes)
+	if err != nil {
+		return fmt.Errorf("marshal scopes failed: %v", err)
+	}
+	origins, err := json.Marshal(req.AllowedOrigins)
+	if err != nil {
+		return fmt.Errorf("marshal allowed origins failed: %v", err)
+	}
+	ips, err := json.Marshal(req.AllowedIps)
+	if err != nil {
+		return fmt.Errorf("marshal allowed ips failed: %v", err)
+	}
+
+	query := `
+		INSERT INTO "api_keys" (
+			"name",
+			"prefix",
+			"key_hash",
+			"owner_id",
+			"scopes",
+			"allowed_origins",
+			"allowed_ips",
+			"expires_at"
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING "id", "created_at";
+	`
+	if err := r.db.QueryRowContext(
+		ctx,
+		query,
+		req.Name,
+		req.Prefix,
+		req.KeyHash,
+		req.OwnerId,
+		scopes,
+		origins,
+		ips,
+		req.ExpiresAt,
+	).Scan(&req.Id, &req.CreatedAt); err != nil {
+		return fmt.Errorf("insert api key failed: %v", err)
+	}
+	return nil
+}
+
+// RotateApiKey replaces hash of key, old key stops working at once
+func (r *apiKeysRepository) RotateApiKey(req *apikeys.ApiKey) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "api_keys" SET
+			"prefix" = $2,
+			"key_hash" = $3
+		WHERE "id"::TEXT = $1
+		AND "revoked_at" IS NULL;
+	`
+	res, err := r.db.ExecContext(ctx, query, req.Id, req.Prefix, req.KeyHash)
+	if err != nil {
+		return fmt.Errorf("rotate api key failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+// RevokeApiKey keeps the row, revoked keys are listed with revoked_at
+func (r *apiKeysRepository) RevokeApiKey(id string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "api_keys" SET
+			"revoked_at" = now()
+		WHERE "id"::TEXT = $1
+		AND "revoked_at" IS NULL;
+	`
+	res, err := r.db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("revoke api key failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("api key not found")
+	}
+	return nil
+}
+
+func (r *apiKeysRepository) UpdateLastUsed(id string, usedAt time.Time) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "api_keys" SET
+			"last_used_at" = $2
+		WHERE "id"::TEXT = $1;
+	`
+	if _, err := r.db.ExecContext(ctx, query, id, usedAt); err != nil {
+		return fmt.Errorf("update api key last used failed: %v", err)
+	}
+	return nil
+}
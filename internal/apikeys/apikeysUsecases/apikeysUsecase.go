@@ -0,0 +1,308 @@
+package apikeysUsecases
+
+import (
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/apikeys"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysRepositories"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+)
+
+const (
+	// Keys revoked by other instances are accepted until ttl
+	cacheTTL = 30 * time.Second
+	// Unknown keys are refused without database for ttl to 2*ttl, at most size per ttl
+	unknownTTL  = 5 * time.Second
+	unknownSize = 10000
+	// last_used_at is written at most once per interval for each key
+	lastUsedInterval = time.Minute
+)
+
+type IApiKeysUsecase interface {
+	// Authenticate finds key by its hash, revoked and expired keys are refused
+	Authenticate(key string) (*apikeys.ApiKey, error)
+	FindApiKeys() ([]*apikeys.ApiKey, error)
+	FindOneApiKey(id string) (*apikeys.ApiKey, error)
+	InsertApiKey(req *apikeys.ApiKey) error
+	RotateApiKey(id string) (*apikeys.ApiKey, error)
+	RevokeApiKey(id string) error
+}
+
+type apiKeysUsecase struct {
+	repo   apikeysRepositories.IApiKeysRepository
+	tokens auth.ITokenCache // keys of owner revoked by RevokeUser are loaded again
+
+	mu       sync.Mutex
+	cache    map[string]*cachedApiKey
+	lastUsed map[string]time.Time
+
+	// Hashes not found in database, two generations swapped every ttl
+	unknown     map[string]struct{}
+	unknownPrev map[string]struct{}
+	unknownAt   time.Time
+}
+
+type cachedApiKey struct {
+	key      *apikeys.ApiKey
+	loadedAt time.Time
+}
+
+func ApiKeysUsecase(repo apikeysRepositories.IApiKeysRepository, tokens auth.ITokenCache) IApiKeysUsecase {
+	return &apiKeysUsecase{
+		repo:        repo,
+		tokens:      tokens,
+		cache:       make(map[string]*cachedApiKey),
+		lastUsed:    make(map[string]time.Time),
+		unknown:     make(map[string]struct{}),
+		unknownPrev: make(map[string]struct{}),
+		unknownAt:   time.Now(),
+	}
+}
+
+func (u *apiKeysUsecase) Authenticate(key string) (*apikeys.ApiKey, error) {
+	if key == "" {
+		return nil, fmt.Errorf("api key is required")
+	}
+	hash := auth.HashToken(key)
+	now := time.Now()
+
+	u.mu.Lock()
+	cached, ok := u.cache[hash]
+	unknown := u.isUnknown(hash, now)
+	u.mu.Unlock()
+
+	if unknown {
+		return nil, fmt.Errorf("api key is invalid")
+	}
+
+	// Suspended or deleted owner is revoked by token cache, its keys are loaded again
+	var result *apikeys.ApiKey
+	if ok && now.Sub(cached.loadedAt) < cacheTTL && !u.tokens.UserRevoked(cached.key.OwnerId, cached.loadedAt) {
+		result = cached.key
+	} else {
+		found, err := u.repo.FindOneApiKeyByHash(hash)
+		if err != nil {
+			if err.Error() == "api key not found" {
+				u.mu.Lock()
+				if len(u.unknown) < unknownSize {
+					u.unknown[hash] = struct{}{}
+				}
+				u.mu.Unlock()
+				return nil, fmt.Errorf("api key is invalid")
+			}
+			return nil, err
+		}
+		result = found
+	}
+
+	if result.RevokedAt != nil {
+		u.forget(result.Id)
+		return nil, fmt.Errorf("api key has been revoked")
+	}
+	if result.ExpiresAt != nil && now.After(*result.ExpiresAt) {
+		u.forget(result.Id)
+		return nil, fmt.Errorf("api key has expired")
+	}
+
+	u.mu.Lock()
+	if !ok || cached.key != result {
+		u.sweep(now)
+		u.cache[hash] = &cachedApiKey{key: result, loadedAt: now}
+	}
+	touch := now.Sub(u.lastUsed[result.Id]) >= lastUsedInterval
+	if touch {
+		u.lastUsed[result.Id] = now
+	}
+	u.mu.Unlock()
+
+	if touch {
+		// Usage is informational, request is not failed by it
+		if err := u.repo.UpdateLastUsed(result.Id, now); err != nil {
+			slog.Warn("update api key last used failed", slog.String("api_key_id", result.Id), slog.String("error", err.Error()))
+		}
+	}
+	return result, nil
+}
+
+// sweep must be called with mu locked
+func (u *apiKeysUsecase) sweep(now time.Time) {
+	for hash, cached := range u.cache {
+		if now.Sub(cached.loadedAt) >= cacheTTL {
+			delete(u.cache, hash)
+		}
+	}
+	for id, at := range u.lastUsed {
+		if now.Sub(at) >= lastUsedInterval {
+			delete(u.lastUsed, id)
+		}
+	}
+}
+
+// isUnknown must be called with mu locked, generations are swapped instead of swept
+func (u *apiKeysUsecase) isUnknown(hash string, now time.Time) bool {
+	if elapsed := now.Sub(u.unknownAt); elapsed >= unknownTTL {
+		u.unknownPrev = u.unknown
+		if elapsed >= 2*unknownTTL {
+			u.unknownPrev = make(map[string]struct{})
+		}
+		u.unknown = make(map[string]struct{})
+		u.unknownAt = now
+	}
+
+	_, ok := u.unknown[hash]
+	if !ok {
+		_, ok = u.unknownPrev[hash]
+	}
+	return ok
+}
+
+// known removes hash of new key from unknown hashes
+func (u *apiKeysUsecase) known(key string) {
+	hash := auth.HashToken(key)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	delete(u.unknown, hash)
+	delete(u.unknownPrev, hash)
+}
+
+// forget removes key from cache, so revoke and rotate apply at once on this instance
+func (u *apiKeysUsecase) forget(id string) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for hash, cached := range u.cache {
+		if cached.key.Id == id {
+			delete(u.cache, hash)
+		}
+	}
+}
+
+func (u *apiKeysUsecase) FindApiKeys() ([]*apikeys.ApiKey, error) {
+	result, err := u.repo.FindApiKeys()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (u *apiKeysUsecase) FindOneApiKey(id string) (*apikeys.ApiKey, error) {
+	key, err := u.repo.FindOneApiKey(id)
+	if err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (u *apiKeysUsecase) InsertApiKey(req *apikeys.ApiKey) error {
+	if err := validate(req); err != nil {
+		return err
+	}
+	if err := req.NewKey(); err != nil {
+		return err
+	}
+
+	if err := u.repo.InsertApiKey(req); err != nil {
+		return err
+	}
+	u.known(req.Key)
+	return nil
+}
+
+// RotateApiKey keeps name, owner and restrictions of key, only the secret changes
+func (u *apiKeysUsecase) RotateApiKey(id string) (*apikeys.ApiKey, error) {
+	key, err := u.repo.FindOneApiKey(id)
+	if err != nil {
+		return nil, err
+	}
+	if key.RevokedAt != nil {
+		return nil, fmt.Errorf("api key has been revoked")
+	}
+
+	if err := key.NewKey(); err != nil {
+		return nil, err
+	}
+	if err := u.repo.RotateApiKey(key); err != nil {
+		return nil, err
+	}
+	u.forget(key.Id)
+	u.known(key.Key)
+	return key, nil
+}
+
+func (u *apiKeysUsecase) RevokeApiKey(id string) error {
+	if err := u.repo.RevokeApiKey(id); err != nil {
+		return err
+	}
+	u.forget(id)
+	return nil
+}
+
+// validate normalizes request, lists are never nil so they are stored as []
+func validate(req *apikeys.ApiKey) error {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if req.OwnerId == "" {
+		return fmt.Errorf("owner_id is required")
+	}
+
+	if len(req.Scopes) == 0 {
+		return fmt.Errorf("scopes are required")
+	}
+	scopes := make([]string, 0, len(req.Scopes))
+	for _, s := range req.Scopes {
+		s = strings.TrimSpace(s)
+		if !contains(apikeys.Scopes, s) {
+			return fmt.Errorf("scope %s is not one of %v", s, apikeys.Scopes)
+		}
+		if !contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	req.Scopes = scopes
+
+	origins := make([]string, 0, len(req.AllowedOrigins))
+	for _, o := range req.AllowedOrigins {
+		o = apikeys.NormalizeOrigin(o)
+		u, err := url.Parse(o)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+			return fmt.Errorf("allowed origin %s is invalid", o)
+		}
+		origins = append(origins, o)
+	}
+	req.AllowedOrigins = origins
+
+	ips := make([]string, 0, len(req.AllowedIps))
+	for _, ip := range req.AllowedIps {
+		prefix, err := apikeys.ParseIp(strings.TrimSpace(ip))
+		if err != nil {
+			return fmt.Errorf("allowed ip %s is invalid", ip)
+		}
+		if prefix.IsSingleIP() {
+			ips = append(ips, prefix.Addr().String())
+		} else {
+			ips = append(ips, prefix.String())
+		}
+	}
+	req.AllowedIps = ips
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return fmt.Errorf("expires_at must be in the future")
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
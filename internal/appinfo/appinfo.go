@@ -8,3 +8,8 @@ type Category struct {
 	Id    int    `db:"id" json:"id"`
 	Title string `db:"title" json:"title"`
 }
+
+type Warehouse struct {
+	Id    int    `db:"id" json:"id"`
+	Title string `db:"title" json:"title"`
+}
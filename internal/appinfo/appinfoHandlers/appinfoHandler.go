@@ -8,24 +8,25 @@ import (
 	"github.com/codepnw/go-ecommerce/internal/appinfo"
 	"github.com/codepnw/go-ecommerce/internal/appinfo/appinfoUsecases"
 	"github.com/codepnw/go-ecommerce/internal/entities"
-	"github.com/codepnw/go-ecommerce/pkg/auth"
 	"github.com/gofiber/fiber/v2"
 )
 
 type appinfoErrCode string
 
 const (
-	generateApiKeyErrCode appinfoErrCode = "appinfo-001"
-	findCategoryErrCode   appinfoErrCode = "appinfo-002"
-	insertCategoryErrCode appinfoErrCode = "appinfo-003"
-	deleteCategoryErrCode appinfoErrCode = "appinfo-004"
+	findCategoryErrCode    appinfoErrCode = "appinfo-002"
+	insertCategoryErrCode  appinfoErrCode = "appinfo-003"
+	deleteCategoryErrCode  appinfoErrCode = "appinfo-004"
+	findWarehouseErrCode   appinfoErrCode = "appinfo-005"
+	insertWarehouseErrCode appinfoErrCode = "appinfo-006"
 )
 
 type IAppinfoHandler interface {
-	GenerateApiKey(c *fiber.Ctx) error
 	FindCategory(c *fiber.Ctx) error
 	InsertCategory(c *fiber.Ctx) error
 	DeleteCategory(c *fiber.Ctx) error
+	FindWarehouse(c *fiber.Ctx) error
+	InsertWarehouse(c *fiber.Ctx) error
 }
 
 type appinfoHandler struct {
@@ -40,30 +41,6 @@ func AppinfoHandler(cfg config.Config, usecase appinfoUsecases.IAppinfoUsecase)
 	}
 }
 
-func (h *appinfoHandler) GenerateApiKey(c *fiber.Ctx) error {
-	apiKey, err := auth.NewAuth(
-		auth.ApiKey,
-		h.cfg.Jwt(),
-		nil,
-	)
-	if err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrInternalServerError.Code,
-			string(generateApiKeyErrCode),
-			err.Error(),
-		).Res()
-	}
-
-	return entities.NewResponse(c).Success(
-		fiber.StatusOK,
-		&struct {
-			Key string `json:"key"`
-		}{
-			Key: apiKey.SignToken(),
-		},
-	).Res()
-}
-
 func (h *appinfoHandler) FindCategory(c *fiber.Ctx) error {
 	req := new(appinfo.CategoryFilter)
 	if err := c.QueryParser(req); err != nil {
@@ -151,3 +128,45 @@ func (h *appinfoHandler) DeleteCategory(c *fiber.Ctx) error {
 		},
 	).Res()
 }
+
+func (h *appinfoHandler) FindWarehouse(c *fiber.Ctx) error {
+	warehouses, err := h.usecase.FindWarehouse()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findWarehouseErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, warehouses).Res()
+}
+
+func (h *appinfoHandler) InsertWarehouse(c *fiber.Ctx) error {
+	req := new(appinfo.Warehouse)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertWarehouseErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if req.Title == "" {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertWarehouseErrCode),
+			"title is required",
+		).Res()
+	}
+
+	if err := h.usecase.InsertWarehouse(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(insertWarehouseErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, req).Res()
+}
@@ -14,6 +14,8 @@ type IAppinfoRepository interface {
 	FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error)
 	InsertCategory(req []*appinfo.Category) error
 	DeleteCategory(id int) error
+	FindWarehouse() ([]*appinfo.Warehouse, error)
+	InsertWarehouse(req *appinfo.Warehouse) error
 }
 
 type appinfoRepository struct {
@@ -121,3 +123,53 @@ func (r *appinfoRepository) DeleteCategory(id int) error {
 	}
 	return nil
 }
+
+func (r *appinfoRepository) FindWarehouse() ([]*appinfo.Warehouse, error) {
+	query := `
+		SELECT
+			"id",
+			"title"
+		FROM "warehouses"
+		ORDER BY "id" ASC;
+	`
+
+	warehouses := make([]*appinfo.Warehouse, 0)
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query warehouse failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var warehouse appinfo.Warehouse
+		if err := rows.Scan(&warehouse.Id, &warehouse.Title); err != nil {
+			return nil, fmt.Errorf("scan warehouses failed: %v", err)
+		}
+		warehouses = append(warehouses, &warehouse)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return warehouses, nil
+}
+
+func (r *appinfoRepository) InsertWarehouse(req *appinfo.Warehouse) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "warehouses" (
+			"title"
+		)
+		VALUES ($1)
+		RETURNING "id";
+	`
+
+	if err := r.db.QueryRowContext(ctx, query, req.Title).Scan(&req.Id); err != nil {
+		return fmt.Errorf("insert warehouse failed: %v", err)
+	}
+	return nil
+}
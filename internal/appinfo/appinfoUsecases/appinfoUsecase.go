@@ -9,6 +9,8 @@ type IAppinfoUsecase interface {
 	FindCategory(req *appinfo.CategoryFilter) ([]*appinfo.Category, error)
 	InsertCategory(req []*appinfo.Category) error
 	DeleteCategory(id int) error
+	FindWarehouse() ([]*appinfo.Warehouse, error)
+	InsertWarehouse(req *appinfo.Warehouse) error
 }
 
 type appinfoUsecase struct {
@@ -40,3 +42,18 @@ func (u *appinfoUsecase) DeleteCategory(id int) error {
 	}
 	return nil
 }
+
+func (u *appinfoUsecase) FindWarehouse() ([]*appinfo.Warehouse, error) {
+	warehouses, err := u.repo.FindWarehouse()
+	if err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+func (u *appinfoUsecase) InsertWarehouse(req *appinfo.Warehouse) error {
+	if err := u.repo.InsertWarehouse(req); err != nil {
+		return err
+	}
+	return nil
+}
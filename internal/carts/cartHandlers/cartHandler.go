@@ -0,0 +1,226 @@
+package cartHandlers
+
+import (
+	"strings"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/carts"
+	"github.com/codepnw/go-ecommerce/internal/carts/cartUsecases"
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/gofiber/fiber/v2"
+)
+
+type cartHandlersErrCode string
+
+const (
+	findOneCartErrCode cartHandlersErrCode = "carts-001"
+	insertItemErrCode  cartHandlersErrCode = "carts-002"
+	updateItemErrCode  cartHandlersErrCode = "carts-003"
+	deleteItemErrCode  cartHandlersErrCode = "carts-004"
+	clearCartErrCode   cartHandlersErrCode = "carts-005"
+	checkoutErrCode    cartHandlersErrCode = "carts-006"
+	outOfStockErrCode  cartHandlersErrCode = "carts-007"
+)
+
+type ICartHandler interface {
+	FindOneCart(c *fiber.Ctx) error
+	InsertItem(c *fiber.Ctx) error
+	UpdateItem(c *fiber.Ctx) error
+	DeleteItem(c *fiber.Ctx) error
+	ClearCart(c *fiber.Ctx) error
+	Checkout(c *fiber.Ctx) error
+}
+
+type cartHandler struct {
+	cfg     config.Config
+	usecase cartUsecases.ICartUsecase
+}
+
+func CartHandler(cfg config.Config, usecase cartUsecases.ICartUsecase) ICartHandler {
+	return &cartHandler{
+		cfg:     cfg,
+		usecase: usecase,
+	}
+}
+
+func (h *cartHandler) FindOneCart(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	cart, err := h.usecase.FindOneCart(userId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findOneCartErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, cart).Res()
+}
+
+func (h *cartHandler) InsertItem(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(carts.CartItemReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertItemErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if req.ProductId == "" {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertItemErrCode),
+			"product_id is required",
+		).Res()
+	}
+
+	if req.Qty < 1 {
+		req.Qty = 1
+	}
+
+	cart, err := h.usecase.InsertItem(userId, req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(insertItemErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, cart).Res()
+}
+
+func (h *cartHandler) UpdateItem(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(carts.CartItemReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateItemErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	req.ProductId = strings.Trim(c.Params("product_id"), " ")
+
+	if req.Qty < 1 {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateItemErrCode),
+			"qty must more than zero",
+		).Res()
+	}
+
+	cart, err := h.usecase.UpdateItem(userId, req)
+	if err != nil {
+		switch err.Error() {
+		case "cart item not found":
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(updateItemErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(updateItemErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, cart).Res()
+}
+
+func (h *cartHandler) DeleteItem(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	productId := strings.Trim(c.Params("product_id"), " ")
+
+	cart, err := h.usecase.DeleteItem(userId, productId)
+	if err != nil {
+		switch err.Error() {
+		case "cart item not found":
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(deleteItemErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(deleteItemErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, cart).Res()
+}
+
+func (h *cartHandler) ClearCart(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	if err := h.usecase.ClearCart(userId); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(clearCartErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *cartHandler) Checkout(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(carts.CheckoutReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(checkoutErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if req.Address == "" || req.Contact == "" {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(checkoutErrCode),
+			"address and contact are required",
+		).Res()
+	}
+
+	order, err := h.usecase.Checkout(userId, req)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "insufficient stock") {
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(outOfStockErrCode),
+				err.Error(),
+			).Res()
+		}
+
+		switch err.Error() {
+		case "cart is empty":
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(checkoutErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(checkoutErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, order).Res()
+}
@@ -0,0 +1,177 @@
+package cartRepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/carts"
+)
+
+type ICartRepository interface {
+	InitCart(userId string) (string, error)
+	FindOneCart(userId string) (*carts.Cart, error)
+	InsertItem(cartId string, req *carts.CartItemReq) error
+	UpdateItem(cartId string, req *carts.CartItemReq) error
+	DeleteItem(cartId, productId string) error
+	ClearCart(cartId string) error
+}
+
+type cartRepository struct {
+	db *sql.DB
+}
+
+func CartRepository(db *sql.DB) ICartRepository {
+	return &cartRepository{db: db}
+}
+
+func (r *cartRepository) InitCart(userId string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "carts" (
+			"user_id"
+		)
+		VALUES ($1)
+		ON CONFLICT ("user_id") DO UPDATE SET
+			"updated_at" = now()
+		RETURNING "id";
+	`
+
+	var cartId string
+	if err := r.db.QueryRowContext(ctx, query, userId).Scan(&cartId); err != nil {
+		return "", fmt.Errorf("init cart failed: %v", err)
+	}
+
+	return cartId, nil
+}
+
+func (r *cartRepository) FindOneCart(userId string) (*carts.Cart, error) {
+	query := `
+		SELECT
+			to_jsonb("t")
+		FROM (
+			SELECT
+				"c"."id",
+				"c"."user_id",
+				(
+					SELECT
+						COALESCE(array_to_json(array_agg("it")), '[]'::json)
+					FROM (
+						SELECT
+							"ci"."id",
+							"ci"."qty",
+							json_build_object(
+								'id', "p"."id",
+								'title', "p"."title",
+								'description', "p"."description",
+								'price', "p"."price"
+							) AS "product"
+						FROM "carts_items" "ci"
+						LEFT JOIN "products" "p" ON "p"."id" = "ci"."product_id"
+						WHERE "ci"."cart_id" = "c"."id"
+						ORDER BY "ci"."created_at" ASC
+					) AS "it"
+				) AS "items",
+				(
+					SELECT
+						COALESCE(SUM("p"."price" * "ci"."qty"), 0)
+					FROM "carts_items" "ci"
+					LEFT JOIN "products" "p" ON "p"."id" = "ci"."product_id"
+					WHERE "ci"."cart_id" = "c"."id"
+				) AS "total_paid",
+				"c"."created_at",
+				"c"."updated_at"
+			FROM "carts" "c"
+			WHERE "c"."user_id" = $1
+		) AS "t";
+	`
+
+	cart := &carts.Cart{
+		Items: make([]*carts.CartItem, 0),
+	}
+
+	raw := make([]byte, 0)
+	if err := r.db.QueryRow(query, userId).Scan(&raw); err != nil {
+		return nil, fmt.Errorf("get cart failed: %v", err)
+	}
+
+	if err := json.Unmarshal(raw, &cart); err != nil {
+		return nil, fmt.Errorf("unmarshal cart failed: %v", err)
+	}
+
+	return cart, nil
+}
+
+func (r *cartRepository) InsertItem(cartId string, req *carts.CartItemReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "carts_items" (
+			"cart_id",
+			"product_id",
+			"qty"
+		)
+		VALUES ($1, $2, $3)
+		ON CONFLICT ("cart_id", "product_id") DO UPDATE SET
+			"qty" = "carts_items"."qty" + EXCLUDED."qty";
+	`
+
+	if _, err := r.db.ExecContext(ctx, query, cartId, req.ProductId, req.Qty); err != nil {
+		return fmt.Errorf("insert cart item failed: %v", err)
+	}
+
+	return nil
+}
+
+func (r *cartRepository) UpdateItem(cartId string, req *carts.CartItemReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "carts_items" SET
+			"qty" = $1
+		WHERE "cart_id" = $2
+		AND "product_id" = $3;
+	`
+
+	result, err := r.db.ExecContext(ctx, query, req.Qty, cartId, req.ProductId)
+	if err != nil {
+		return fmt.Errorf("update cart item failed: %v", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("cart item not found")
+	}
+
+	return nil
+}
+
+func (r *cartRepository) DeleteItem(cartId, productId string) error {
+	query := `DELETE FROM "carts_items" WHERE "cart_id" = $1 AND "product_id" = $2;`
+
+	result, err := r.db.ExecContext(context.Background(), query, cartId, productId)
+	if err != nil {
+		return fmt.Errorf("delete cart item failed: %v", err)
+	}
+
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("cart item not found")
+	}
+
+	return nil
+}
+
+func (r *cartRepository) ClearCart(cartId string) error {
+	query := `DELETE FROM "carts_items" WHERE "cart_id" = $1;`
+
+	if _, err := r.db.ExecContext(context.Background(), query, cartId); err != nil {
+		return fmt.Errorf("clear cart failed: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package cartUsecases
+
+import (
+	"fmt"
+
+	"github.com/codepnw/go-ecommerce/internal/carts"
+	"github.com/codepnw/go-ecommerce/internal/carts/cartRepositories"
+	"github.com/codepnw/go-ecommerce/internal/orders"
+	"github.com/codepnw/go-ecommerce/internal/orders/orderUsecases"
+	"github.com/codepnw/go-ecommerce/internal/products"
+	"github.com/codepnw/go-ecommerce/internal/products/productRepositories"
+)
+
+type ICartUsecase interface {
+	FindOneCart(userId string) (*carts.Cart, error)
+	InsertItem(userId string, req *carts.CartItemReq) (*carts.Cart, error)
+	UpdateItem(userId string, req *carts.CartItemReq) (*carts.Cart, error)
+	DeleteItem(userId, productId string) (*carts.Cart, error)
+	ClearCart(userId string) error
+	Checkout(userId string, req *carts.CheckoutReq) (*orders.Order, error)
+}
+
+type cartUsecase struct {
+	cartRepo     cartRepositories.ICartRepository
+	productRepo  productRepositories.IProductRepository
+	orderUsecase orderUsecases.IOrderUsecase
+}
+
+func CartUsecase(cartRepo cartRepositories.ICartRepository, productRepo productRepositories.IProductRepository, orderUsecase orderUsecases.IOrderUsecase) ICartUsecase {
+	return &cartUsecase{
+		cartRepo:     cartRepo,
+		productRepo:  productRepo,
+		orderUsecase: orderUsecase,
+	}
+}
+
+func (u *cartUsecase) FindOneCart(userId string) (*carts.Cart, error) {
+	if _, err := u.cartRepo.InitCart(userId); err != nil {
+		return nil, err
+	}
+
+	cart, err := u.cartRepo.FindOneCart(userId)
+	if err != nil {
+		return nil, err
+	}
+	return cart, nil
+}
+
+func (u *cartUsecase) InsertItem(userId string, req *carts.CartItemReq) (*carts.Cart, error) {
+	// Check product is exists
+	if _, err := u.productRepo.FindOneProduct(req.ProductId); err != nil {
+		return nil, err
+	}
+
+	cartId, err := u.cartRepo.InitCart(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.cartRepo.InsertItem(cartId, req); err != nil {
+		return nil, err
+	}
+
+	return u.cartRepo.FindOneCart(userId)
+}
+
+func (u *cartUsecase) UpdateItem(userId string, req *carts.CartItemReq) (*carts.Cart, error) {
+	cartId, err := u.cartRepo.InitCart(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.cartRepo.UpdateItem(cartId, req); err != nil {
+		return nil, err
+	}
+
+	return u.cartRepo.FindOneCart(userId)
+}
+
+func (u *cartUsecase) DeleteItem(userId, productId string) (*carts.Cart, error) {
+	cartId, err := u.cartRepo.InitCart(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := u.cartRepo.DeleteItem(cartId, productId); err != nil {
+		return nil, err
+	}
+
+	return u.cartRepo.FindOneCart(userId)
+}
+
+func (u *cartUsecase) ClearCart(userId string) error {
+	cartId, err := u.cartRepo.InitCart(userId)
+	if err != nil {
+		return err
+	}
+
+	if err := u.cartRepo.ClearCart(cartId); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (u *cartUsecase) Checkout(userId string, req *carts.CheckoutReq) (*orders.Order, error) {
+	cart, err := u.FindOneCart(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cart.Items) == 0 {
+		return nil, fmt.Errorf("cart is empty")
+	}
+
+	order := &orders.Order{
+		UserId:   userId,
+		CartId:   cart.Id,
+		Address:  req.Address,
+		Contact:  req.Contact,
+		Status:   orders.StatusWaiting,
+		Products: make([]*orders.ProductsOrder, 0),
+	}
+
+	for _, item := range cart.Items {
+		order.Products = append(order.Products, &orders.ProductsOrder{
+			Qty: item.Qty,
+			Product: &products.Product{
+				Id: item.Product.Id,
+			},
+		})
+	}
+
+	// Insert order and clear cart in the same transaction
+	result, err := u.orderUsecase.InsertOrder(order)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
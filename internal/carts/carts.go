@@ -0,0 +1,28 @@
+package carts
+
+import "github.com/codepnw/go-ecommerce/internal/products"
+
+type Cart struct {
+	Id        string      `db:"id" json:"id"`
+	UserId    string      `db:"user_id" json:"user_id"`
+	Items     []*CartItem `json:"items"`
+	TotalPaid float64     `json:"total_paid"`
+	CreatedAt string      `db:"created_at" json:"created_at"`
+	UpdatedAt string      `db:"updated_at" json:"updated_at"`
+}
+
+type CartItem struct {
+	Id      string            `db:"id" json:"id"`
+	Qty     int               `db:"qty" json:"qty"`
+	Product *products.Product `db:"product" json:"product"`
+}
+
+type CartItemReq struct {
+	ProductId string `json:"product_id" form:"product_id"`
+	Qty       int    `json:"qty" form:"qty"`
+}
+
+type CheckoutReq struct {
+	Address string `json:"address" form:"address"`
+	Contact string `json:"contact" form:"contact"`
+}
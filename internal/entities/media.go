@@ -1,7 +1,71 @@
 package entities
 
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
 type Image struct {
-	Id       string `db:"id" json:"id"`
-	FileName string `db:"filename" json:"filename"`
-	Url      string `db:"url" json:"url"`
+	Id       string                   `db:"id" json:"id"`
+	FileName string                   `db:"filename" json:"filename"`
+	Url      string                   `db:"url" json:"url"`
+	Variants map[string]*ImageVariant `db:"variants" json:"variants"`
+}
+
+// ImageVariant is a resized or converted copy of an image,
+// keys are variant name e.g. thumbnail, thumbnail_webp, original
+type ImageVariant struct {
+	FileName string `json:"filename"`
+	Url      string `json:"url"`
+	Format   string `json:"format"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+}
+
+// FileNames returns filename of image and all variants
+func (i *Image) FileNames() []string {
+	names := []string{i.FileName}
+	for _, v := range i.Variants {
+		if v.FileName != "" && v.FileName != i.FileName {
+			names = append(names, v.FileName)
+		}
+	}
+	return names
+}
+
+// Validate checks image sent by client, variant keys must be one of names or
+// name_webp and file names must stay in folder of the image
+func (i *Image) Validate(names []string) error {
+	if !isFileName(i.FileName) {
+		return fmt.Errorf("filename %q is invalid", i.FileName)
+	}
+
+	for key, v := range i.Variants {
+		if v == nil || !validVariant(key, names) {
+			return fmt.Errorf("variant %q is invalid", key)
+		}
+		if !isFileName(v.FileName) {
+			return fmt.Errorf("filename %q of variant %s is invalid", v.FileName, key)
+		}
+		switch v.Format {
+		case "jpeg", "png", "webp":
+		default:
+			return fmt.Errorf("format %q of variant %s is invalid", v.Format, key)
+		}
+	}
+	return nil
+}
+
+func validVariant(key string, names []string) bool {
+	for _, name := range names {
+		if key == name || key == name+"_webp" {
+			return true
+		}
+	}
+	return false
+}
+
+func isFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && path.Base(name) == name && !strings.Contains(name, "\\")
 }
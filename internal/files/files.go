@@ -1,19 +1,28 @@
 package files
 
-import "mime/multipart"
+import (
+	"mime/multipart"
+
+	"github.com/codepnw/go-ecommerce/internal/entities"
+)
 
 type FileReq struct {
-	File        *multipart.FileHeader `form:"file"`
-	Destination string                `form:"destination"`
-	Extension   string
-	FileName    string
+	File         *multipart.FileHeader `form:"file"`
+	Destination  string                `form:"destination"`
+	Extension    string
+	FileName     string
+	WithVariants bool // resize into configured image variants
 }
 
 type FileRes struct {
-	FileName string `json:"filename"`
-	Url      string `json:"url"`
+	FileName string                            `json:"filename"`
+	Url      string                            `json:"url"`
+	Variants map[string]*entities.ImageVariant `json:"variants,omitempty"`
 }
 
 type DeleteFileReq struct {
 	Destination string `json:"destination"`
 }
+
+// OwnerFunc returns user id owning object key of private destination
+type OwnerFunc func(key string) (string, error)
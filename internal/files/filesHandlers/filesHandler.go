@@ -2,14 +2,22 @@ package filesHandlers
 
 import (
 	"fmt"
+	"io"
 	"math"
+	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
 	"github.com/codepnw/go-ecommerce/internal/entities"
 	"github.com/codepnw/go-ecommerce/internal/files"
 	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/pkg/imaging"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
 	"github.com/codepnw/go-ecommerce/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 )
@@ -19,11 +27,16 @@ type filesHandlersErrCode string
 const (
 	uploadErr filesHandlersErrCode = "files-001"
 	deleteErr filesHandlersErrCode = "files-002"
+	serveErr  filesHandlersErrCode = "files-003"
+	ownerErr  filesHandlersErrCode = "files-004"
 )
 
 type IFilesHandler interface {
 	UploadFiles(c *fiber.Ctx) error
 	DeleteFile(c *fiber.Ctx) error
+	ServeFile(c *fiber.Ctx) error
+	PrivateCheck(auth fiber.Handler) fiber.Handler
+	OwnerCheck(owner files.OwnerFunc, permission string) fiber.Handler
 }
 
 type filesHandler struct {
@@ -57,9 +70,10 @@ func (h *filesHandler) UploadFiles(c *fiber.Ctx) error {
 		"png":  "png",
 		"jpg":  "jpg",
 		"jpeg": "jpeg",
+		"webp": "webp",
 	}
 	for _, file := range filesReq {
-		ext := strings.TrimPrefix(filepath.Ext(file.Filename), ".")
+		ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Filename), "."))
 		if extMap[ext] != ext || extMap[ext] == "" {
 			return entities.NewResponse(c).Error(
 				fiber.ErrBadRequest.Code,
@@ -76,12 +90,24 @@ func (h *filesHandler) UploadFiles(c *fiber.Ctx) error {
 			).Res()
 		}
 
+		// Content must be a real image, extension is from content
+		format, err := h.usecase.CheckImage(file)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(uploadErr),
+				err.Error(),
+			).Res()
+		}
+		ext = imaging.Extension(format)
+
 		filename := utils.RandFileName(ext)
 		req = append(req, &files.FileReq{
-			File:        file,
-			Destination: destination + "/" + filename,
-			FileName:    filename,
-			Extension:   ext,
+			File:         file,
+			Destination:  "images/" + destination + "/" + filename,
+			FileName:     filename,
+			Extension:    ext,
+			WithVariants: true,
 		})
 	}
 
@@ -117,3 +143,272 @@ func (h *filesHandler) DeleteFile(c *fiber.Ctx) error {
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
 }
+
+// PrivateCheck allows a valid signed url, otherwise falls back to auth
+func (h *filesHandler) PrivateCheck(auth fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, err := fileKey(c)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(serveErr),
+				err.Error(),
+			).Res()
+		}
+
+		expires, err := strconv.ParseInt(c.Query("expires"), 10, 64)
+		if err == nil && h.usecase.VerifySignedUrl(key, expires, c.Query("signature")) {
+			c.Locals("signedUrl", true)
+			return c.Next()
+		}
+		return auth(c)
+	}
+}
+
+// OwnerCheck allows signed url, owner of the object or user with permission.
+// Objects without owner func are allowed by permission only
+func (h *filesHandler) OwnerCheck(owner files.OwnerFunc, permission string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if signed, _ := c.Locals("signedUrl").(bool); signed {
+			return c.Next()
+		}
+		if permissions, _ := c.Locals("userPermissions").(roles.Permissions); permissions.Has(permission) {
+			return c.Next()
+		}
+		if owner == nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(ownerErr),
+				"no permission to access",
+			).Res()
+		}
+
+		key, err := fileKey(c)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(ownerErr),
+				err.Error(),
+			).Res()
+		}
+
+		ownerId, err := owner(key)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(ownerErr),
+				"file not found",
+			).Res()
+		}
+		if userId, _ := c.Locals("userId").(string); userId == "" || userId != ownerId {
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(ownerErr),
+				"no permission to access",
+			).Res()
+		}
+		return c.Next()
+	}
+}
+
+func (h *filesHandler) ServeFile(c *fiber.Ctx) error {
+	key, err := fileKey(c)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(serveErr),
+			err.Error(),
+		).Res()
+	}
+
+	info, err := h.usecase.StatFile(key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(serveErr),
+				"file not found",
+			).Res()
+		}
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(serveErr),
+			err.Error(),
+		).Res()
+	}
+
+	c.Set(fiber.HeaderAcceptRanges, "bytes")
+	c.Set(fiber.HeaderETag, info.ETag)
+	if !info.LastModified.IsZero() {
+		c.Set(fiber.HeaderLastModified, info.LastModified.UTC().Format(http.TimeFormat))
+	}
+	if h.isPrivate(key) {
+		c.Set(fiber.HeaderCacheControl, "private, no-cache")
+	} else {
+		c.Set(fiber.HeaderCacheControl, fmt.Sprintf("public, max-age=%d", h.cfg.Storage().CacheMaxAge()))
+	}
+
+	if notModified(c, info) {
+		return c.SendStatus(fiber.StatusNotModified)
+	}
+
+	c.Set(fiber.HeaderContentType, info.ContentType)
+
+	start, length := int64(0), info.Size
+	rangeHeader := c.Get(fiber.HeaderRange)
+	if rangeHeader != "" && (c.Get(fiber.HeaderIfRange) == "" || c.Get(fiber.HeaderIfRange) == info.ETag) {
+		var ok bool
+		start, length, ok = parseRange(rangeHeader, info.Size)
+		if !ok {
+			c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes */%d", info.Size))
+			return c.SendStatus(fiber.StatusRequestedRangeNotSatisfiable)
+		}
+		c.Status(fiber.StatusPartialContent)
+		c.Set(fiber.HeaderContentRange, fmt.Sprintf("bytes %d-%d/%d", start, start+length-1, info.Size))
+	}
+
+	if c.Method() == fiber.MethodHead {
+		c.Response().Header.SetContentLength(int(length))
+		return nil
+	}
+
+	body, _, err := h.usecase.GetFile(key)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(serveErr),
+			err.Error(),
+		).Res()
+	}
+
+	if start > 0 {
+		if seeker, ok := body.(io.Seeker); ok {
+			_, err = seeker.Seek(start, io.SeekStart)
+		} else {
+			_, err = io.CopyN(io.Discard, body, start)
+		}
+		if err != nil {
+			body.Close()
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(serveErr),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	// Body is closed after the response is sent
+	c.Response().SetBodyStream(&fileStream{
+		Reader: io.LimitReader(body, length),
+		Closer: body,
+	}, int(length))
+	return nil
+}
+
+func (h *filesHandler) isPrivate(key string) bool {
+	for _, dest := range h.cfg.Storage().PrivateDestinations() {
+		if strings.HasPrefix(key, strings.Trim(dest, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+type fileStream struct {
+	io.Reader
+	io.Closer
+}
+
+// fileKey is cleaned object key of request path, it must stay in destination of the route.
+// Path is raw, encoded dot segments and slashes are resolved here before any check uses the key
+func fileKey(c *fiber.Ctx) (string, error) {
+	if key, ok := c.Locals("fileKey").(string); ok {
+		return key, nil
+	}
+
+	key, err := url.PathUnescape(strings.TrimPrefix(c.Path(), "/"))
+	if err != nil || strings.Contains(key, "\\") {
+		return "", fmt.Errorf("file path is invalid")
+	}
+	for _, segment := range strings.Split(key, "/") {
+		if segment == ".." {
+			return "", fmt.Errorf("file path is invalid")
+		}
+	}
+
+	key, err = storage.CleanKey(key)
+	if err != nil {
+		return "", fmt.Errorf("file path is invalid")
+	}
+
+	// Routes are /<destination>/*
+	dest := strings.Trim(strings.TrimSuffix(c.Route().Path, "*"), "/")
+	if dest == "" || !strings.HasPrefix(key, dest+"/") {
+		return "", fmt.Errorf("file path is invalid")
+	}
+
+	c.Locals("fileKey", key)
+	return key, nil
+}
+
+func notModified(c *fiber.Ctx, info *storage.ObjectInfo) bool {
+	if match := c.Get(fiber.HeaderIfNoneMatch); match != "" {
+		for _, etag := range strings.Split(match, ",") {
+			etag = strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+			if etag == "*" || etag == info.ETag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if since := c.Get(fiber.HeaderIfModifiedSince); since != "" && !info.LastModified.IsZero() {
+		t, err := http.ParseTime(since)
+		if err == nil && !info.LastModified.Truncate(time.Second).After(t) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseRange supports a single range: bytes=start-end | bytes=start- | bytes=-suffix
+func parseRange(header string, size int64) (int64, int64, bool) {
+	spec, found := strings.CutPrefix(header, "bytes=")
+	if !found || strings.Contains(spec, ",") {
+		return 0, 0, false
+	}
+
+	startStr, endStr, found := strings.Cut(strings.TrimSpace(spec), "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	if startStr == "" {
+		suffix, err := strconv.ParseInt(endStr, 10, 64)
+		if err != nil || suffix <= 0 {
+			return 0, 0, false
+		}
+		if suffix > size {
+			suffix = size
+		}
+		return size - suffix, suffix, true
+	}
+
+	start, err := strconv.ParseInt(startStr, 10, 64)
+	if err != nil || start < 0 || start >= size {
+		return 0, 0, false
+	}
+
+	end := size - 1
+	if endStr != "" {
+		end, err = strconv.ParseInt(endStr, 10, 64)
+		if err != nil || end < start {
+			return 0, 0, false
+		}
+		if end > size-1 {
+			end = size - 1
+		}
+	}
+
+	return start, end - start + 1, true
+}
@@ -0,0 +1,172 @@
+package filesHandlers
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
+	"github.com/gofiber/fiber/v2"
+)
+
+// testConfig is config of tests, only storage destinations are read by handler
+type testConfig struct {
+	config.Config
+}
+
+func (c *testConfig) Storage() config.StorageConfig { return &testStorageConfig{} }
+
+type testStorageConfig struct {
+	config.StorageConfig
+}
+
+func (c *testStorageConfig) PublicDestinations() []string  { return []string{"images"} }
+func (c *testStorageConfig) PrivateDestinations() []string { return []string{"slips"} }
+func (c *testStorageConfig) CacheMaxAge() int              { return 60 }
+
+// testUsecase serves objects from memory and records keys it was asked for
+type testUsecase struct {
+	filesUsecases.IFilesUsecase
+	objects map[string]string
+	keys    []string
+}
+
+func (u *testUsecase) StatFile(key string) (*storage.ObjectInfo, error) {
+	u.keys = append(u.keys, key)
+	body, ok := u.objects[key]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &storage.ObjectInfo{Key: key, Size: int64(len(body)), ContentType: "image/png", ETag: `"etag"`}, nil
+}
+
+func (u *testUsecase) GetFile(key string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	info, err := u.StatFile(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return io.NopCloser(strings.NewReader(u.objects[key])), info, nil
+}
+
+func (u *testUsecase) VerifySignedUrl(key string, expires int64, signature string) bool {
+	return signature == "signed:"+key
+}
+
+// newTestApp has routes of AssetModule, X-User header signs in and slips are owned by order
+func newTestApp() (*fiber.App, *testUsecase) {
+	usecase := &testUsecase{objects: map[string]string{
+		"images/a.png":     "image",
+		"images/sub/b.png": "nested image",
+		"slips/o1/a.png":   "slip of u1",
+		"slips/o2/b.png":   "slip of u2",
+	}}
+	handler := FilesHandler(&testConfig{}, usecase)
+
+	jwtAuth := func(c *fiber.Ctx) error {
+		userId := c.Get("X-User")
+		if userId == "" {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+		c.Locals("userId", userId)
+		c.Locals("userPermissions", roles.Permissions{})
+		return c.Next()
+	}
+	owner := func(key string) (string, error) {
+		owners := map[string]string{"o1": "u1", "o2": "u2"}
+		parts := strings.SplitN(key, "/", 3)
+		if len(parts) != 3 || owners[parts[1]] == "" {
+			return "", fmt.Errorf("file not found")
+		}
+		return owners[parts[1]], nil
+	}
+
+	app := fiber.New()
+	app.Get("/images/*", handler.ServeFile)
+	app.Get("/slips/*", handler.PrivateCheck(jwtAuth), handler.OwnerCheck(owner, roles.PermOrdersReadAny), handler.ServeFile)
+	return app, usecase
+}
+
+func TestServeFile(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		user   string
+		status int
+		body   string
+	}{
+		{"public", "/images/a.png", "", fiber.StatusOK, "image"},
+		{"encoded slash", "/images/sub%2fb.png", "", fiber.StatusOK, "nested image"},
+		{"missing", "/images/c.png", "", fiber.StatusNotFound, ""},
+		{"owner", "/slips/o1/a.png", "u1", fiber.StatusOK, "slip of u1"},
+		{"other user", "/slips/o1/a.png", "u2", fiber.StatusUnauthorized, ""},
+		{"signed url", "/slips/o1/a.png?expires=9999999999&signature=signed:slips/o1/a.png", "", fiber.StatusOK, "slip of u1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, _ := newTestApp()
+			req := httptest.NewRequest(fiber.MethodGet, tt.target, nil)
+			if tt.user != "" {
+				req.Header.Set("X-User", tt.user)
+			}
+
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != tt.status {
+				t.Fatalf("status = %d, want %d: %s", res.StatusCode, tt.status, body)
+			}
+			if tt.body != "" && string(body) != tt.body {
+				t.Errorf("body = %q, want %q", body, tt.body)
+			}
+		})
+	}
+}
+
+func TestServeFileTraversal(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		user   string
+	}{
+		{"dot segments", "/images/../slips/o1/a.png", ""},
+		{"encoded slash", "/images/..%2fslips/o1/a.png", ""},
+		{"encoded dots", "/images/%2e%2e/slips/o1/a.png", ""},
+		{"encoded dots and slash", "/images/%2e%2e%2fslips%2fo1%2fa.png", ""},
+		{"upper case encoding", "/images/%2E%2E%2Fslips/o1/a.png", ""},
+		{"backslash", "/images/..%5cslips/o1/a.png", ""},
+		{"other order by own order", "/slips/o2/..%2f..%2fslips/o1/a.png", "u2"},
+		{"other order by encoded dots", "/slips/o2/%2e%2e/o1/a.png", "u2"},
+		{"destination only", "/images/", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app, usecase := newTestApp()
+			req := httptest.NewRequest(fiber.MethodGet, tt.target, nil)
+			if tt.user != "" {
+				req.Header.Set("X-User", tt.user)
+			}
+
+			res, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := io.ReadAll(res.Body)
+			if res.StatusCode != fiber.StatusBadRequest {
+				t.Errorf("status = %d, want %d: %s", res.StatusCode, fiber.StatusBadRequest, body)
+			}
+			if len(usecase.keys) > 0 {
+				t.Errorf("storage is read with keys %v", usecase.keys)
+			}
+			if strings.Contains(res.Header.Get(fiber.HeaderCacheControl), "public") {
+				t.Errorf("response is cached publicly")
+			}
+		})
+	}
+}
@@ -1,28 +1,41 @@
 package filesUsecases
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"os"
+	"mime/multipart"
+	"path"
 	"strings"
 	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/entities"
 	"github.com/codepnw/go-ecommerce/internal/files"
+	"github.com/codepnw/go-ecommerce/pkg/imaging"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
 )
 
 type IFilesUsecase interface {
+	CheckImage(file *multipart.FileHeader) (string, error)
 	UploadToStorage(req []*files.FileReq) ([]*files.FileRes, error)
 	DeleteFileOnStorage(req []*files.DeleteFileReq) error
+	GetFile(key string) (io.ReadCloser, *storage.ObjectInfo, error)
+	StatFile(key string) (*storage.ObjectInfo, error)
+	VerifySignedUrl(key string, expires int64, signature string) bool
 }
 
 type filesUsecase struct {
-	cfg config.Config
+	cfg     config.Config
+	storage storage.Storage
 }
 
-func FilesUsecase(cfg config.Config) IFilesUsecase {
-	return &filesUsecase{cfg: cfg}
+func FilesUsecase(cfg config.Config, storage storage.Storage) IFilesUsecase {
+	return &filesUsecase{
+		cfg:     cfg,
+		storage: storage,
+	}
 }
 
 type filesPub struct {
@@ -30,6 +43,27 @@ type filesPub struct {
 	file        *files.FileRes
 }
 
+// CheckImage returns image format detected from content of file
+func (u *filesUsecase) CheckImage(file *multipart.FileHeader) (string, error) {
+	f, err := file.Open()
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", imaging.ErrUnsupportedFormat
+	}
+
+	format := imaging.DetectFormat(head[:n])
+	if format == "" {
+		return "", imaging.ErrUnsupportedFormat
+	}
+	return format, nil
+}
+
 func (u *filesUsecase) uploadToStorageWorker(ctx context.Context, jobs <-chan *files.FileReq, results chan<- *files.FileRes, errs chan<- error) {
 	for job := range jobs {
 		cotainer, err := job.File.Open()
@@ -38,33 +72,85 @@ func (u *filesUsecase) uploadToStorageWorker(ctx context.Context, jobs <-chan *f
 			return
 		}
 
-		b, err := io.ReadAll(cotainer)
+		data, err := io.ReadAll(cotainer)
+		cotainer.Close()
 		if err != nil {
 			errs <- err
 			return
 		}
 
-		// Upload an object to storage
-		dest := fmt.Sprintf("./assets/images/%s", job.Destination)
-		if err := os.WriteFile(dest, b, 0777); err != nil {
-			if err := os.MkdirAll("./assets/images/"+strings.Replace(job.Destination, job.FileName, "", 1), 0777); err != nil {
-				errs <- fmt.Errorf("mkdir \"./assets/images/%s\" failed: %v", err, job.Destination)
-				return
-			}
-			if err := os.WriteFile(dest, b, 0777); err != nil {
-				errs <- fmt.Errorf("write file failed: %v", err)
-				return
-			}
+		// Decode then encode again, exif and other metadata are stripped
+		img, format, err := imaging.Decode(data, u.cfg.Image().MaxPixels())
+		if err != nil {
+			errs <- fmt.Errorf("upload file %s failed: %v", job.FileName, err)
+			return
 		}
 
+		variants := []config.ImageVariant{{Name: "original"}}
+		if job.WithVariants {
+			variants = u.cfg.Image().Variants()
+		}
+
+		dir := path.Dir(job.Destination)
+		base := strings.TrimSuffix(path.Base(job.Destination), path.Ext(job.Destination))
+
 		newFile := &filesPub{
 			file: &files.FileRes{
 				FileName: job.FileName,
-				Url:      fmt.Sprintf("http://%s:%d/%s", u.cfg.App().Host(), u.cfg.App().Port(), job.Destination),
+				Url:      u.storage.Url(job.Destination),
+				Variants: make(map[string]*entities.ImageVariant),
 			},
 			destination: job.Destination,
 		}
 
+		for _, v := range variants {
+			resized := imaging.Resize(img, v.Width)
+
+			// Images too large for webp are kept in original format only
+			formats := []string{format}
+			if u.cfg.Image().Webp() && format != imaging.FormatWebp && imaging.CanEncodeWebp(resized) {
+				formats = append(formats, imaging.FormatWebp)
+			}
+
+			for _, f := range formats {
+				// Original keeps destination name, e.g. x.jpg x_thumbnail.jpg x_thumbnail.webp
+				name := fmt.Sprintf("%s_%s.%s", base, v.Name, imaging.Extension(f))
+				if v.Name == "original" {
+					name = fmt.Sprintf("%s.%s", base, imaging.Extension(f))
+				}
+				destination := path.Join(dir, name)
+
+				key := v.Name
+				if f != format {
+					key += "_" + f
+				}
+
+				buf := new(bytes.Buffer)
+				if err := imaging.Encode(buf, resized, f, u.cfg.Image().Quality()); err != nil {
+					errs <- fmt.Errorf("encode file %s failed: %v", destination, err)
+					return
+				}
+
+				// Upload an object to storage
+				if _, err := u.storage.Put(ctx, destination, buf, int64(buf.Len()), imaging.ContentType(f)); err != nil {
+					errs <- fmt.Errorf("upload file %s failed: %v", destination, err)
+					return
+				}
+
+				newFile.file.Variants[key] = &entities.ImageVariant{
+					FileName: name,
+					Url:      u.storage.Url(destination),
+					Format:   f,
+					Width:    resized.Bounds().Dx(),
+					Height:   resized.Bounds().Dy(),
+				}
+			}
+		}
+
+		if !job.WithVariants {
+			newFile.file.Variants = nil
+		}
+
 		errs <- nil
 		results <- newFile.file
 	}
@@ -104,7 +190,7 @@ func (u *filesUsecase) UploadToStorage(req []*files.FileReq) ([]*files.FileRes,
 
 func (u *filesUsecase) deleteFromStorageFileWorkers(ctx context.Context, jobs <-chan *files.DeleteFileReq, errs chan<- error) {
 	for job := range jobs {
-		if err := os.Remove("./assets/images/" + job.Destination); err != nil {
+		if err := u.storage.Delete(ctx, job.Destination); err != nil && err != storage.ErrNotFound {
 			errs <- fmt.Errorf("remove file: %s failed: %v", job.Destination, err)
 			return
 		}
@@ -130,8 +216,21 @@ func (u *filesUsecase) DeleteFileOnStorage(req []*files.DeleteFileReq) error {
 	}
 
 	for a := 0; a < len(req); a++ {
-		err := <-errsCh
-		return err
+		if err := <-errsCh; err != nil {
+			return err
+		}
 	}
 	return nil
 }
+
+func (u *filesUsecase) GetFile(key string) (io.ReadCloser, *storage.ObjectInfo, error) {
+	return u.storage.Get(context.Background(), key)
+}
+
+func (u *filesUsecase) StatFile(key string) (*storage.ObjectInfo, error) {
+	return u.storage.Stat(context.Background(), key)
+}
+
+func (u *filesUsecase) VerifySignedUrl(key string, expires int64, signature string) bool {
+	return storage.VerifySignature(u.cfg.Storage().SignKey(), key, expires, signature)
+}
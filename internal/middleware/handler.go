@@ -1,15 +1,26 @@
 package middleware
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysUsecases"
 	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesUsecases"
 	"github.com/codepnw/go-ecommerce/pkg/auth"
-	"github.com/codepnw/go-ecommerce/pkg/utils"
+	"github.com/codepnw/go-ecommerce/pkg/logger"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/google/uuid"
 )
 
 type middlewareHandlersErrCode string
@@ -20,40 +31,145 @@ const (
 	paramsCheckErrCode middlewareHandlersErrCode = "middleware-003"
 	authorizeErrCode   middlewareHandlersErrCode = "middleware-004"
 	apiKeyErrCode      middlewareHandlersErrCode = "middleware-005"
+	rateLimitErrCode   middlewareHandlersErrCode = "middleware-006"
 )
 
 type IMiddlewareHandler interface {
 	Cors() fiber.Handler
+	BuildCors(cfg config.CorsConfig) error
+	ValidateCors(cfg config.CorsConfig) error
 	RouterCheck() fiber.Handler
 	Logger() fiber.Handler
 	JwtAuth() fiber.Handler
-	ParamsCheck() fiber.Handler
-	Authotize(expectRoleId ...int) fiber.Handler
-	ApiKeyAuth() fiber.Handler
+	ParamsCheck(permission string) fiber.Handler
+	Authorize(permissions ...string) fiber.Handler
+	ApiKeyAuth(scopes ...string) fiber.Handler
+	RateLimit() fiber.Handler
 }
 
 type middlewareHandler struct {
 	cfg     config.Config
 	usecase IMiddlewareUsecase
+	roles   rolesUsecases.IRolesUsecase
+	tokens  auth.ITokenCache
+	apiKeys apikeysUsecases.IApiKeysUsecase
+	limiter ratelimit.Store
+	cors    atomic.Pointer[[]*corsPolicy]
 }
 
-func MiddlewareHandler(cfg config.Config, usecase IMiddlewareUsecase) IMiddlewareHandler {
+func MiddlewareHandler(cfg config.Config, usecase IMiddlewareUsecase, roles rolesUsecases.IRolesUsecase, tokens auth.ITokenCache, apiKeys apikeysUsecases.IApiKeysUsecase, limiter ratelimit.Store) IMiddlewareHandler {
 	return &middlewareHandler{
 		cfg:     cfg,
 		usecase: usecase,
+		roles:   roles,
+		tokens:  tokens,
+		apiKeys: apiKeys,
+		limiter: limiter,
 	}
 }
 
+// Cors uses policy of route group matching the path, otherwise default
+// policy. Handlers are built by BuildCors
 func (h *middlewareHandler) Cors() fiber.Handler {
-	return cors.New(cors.Config{
-		Next:             cors.ConfigDefault.Next,
-		AllowOrigins:     "*",
-		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH",
-		AllowHeaders:     "",
-		AllowCredentials: false,
-		ExposeHeaders:    "",
-		MaxAge:           0,
-	})
+	return func(c *fiber.Ctx) error {
+		policies := *h.cors.Load()
+		for _, p := range policies[:len(policies)-1] {
+			if matchPaths(c.Path(), p.paths) {
+				return p.handler(c)
+			}
+		}
+		return policies[len(policies)-1].handler(c)
+	}
+}
+
+// corsPolicy is handler of route group, default policy is the last one
+type corsPolicy struct {
+	paths   []string
+	handler fiber.Handler
+}
+
+// BuildCors builds handlers of all policies at once, at start and after
+// config is reloaded. Current handlers are kept on error
+func (h *middlewareHandler) BuildCors(cfg config.CorsConfig) error {
+	policies, err := buildCors(cfg)
+	if err != nil {
+		return err
+	}
+	h.cors.Store(&policies)
+	return nil
+}
+
+// ValidateCors checks that handlers can be built, for config before it is applied
+func (h *middlewareHandler) ValidateCors(cfg config.CorsConfig) error {
+	_, err := buildCors(cfg)
+	return err
+}
+
+// buildCors returns panic of fiber cors as error, a bad value must not stop requests
+func buildCors(cfg config.CorsConfig) (policies []*corsPolicy, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("build cors failed: %v", r)
+		}
+	}()
+
+	for _, p := range append(cfg.Groups(), cfg) {
+		policies = append(policies, &corsPolicy{
+			paths: p.Paths(),
+			handler: cors.New(cors.Config{
+				Next:             cors.ConfigDefault.Next,
+				AllowOrigins:     strings.Join(p.AllowOrigins(), ","),
+				AllowMethods:     strings.Join(p.AllowMethods(), ","),
+				AllowHeaders:     strings.Join(p.AllowHeaders(), ","),
+				AllowCredentials: p.AllowCredentials(),
+				ExposeHeaders:    strings.Join(p.ExposeHeaders(), ","),
+				MaxAge:           p.MaxAge(),
+			}),
+		})
+	}
+	return policies, nil
+}
+
+// matchPaths reports whether path is one of patterns or under it, and is
+// not excluded. Pattern =path matches the path only, !path excludes the
+// path and paths under it, * matches one segment like :param of routes
+func matchPaths(path string, patterns []string) bool {
+	segments := pathSegments(path)
+	matched := false
+	for _, p := range patterns {
+		switch {
+		case strings.HasPrefix(p, "!"):
+			if matchSegments(segments, pathSegments(p[1:]), false) {
+				return false
+			}
+		case strings.HasPrefix(p, "="):
+			matched = matched || matchSegments(segments, pathSegments(p[1:]), true)
+		default:
+			matched = matched || matchSegments(segments, pathSegments(p), false)
+		}
+	}
+	return matched
+}
+
+// pathSegments is case insensitive and ignores trailing slash, like routing
+func pathSegments(path string) []string {
+	path = strings.Trim(strings.ToLower(path), "/")
+	if path == "" {
+		return nil
+	}
+	return strings.Split(path, "/")
+}
+
+func matchSegments(segments, pattern []string, exact bool) bool {
+	if len(segments) < len(pattern) || (exact && len(segments) != len(pattern)) {
+		return false
+	}
+	for i, p := range pattern {
+		if p != "*" && p != segments[i] {
+			return false
+		}
+	}
+	return true
 }
 
 func (h *middlewareHandler) RouterCheck() fiber.Handler {
@@ -66,12 +182,28 @@ func (h *middlewareHandler) RouterCheck() fiber.Handler {
 	}
 }
 
+// Logger sets request id and logs every request when it is done
 func (h *middlewareHandler) Logger() fiber.Handler {
-	return logger.New(logger.Config{
-		Format:     "${time} [${ip}] ${status} - ${method} ${path}\n",
-		TimeFormat: "02/01/2006",
-		TimeZone:   "Bangkok/Asia",
-	})
+	return func(c *fiber.Ctx) error {
+		requestId := c.Get(fiber.HeaderXRequestID)
+		if requestId == "" || len(requestId) > 64 {
+			requestId = uuid.NewString()
+		}
+		c.Set(fiber.HeaderXRequestID, requestId)
+		c.Locals("requestId", requestId)
+		c.Locals("requestStart", time.Now())
+
+		// Error is handled here so status code is logged
+		chainErr := c.Next()
+		if chainErr != nil {
+			if err := c.App().ErrorHandler(c, chainErr); err != nil {
+				_ = c.SendStatus(fiber.StatusInternalServerError)
+			}
+		}
+
+		logger.Access(c, chainErr)
+		return nil
+	}
 }
 
 func (h *middlewareHandler) JwtAuth() fiber.Handler {
@@ -87,26 +219,61 @@ func (h *middlewareHandler) JwtAuth() fiber.Handler {
 			).Res()
 		}
 
+		// Refresh and mfa tokens are signed by same keys
+		if result.Subject != "access-token" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(jwtAuthErrCode),
+				"token is not access token",
+			).Res()
+		}
+
 		claims := result.Claims
-		if !h.usecase.FindAccessToken(claims.Id, token) {
+		if h.tokens.Revoked(token, claims.Id, result.IssuedAt.Time) {
 			return entities.NewResponse(c).Error(
 				fiber.ErrUnauthorized.Code,
 				string(jwtAuthErrCode),
-				"no permission to access",
+				"token has been revoked",
+			).Res()
+		}
+
+		// Database is checked only when token is not cached
+		accessTokenHash := auth.HashToken(token)
+		if !h.tokens.Valid(token) {
+			if !h.usecase.FindAccessToken(claims.Id, accessTokenHash) {
+				return entities.NewResponse(c).Error(
+					fiber.ErrUnauthorized.Code,
+					string(jwtAuthErrCode),
+					"no permission to access",
+				).Res()
+			}
+			h.tokens.Add(token, claims.Id, result.ExpiresAt.Time)
+		}
+		h.usecase.TouchAccessToken(accessTokenHash)
+
+		// Permissions of role are from cache, changed permissions apply without new token
+		permissions, err := h.roles.Permissions(claims.RoleId)
+		if err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(jwtAuthErrCode),
+				err.Error(),
 			).Res()
 		}
 
 		// Set UserId
 		c.Locals("userId", claims.Id)
 		c.Locals("userRoleId", claims.RoleId)
+		c.Locals("userPermissions", permissions)
 		return c.Next()
 	}
 }
 
-func (h *middlewareHandler) ParamsCheck() fiber.Handler {
+// ParamsCheck allows owner of user_id param or user with permission
+func (h *middlewareHandler) ParamsCheck(permission string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		userId := c.Locals("userId")
-		if c.Locals("userRoleId").(int) == 2 {
+		if permissions, _ := c.Locals("userPermissions").(roles.Permissions); permissions.Has(permission) {
 			return c.Next()
 		}
 		if c.Params("user_id") != userId {
@@ -120,60 +287,130 @@ func (h *middlewareHandler) ParamsCheck() fiber.Handler {
 	}
 }
 
-func (h *middlewareHandler) Authotize(expectRoleId ...int) fiber.Handler {
+// Authorize requires all permissions, it must be after JwtAuth
+func (h *middlewareHandler) Authorize(permissions ...string) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		userRoleId, ok := c.Locals("userRoleId").(int)
+		granted, ok := c.Locals("userPermissions").(roles.Permissions)
 		if !ok {
 			return entities.NewResponse(c).Error(
 				fiber.ErrUnauthorized.Code,
 				string(authorizeErrCode),
-				"user_id is not int type",
+				"permissions are not set",
 			).Res()
 		}
 
-		// Find Role
-		roles, err := h.usecase.FindRole()
+		for _, p := range permissions {
+			if !granted.Has(p) {
+				return entities.NewResponse(c).Error(
+					fiber.ErrUnauthorized.Code,
+					string(authorizeErrCode),
+					"no permission to access",
+				).Res()
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ApiKeyAuth requires X-Api-Key with all scopes, origin and ip must be allowed by key
+func (h *middlewareHandler) ApiKeyAuth(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key, err := h.apiKeys.Authenticate(c.Get("X-Api-Key"))
 		if err != nil {
+			status := fiber.ErrUnauthorized.Code
+			msg := "apikey is invalid or required"
+			if !strings.HasPrefix(err.Error(), "api key ") {
+				status = fiber.ErrInternalServerError.Code
+				msg = err.Error()
+			}
 			return entities.NewResponse(c).Error(
-				fiber.StatusInternalServerError,
-				string(authorizeErrCode),
-				err.Error(),
+				status,
+				string(apiKeyErrCode),
+				msg,
 			).Res()
 		}
 
-		sum := 0
-		for _, v := range expectRoleId {
-			sum += v
+		if err := key.Allows(c.Get(fiber.HeaderOrigin), c.IP()); err != nil {
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(apiKeyErrCode),
+				err.Error(),
+			).Res()
 		}
-
-		expectedValueBinary := utils.BinaryConverter(sum, len(roles))
-		userValueBinary := utils.BinaryConverter(userRoleId, len(roles))
-
-		for i := range userValueBinary {
-			if userValueBinary[i]&expectedValueBinary[i] == 1 {
-				return c.Next()
+		for _, scope := range scopes {
+			if !key.HasScope(scope) {
+				return entities.NewResponse(c).Error(
+					fiber.ErrUnauthorized.Code,
+					string(apiKeyErrCode),
+					"apikey has no scope "+scope,
+				).Res()
 			}
 		}
 
-		return entities.NewResponse(c).Error(
-			fiber.ErrUnauthorized.Code,
-			string(authorizeErrCode),
-			"no permission to access",
-		).Res()
+		c.Locals("apiKeyId", key.Id)
+		c.Locals("apiKeyOwnerId", key.OwnerId)
+		c.Locals("apiKeyScopes", key.Scopes)
+		return c.Next()
 	}
 }
 
-func (h *middlewareHandler) ApiKeyAuth() fiber.Handler {
+// RateLimit limits requests of route by ip, api key and email of body,
+// RateLimit-* headers show the limit closest to be exceeded
+func (h *middlewareHandler) RateLimit() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		key := c.Get("X-Api-Key")
-		if _, err := auth.ParseApiKey(h.cfg.Jwt(), key); err != nil {
+		cfg := h.cfg.RateLimit()
+		if !cfg.Enabled() {
+			return c.Next()
+		}
+
+		type bucket struct {
+			key   string
+			limit config.RateLimit
+		}
+		route := c.Route().Path
+		buckets := []bucket{{"ip:" + route + ":" + c.IP(), cfg.Ip()}}
+
+		if apiKey := c.Get("X-Api-Key"); apiKey != "" {
+			sum := sha256.Sum256([]byte(apiKey))
+			buckets = append(buckets, bucket{"apikey:" + route + ":" + hex.EncodeToString(sum[:8]), cfg.ApiKey()})
+		}
+
+		body := new(struct {
+			Email string `json:"email" form:"email"`
+		})
+		if err := c.BodyParser(body); err == nil && body.Email != "" {
+			email := strings.ToLower(strings.TrimSpace(body.Email))
+			buckets = append(buckets, bucket{"email:" + route + ":" + email, cfg.Email()})
+		}
+
+		var result *ratelimit.Result
+		for _, b := range buckets {
+			res, err := h.limiter.Take(c.UserContext(), b.key, b.limit)
+			if err != nil {
+				// Store is down, requests are not blocked
+				slog.Error("rate limit failed", slog.String("request_id", logger.RequestId(c)), slog.String("error", err.Error()))
+				continue
+			}
+			if result == nil || (result.Allowed && !res.Allowed) || (result.Allowed == res.Allowed && res.Remaining < result.Remaining) {
+				result = res
+			}
+		}
+		if result == nil {
+			return c.Next()
+		}
+
+		c.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		c.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		c.Set("RateLimit-Reset", strconv.Itoa(int(result.Reset.Seconds())))
+
+		if !result.Allowed {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(result.RetryAfter.Seconds())))
 			return entities.NewResponse(c).Error(
-				fiber.ErrUnauthorized.Code,
-				string(apiKeyErrCode),
-				"apikey is invalid or required",
+				fiber.StatusTooManyRequests,
+				string(rateLimitErrCode),
+				"too many requests",
 			).Res()
 		}
-
 		return c.Next()
 	}
 }
@@ -1,6 +0,0 @@
-package middleware
-
-type Role struct {
-	Id    int    `db:"id"`
-	Title string `db:"title"`
-}
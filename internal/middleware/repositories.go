@@ -1,13 +1,17 @@
 package middleware
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 type IMiddlewareRepository interface {
-	FindAccessToken(userId, accessToken string) bool
-	FindRole() ([]*Role, error)
+	FindAccessToken(userId, accessTokenHash string) bool
+	UpdateLastUsed(accessTokenHashes []string) error
 }
 
 type middlewareRepository struct {
@@ -18,47 +22,35 @@ func MiddlewareRepository(db *sql.DB) IMiddlewareRepository {
 	return &middlewareRepository{db: db}
 }
 
-func (r *middlewareRepository) FindAccessToken(userId, accessToken string) bool {
+func (r *middlewareRepository) FindAccessToken(userId, accessTokenHash string) bool {
 	query := `
 		SELECT
 			(CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
 		FROM "oauth"
 		WHERE "user_id" = $1
-		AND "access_token" = $2;
+		AND "access_token_hash" = $2
+		AND "expires_at" > now();
 	`
 	var check bool
-	err := r.db.QueryRow(query, userId, accessToken).Scan(&check)
+	err := r.db.QueryRow(query, userId, accessTokenHash).Scan(&check)
 
-	return err == nil
+	return err == nil && check
 }
 
-func (r *middlewareRepository) FindRole() ([]*Role, error) {
+// UpdateLastUsed writes one batch, sessions used within a minute are skipped,
+// other instances may have written them
+func (r *middlewareRepository) UpdateLastUsed(accessTokenHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
 	query := `
-		SELECT
-			"id",
-			"title"
-		FROM "roles"
-		ORDER BY "id" DESC;
+		UPDATE "oauth" SET
+			"last_used_at" = now()
+		WHERE "access_token_hash" = ANY($1)
+		AND "last_used_at" < now() - INTERVAL '1 minute';
 	`
-	roles := make([]*Role, 0)
-
-	rows, err := r.db.Query(query)
-	if err != nil {
-		return nil, fmt.Errorf("role is empty")
+	if _, err := r.db.ExecContext(ctx, query, pq.Array(accessTokenHashes)); err != nil {
+		return fmt.Errorf("update session last used failed: %v", err)
 	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var role Role
-		if err := rows.Scan(&role.Id, &role.Title); err != nil {
-			return nil, fmt.Errorf("scan roles error")
-		}
-		roles = append(roles, &role)
-	}
-
-	if err = rows.Err(); err != nil {
-		return nil, fmt.Errorf("rows error: %v", err)
-	}
-
-	return roles, nil
+	return nil
 }
@@ -1,23 +1,127 @@
 package middleware
 
-type IMiddlewareUsecase interface {
-	FindAccessToken(userId, accessToken string) bool
-	FindRole() ([]*Role, error)
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+const (
+	// last_used_at of session is written at most once per interval
+	lastUsedInterval = time.Minute
+	// Touches are dropped when the queue is full, usage is informational
+	lastUsedQueueSize     = 1024
+	lastUsedBatchSize     = 100
+	lastUsedFlushInterval = 5 * time.Second
+)
 
+type IMiddlewareUsecase interface {
+	FindAccessToken(userId, accessTokenHash string) bool
+	// TouchAccessToken queues use of session, database is written in background
+	TouchAccessToken(accessTokenHash string)
+	// Close writes queued touches, it is called on shutdown
+	Close(ctx context.Context) error
 }
 
 type middlewareUsecase struct {
 	repo IMiddlewareRepository
+
+	mu      sync.Mutex
+	bucket  time.Time           // start of current interval
+	touched map[string]struct{} // hashes queued in current interval
+	closed  bool
+	queue   chan string
+	done    chan struct{}
 }
 
 func MiddlewareUsecase(repo IMiddlewareRepository) IMiddlewareUsecase {
-	return &middlewareUsecase{repo: repo}
+	u := &middlewareUsecase{
+		repo:    repo,
+		touched: make(map[string]struct{}),
+		queue:   make(chan string, lastUsedQueueSize),
+		done:    make(chan struct{}),
+	}
+	go u.run()
+	return u
+}
+
+func (u *middlewareUsecase) FindAccessToken(userId, accessTokenHash string) bool {
+	return u.repo.FindAccessToken(userId, accessTokenHash)
+}
+
+// TouchAccessToken never blocks request, touched hashes are forgotten at once when interval ends
+func (u *middlewareUsecase) TouchAccessToken(accessTokenHash string) {
+	bucket := time.Now().Truncate(lastUsedInterval)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed {
+		return
+	}
+	if !bucket.Equal(u.bucket) {
+		u.bucket = bucket
+		u.touched = make(map[string]struct{})
+	}
+	if _, ok := u.touched[accessTokenHash]; ok {
+		return
+	}
+
+	select {
+	case u.queue <- accessTokenHash:
+		u.touched[accessTokenHash] = struct{}{}
+	default:
+	}
 }
 
-func (u *middlewareUsecase) FindAccessToken(userId, accessToken string) bool {
-	return u.repo.FindAccessToken(userId, accessToken)
+func (u *middlewareUsecase) run() {
+	defer close(u.done)
+
+	ticker := time.NewTicker(lastUsedFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]string, 0, lastUsedBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := u.repo.UpdateLastUsed(batch); err != nil {
+			slog.Warn("update session last used failed", slog.Int("sessions", len(batch)), slog.String("error", err.Error()))
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case hash, ok := <-u.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, hash)
+			if len(batch) >= lastUsedBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
 }
 
-func (u *middlewareUsecase) FindRole() ([]*Role, error) {
-	return u.repo.FindRole()
-}
\ No newline at end of file
+func (u *middlewareUsecase) Close(ctx context.Context) error {
+	u.mu.Lock()
+	if !u.closed {
+		u.closed = true
+		close(u.queue)
+	}
+	u.mu.Unlock()
+
+	select {
+	case <-u.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("flush session last used failed: %v", ctx.Err())
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 type IMonitorHandler interface {
 	HealthCheck(*fiber.Ctx) error
+	EffectiveConfig(*fiber.Ctx) error
 }
 
 type monitorHandler struct {
@@ -30,3 +31,8 @@ func (m *monitorHandler) HealthCheck(c *fiber.Ctx) error {
 	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
 }
+
+// EffectiveConfig shows config in use after reloads, secrets are masked
+func (m *monitorHandler) EffectiveConfig(c *fiber.Ctx) error {
+	return entities.NewResponse(c).Success(fiber.StatusOK, m.cfg.Effective()).Res()
+}
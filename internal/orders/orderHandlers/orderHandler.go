@@ -1,13 +1,22 @@
 package orderHandlers
 
 import (
+	"fmt"
+	"log/slog"
+	"math"
+	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
 	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/files"
+	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
 	"github.com/codepnw/go-ecommerce/internal/orders"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderUsecases"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/pkg/imaging"
+	"github.com/codepnw/go-ecommerce/pkg/utils"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
 )
@@ -15,10 +24,14 @@ import (
 type ordersHandlersErrCode string
 
 const (
-	findOneOrderErrCode ordersHandlersErrCode = "orders-001"
-	findAllOrderErrCode ordersHandlersErrCode = "orders-002"
-	insertOrderErrCode  ordersHandlersErrCode = "orders-003"
-	updateOrderErrCode  ordersHandlersErrCode = "orders-004"
+	findOneOrderErrCode      ordersHandlersErrCode = "orders-001"
+	findAllOrderErrCode      ordersHandlersErrCode = "orders-002"
+	insertOrderErrCode       ordersHandlersErrCode = "orders-003"
+	updateOrderErrCode       ordersHandlersErrCode = "orders-004"
+	outOfStockErrCode        ordersHandlersErrCode = "orders-005"
+	statusTransitionErrCode  ordersHandlersErrCode = "orders-006"
+	findStatusHistoryErrCode ordersHandlersErrCode = "orders-007"
+	uploadSlipErrCode        ordersHandlersErrCode = "orders-008"
 )
 
 type IOrderHandler interface {
@@ -26,17 +39,21 @@ type IOrderHandler interface {
 	FindAllOrders(c *fiber.Ctx) error
 	InsertOrder(c *fiber.Ctx) error
 	UpdateOrder(c *fiber.Ctx) error
+	FindStatusHistory(c *fiber.Ctx) error
+	UploadTransferSlip(c *fiber.Ctx) error
 }
 
 type orderHandler struct {
-	cfg     config.Config
-	usecase orderUsecases.IOrderUsecase
+	cfg          config.Config
+	usecase      orderUsecases.IOrderUsecase
+	filesUsecase filesUsecases.IFilesUsecase
 }
 
-func OrderHandler(cfg config.Config, usecase orderUsecases.IOrderUsecase) IOrderHandler {
+func OrderHandler(cfg config.Config, usecase orderUsecases.IOrderUsecase, filesUsecase filesUsecases.IFilesUsecase) IOrderHandler {
 	return &orderHandler{
-		cfg:     cfg,
-		usecase: usecase,
+		cfg:          cfg,
+		usecase:      usecase,
+		filesUsecase: filesUsecase,
 	}
 }
 
@@ -153,15 +170,35 @@ func (h *orderHandler) InsertOrder(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	if c.Locals("userRoleId").(int) != 2 {
+	if permissions, _ := c.Locals("userPermissions").(roles.Permissions); !permissions.Has(roles.PermOrdersWriteAny) {
 		req.UserId = userId
 	}
 
-	req.Status = "waiting"
+	req.Status = orders.StatusWaiting
+
+	// Prices are calculated from products in repository only
+	req.Subtotal = 0
+	req.Discount = 0
+	req.Tax = 0
+	req.Shipping = 0
 	req.TotalPaid = 0
 
 	order, err := h.usecase.InsertOrder(req)
 	if err != nil {
+		if strings.HasPrefix(err.Error(), "insufficient stock") {
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(outOfStockErrCode),
+				err.Error(),
+			).Res()
+		}
+		if err.Error() == "qty must more than zero" || err.Error() == "product is nil" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(insertOrderErrCode),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
 			string(insertOrderErrCode),
@@ -186,17 +223,14 @@ func (h *orderHandler) UpdateOrder(c *fiber.Ctx) error {
 
 	req.Id = orderId
 
-	statusMap := map[string]string{
-		"waiting":   "waiting",
-		"shipping":  "shipping",
-		"completed": "completed",
-		"canceled":  "canceled",
-	}
-
-	if c.Locals("userRoleId").(int) == 2 {
-		req.Status = statusMap[strings.ToLower(req.Status)]
-	} else if strings.ToLower(req.Status) == statusMap["canceled"] {
-		req.Status = statusMap["canceled"]
+	// Transition by role is checked in order state machine
+	req.Status = strings.ToLower(strings.Trim(req.Status, " "))
+	if req.Status != "" && !orders.IsStatus(req.Status) {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateOrderErrCode),
+			"status is invalid",
+		).Res()
 	}
 
 	if req.TransferSlip != nil {
@@ -221,14 +255,206 @@ func (h *orderHandler) UpdateOrder(c *fiber.Ctx) error {
 		}
 	}
 
-	order, err := h.usecase.UpdateOrder(req)
+	userId := c.Locals("userId").(string)
+	permissions, _ := c.Locals("userPermissions").(roles.Permissions)
+
+	order, err := h.usecase.UpdateOrder(req, userId, permissions)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "order status cannot change") {
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(statusTransitionErrCode),
+				err.Error(),
+			).Res()
+		}
+		if strings.HasPrefix(err.Error(), "transfer slip can not be changed") {
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(updateOrderErrCode),
+				err.Error(),
+			).Res()
+		}
+
+		switch err.Error() {
+		case "no permission to access":
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(updateOrderErrCode),
+				err.Error(),
+			).Res()
+		case "order status has been changed, please try again":
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(statusTransitionErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(updateOrderErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, order).Res()
+}
+
+func (h *orderHandler) FindStatusHistory(c *fiber.Ctx) error {
+	orderId := strings.Trim(c.Params("order_id"), " ")
+	userId := c.Locals("userId").(string)
+	permissions, _ := c.Locals("userPermissions").(roles.Permissions)
+
+	histories, err := h.usecase.FindStatusHistory(orderId, userId, permissions)
+	if err != nil {
+		switch err.Error() {
+		case "no permission to access":
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(findStatusHistoryErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(findStatusHistoryErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, histories).Res()
+}
+
+func (h *orderHandler) UploadTransferSlip(c *fiber.Ctx) error {
+	orderId := strings.Trim(c.Params("order_id"), " ")
+	userId := c.Locals("userId").(string)
+	permissions, _ := c.Locals("userPermissions").(roles.Permissions)
+
+	// Order is checked first, file is uploaded only for order which takes it
+	if err := h.usecase.CheckTransferSlip(orderId, userId, permissions); err != nil {
+		return transferSlipError(c, err)
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	// File ext validation
+	extMap := map[string]string{
+		"png":  "png",
+		"jpg":  "jpg",
+		"jpeg": "jpeg",
+		"webp": "webp",
+	}
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(file.Filename), "."))
+	if extMap[ext] == "" {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadSlipErrCode),
+			"extension is not acceptable",
+		).Res()
+	}
+
+	if file.Size > int64(h.cfg.App().FileLimit()) {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadSlipErrCode),
+			fmt.Sprintf("file size must less than %d MiB", int(math.Ceil(float64(h.cfg.App().FileLimit())/math.Pow(1024, 2)))),
+		).Res()
+	}
+
+	// Content must be a real image, extension is from content
+	format, err := h.filesUsecase.CheckImage(file)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	}
+	ext = imaging.Extension(format)
+
+	filename := utils.RandFileName(ext)
+	res, err := h.filesUsecase.UploadToStorage([]*files.FileReq{
+		{
+			File:        file,
+			Destination: fmt.Sprintf("%s/%s/%s", orders.SlipDestination, orderId, filename),
+			FileName:    filename,
+			Extension:   ext,
+		},
+	})
 	if err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrInternalServerError.Code,
-			string(updateOrderErrCode),
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	loc, err := time.LoadLocation("Asia/Bangkok")
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(uploadSlipErrCode),
 			err.Error(),
 		).Res()
 	}
 
+	req := &orders.Order{
+		Id: orderId,
+		TransferSlip: &orders.TransferSlip{
+			Id:        uuid.NewString(),
+			FileName:  res[0].FileName,
+			Url:       res[0].Url,
+			CreatedAt: time.Now().In(loc).Format("2006-01-02 15:04:05"),
+		},
+	}
+
+	order, err := h.usecase.UpdateOrder(req, userId, permissions)
+	if err != nil {
+		// Order changed since check, uploaded file is not referenced
+		if delErr := h.filesUsecase.DeleteFileOnStorage([]*files.DeleteFileReq{
+			{Destination: fmt.Sprintf("%s/%s/%s", orders.SlipDestination, orderId, filename)},
+		}); delErr != nil {
+			slog.Error("delete transfer slip failed", slog.String("order_id", orderId), slog.String("error", delErr.Error()))
+		}
+		return transferSlipError(c, err)
+	}
+
 	return entities.NewResponse(c).Success(fiber.StatusCreated, order).Res()
 }
+
+func transferSlipError(c *fiber.Ctx, err error) error {
+	switch {
+	case err.Error() == "no permission to access":
+		return entities.NewResponse(c).Error(
+			fiber.ErrUnauthorized.Code,
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	case strings.HasPrefix(err.Error(), "transfer slip can not be changed"):
+		return entities.NewResponse(c).Error(
+			fiber.ErrConflict.Code,
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	case strings.HasPrefix(err.Error(), "get order failed"):
+		return entities.NewResponse(c).Error(
+			fiber.ErrNotFound.Code,
+			string(uploadSlipErrCode),
+			"order not found",
+		).Res()
+	default:
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(uploadSlipErrCode),
+			err.Error(),
+		).Res()
+	}
+}
@@ -55,7 +55,7 @@ func (b *findOrderBuilder) initQuery() {
 				"o"."id",
 				"o"."user_id",
 				"o"."transfer_slip",
-				"o"."status,
+				"o"."status",
 				(
 					SELECT
 						array_to_json(array_agg("pt"))
@@ -70,12 +70,11 @@ func (b *findOrderBuilder) initQuery() {
 				) AS "products",
 				"o"."address",
 				"o"."contact",
-				(
-					SELECT
-						SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0))
-					FROM "products_orders" "po"
-					WHERE "po"."order_id" = "o"."id"
-				) AS "total_paid",
+				"o"."subtotal",
+				"o"."discount",
+				"o"."tax",
+				"o"."shipping",
+				"o"."total_paid",
 				"o"."created_at",
 				"o"."updated_at"
 			FROM "orders" "o"
@@ -4,15 +4,21 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"sort"
 	"time"
 
 	"github.com/codepnw/go-ecommerce/internal/orders"
+	"github.com/codepnw/go-ecommerce/internal/products"
+	"github.com/lib/pq"
 )
 
 type IInsertOrderBuilder interface {
 	initTransaction() error
 	insertOrder() error
 	insertProductsOrders() error
+	reserveStock() error
+	insertStatusHistory() error
+	clearCart() error
 	getOrderId() string
 	commit() error
 }
@@ -45,9 +51,14 @@ func (b *insertOrderBuilder) insertOrder() error {
 			"contact",
 			"address",
 			"transfer_slip",
-			"status"
+			"status",
+			"subtotal",
+			"discount",
+			"tax",
+			"shipping",
+			"total_paid"
 		)
-		VALUES ($1, $2, $3, $4, $5)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 		RETURNING "id";
 	`
 
@@ -59,6 +70,11 @@ func (b *insertOrderBuilder) insertOrder() error {
 		b.req.Address,
 		b.req.TransferSlip,
 		b.req.Status,
+		b.req.Subtotal,
+		b.req.Discount,
+		b.req.Tax,
+		b.req.Shipping,
+		b.req.TotalPaid,
 	).Scan(&b.req.Id)
 
 	if err != nil {
@@ -112,6 +128,193 @@ func (b *insertOrderBuilder) insertProductsOrders() error {
 	return nil
 }
 
+func (b *insertOrderBuilder) reserveStock() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Sum qty per product and lock rows in the same order to prevent deadlock
+	qtyMap := make(map[string]int)
+	productIds := make([]string, 0)
+	for _, p := range b.req.Products {
+		// Negative qty would add stock instead of reserving it
+		if p.Qty < 1 {
+			b.tx.Rollback()
+			return fmt.Errorf("qty must more than zero")
+		}
+		if _, ok := qtyMap[p.Product.Id]; !ok {
+			productIds = append(productIds, p.Product.Id)
+		}
+		qtyMap[p.Product.Id] += p.Qty
+	}
+	sort.Strings(productIds)
+
+	lockQuery := `
+		SELECT
+			"warehouse_id",
+			"qty"
+		FROM "products_stocks"
+		WHERE "product_id" = $1
+		AND "qty" > 0
+		ORDER BY "qty" DESC, "warehouse_id" ASC
+		FOR UPDATE;
+	`
+
+	updateQuery := `
+		UPDATE "products_stocks" SET
+			"qty" = "qty" - $1
+		WHERE "product_id" = $2
+		AND "warehouse_id" = $3;
+	`
+
+	movementQuery := `
+		INSERT INTO "stock_movements" (
+			"product_id",
+			"warehouse_id",
+			"order_id",
+			"qty",
+			"reason"
+		)
+		VALUES ($1, $2, $3, $4, $5);
+	`
+
+	for _, productId := range productIds {
+		type stock struct {
+			warehouseId int
+			qty         int
+		}
+
+		rows, err := b.tx.QueryContext(ctx, lockQuery, productId)
+		if err != nil {
+			b.tx.Rollback()
+			return fmt.Errorf("lock products_stocks failed: %v", err)
+		}
+
+		stocks := make([]*stock, 0)
+		total := 0
+		for rows.Next() {
+			s := new(stock)
+			if err := rows.Scan(&s.warehouseId, &s.qty); err != nil {
+				rows.Close()
+				b.tx.Rollback()
+				return fmt.Errorf("scan products_stocks failed: %v", err)
+			}
+			stocks = append(stocks, s)
+			total += s.qty
+		}
+		rows.Close()
+
+		need := qtyMap[productId]
+		if total < need {
+			b.tx.Rollback()
+			return fmt.Errorf("insufficient stock: product %s", productId)
+		}
+
+		for _, s := range stocks {
+			if need == 0 {
+				break
+			}
+
+			take := s.qty
+			if take > need {
+				take = need
+			}
+
+			if _, err := b.tx.ExecContext(ctx, updateQuery, take, productId, s.warehouseId); err != nil {
+				b.tx.Rollback()
+				return fmt.Errorf("update products_stocks failed: %v", err)
+			}
+
+			if _, err := b.tx.ExecContext(
+				ctx,
+				movementQuery,
+				productId,
+				s.warehouseId,
+				b.req.Id,
+				-take,
+				products.OrderStock,
+			); err != nil {
+				b.tx.Rollback()
+				return fmt.Errorf("insert stock_movements failed: %v", err)
+			}
+
+			need -= take
+		}
+	}
+
+	return nil
+}
+
+func (b *insertOrderBuilder) insertStatusHistory() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "order_status_history" (
+			"order_id",
+			"to_status",
+			"changed_by"
+		)
+		VALUES ($1, $2, $3);
+	`
+
+	if _, err := b.tx.ExecContext(ctx, query, b.req.Id, b.req.Status, b.req.UserId); err != nil {
+		b.tx.Rollback()
+		return fmt.Errorf("insert order_status_history failed: %v", err)
+	}
+	return nil
+}
+
+func (b *insertOrderBuilder) clearCart() error {
+	if b.req.CartId == "" {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	// Ordered qty is taken out of cart, qty added after cart was read stays
+	ordered := make(map[string]int)
+	productIds := make([]string, 0, len(b.req.Products))
+	for _, p := range b.req.Products {
+		if _, ok := ordered[p.Product.Id]; !ok {
+			productIds = append(productIds, p.Product.Id)
+		}
+		ordered[p.Product.Id] += p.Qty
+	}
+	qtys := make([]int64, 0, len(productIds))
+	for _, id := range productIds {
+		qtys = append(qtys, int64(ordered[id]))
+	}
+
+	// Delete first, qty of item must stay positive
+	queries := []struct {
+		query string
+		name  string
+	}{
+		{`
+		DELETE FROM "carts_items" "ci"
+		USING unnest($2::VARCHAR[], $3::INT[]) AS "o" ("product_id", "qty")
+		WHERE "ci"."cart_id" = $1
+		AND "ci"."product_id" = "o"."product_id"
+		AND "ci"."qty" <= "o"."qty";
+		`, "delete cart items"},
+		{`
+		UPDATE "carts_items" "ci" SET
+			"qty" = "ci"."qty" - "o"."qty"
+		FROM unnest($2::VARCHAR[], $3::INT[]) AS "o" ("product_id", "qty")
+		WHERE "ci"."cart_id" = $1
+		AND "ci"."product_id" = "o"."product_id";
+		`, "update cart items"},
+	}
+	for _, q := range queries {
+		if _, err := b.tx.ExecContext(ctx, q.query, b.req.CartId, pq.Array(productIds), pq.Array(qtys)); err != nil {
+			b.tx.Rollback()
+			return fmt.Errorf("%s failed: %v", q.name, err)
+		}
+	}
+	return nil
+}
+
 func (b *insertOrderBuilder) commit() error {
 	if err := b.tx.Commit(); err != nil {
 		return err
@@ -147,6 +350,18 @@ func (en *insertOrderEngineer) InsertOrder() (string, error) {
 		return "", err
 	}
 
+	if err := en.builder.reserveStock(); err != nil {
+		return "", err
+	}
+
+	if err := en.builder.insertStatusHistory(); err != nil {
+		return "", err
+	}
+
+	if err := en.builder.clearCart(); err != nil {
+		return "", err
+	}
+
 	if err := en.builder.commit(); err != nil {
 		return "", err
 	}
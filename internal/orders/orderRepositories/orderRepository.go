@@ -6,16 +6,19 @@ import (
 	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/codepnw/go-ecommerce/internal/orders"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderPatterns"
+	"github.com/codepnw/go-ecommerce/internal/products"
 )
 
 type IOrderRepository interface {
 	FindOneOrder(orderId string) (*orders.Order, error)
 	FindAllOrders(req *orders.OrderFilter) ([]*orders.Order, int)
 	InsertOrder(req *orders.Order) (string, error)
-	UpdateOrder(req *orders.Order) error
+	UpdateOrder(req *orders.Order, prevStatus, changedBy string) error
+	FindStatusHistory(orderId string) ([]*orders.StatusHistory, error)
 }
 
 type orderRepository struct {
@@ -35,7 +38,7 @@ func (r *orderRepository) FindOneOrder(orderId string) (*orders.Order, error) {
 				"o"."id",
 				"o"."user_id",
 				"o"."transfer_slip",
-				"o"."status,
+				"o"."status",
 				(
 					SELECT
 						array_to_json(array_agg("pt"))
@@ -50,12 +53,11 @@ func (r *orderRepository) FindOneOrder(orderId string) (*orders.Order, error) {
 				) AS "products",
 				"o"."address",
 				"o"."contact",
-				(
-					SELECT
-						SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0))
-					FROM "products_orders" "po"
-					WHERE "po"."order_id" = "o"."id"
-				) AS "total_paid",
+				"o"."subtotal",
+				"o"."discount",
+				"o"."tax",
+				"o"."shipping",
+				"o"."total_paid",
 				"o"."created_at",
 				"o"."updated_at"
 			FROM "orders" "o"
@@ -97,9 +99,25 @@ func (r *orderRepository) InsertOrder(req *orders.Order) (string, error) {
 	return orderId, nil
 }
 
-func (r *orderRepository) UpdateOrder(req *orders.Order) error {
+func (r *orderRepository) UpdateOrder(req *orders.Order, prevStatus, changedBy string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Refunded goods are returned to stock like goods of canceled order
+	if reason, ok := restockReasons[req.Status]; ok {
+		if err := r.restoreStock(ctx, tx, req.Id, reason); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
 	query := `UPDATE "orders" SET`
-	
+
 	queryWhereStack := make([]string, 0)
 	values := make([]any, 0)
 	lastIndex := 1
@@ -107,8 +125,8 @@ func (r *orderRepository) UpdateOrder(req *orders.Order) error {
 	if req.Status != "" {
 		values = append(values, req.Status)
 		queryWhereStack = append(
-			queryWhereStack, 
-			fmt.Sprintf(`"status" = $%d?`, lastIndex),
+			queryWhereStack,
+			fmt.Sprintf(` "status" = $%d?`, lastIndex),
 		)
 		lastIndex++
 	}
@@ -116,18 +134,24 @@ func (r *orderRepository) UpdateOrder(req *orders.Order) error {
 	if req.TransferSlip != nil {
 		values = append(values, req.TransferSlip)
 		queryWhereStack = append(
-			queryWhereStack, 
-			fmt.Sprintf(`"transfer_slip" = $%d?`, lastIndex),
+			queryWhereStack,
+			fmt.Sprintf(` "transfer_slip" = $%d?`, lastIndex),
 		)
 		lastIndex++
 	}
 
 	values = append(values, req.Id)
+	queryClose := fmt.Sprintf(` WHERE "id" = $%d`, lastIndex)
 
-	queryClose := fmt.Sprintf(`WHERE "id" = $%d;`, lastIndex)
+	// Status must not be changed by others since checked
+	if req.Status != "" {
+		values = append(values, prevStatus)
+		queryClose += fmt.Sprintf(` AND "status" = $%d`, lastIndex+1)
+	}
+	queryClose += ";"
 
 	for i := range queryWhereStack {
-		if i != len(queryWhereStack) - 1 {
+		if i != len(queryWhereStack)-1 {
 			query += strings.Replace(queryWhereStack[i], "?", ",", 1)
 		} else {
 			query += strings.Replace(queryWhereStack[i], "?", "", 1)
@@ -136,9 +160,158 @@ func (r *orderRepository) UpdateOrder(req *orders.Order) error {
 
 	query += queryClose
 
-	if _, err := r.db.ExecContext(context.Background(), query, values...); err != nil {
+	result, err := tx.ExecContext(ctx, query, values...)
+	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("update order failed: %v", err)
 	}
 
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		tx.Rollback()
+		return fmt.Errorf("order status has been changed, please try again")
+	}
+
+	if req.Status != "" {
+		historyQuery := `
+			INSERT INTO "order_status_history" (
+				"order_id",
+				"from_status",
+				"to_status",
+				"changed_by"
+			)
+			VALUES ($1, $2, $3, $4);
+		`
+
+		if _, err := tx.ExecContext(
+			ctx,
+			historyQuery,
+			req.Id,
+			prevStatus,
+			req.Status,
+			changedBy,
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("insert order_status_history failed: %v", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func (r *orderRepository) FindStatusHistory(orderId string) ([]*orders.StatusHistory, error) {
+	query := `
+		SELECT
+			"id",
+			"order_id",
+			COALESCE("from_status"::TEXT, ''),
+			"to_status",
+			"changed_by",
+			"created_at"
+		FROM "order_status_history"
+		WHERE "order_id" = $1
+		ORDER BY "created_at" ASC;
+	`
+
+	histories := make([]*orders.StatusHistory, 0)
+
+	rows, err := r.db.Query(query, orderId)
+	if err != nil {
+		return nil, fmt.Errorf("query order_status_history failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var history orders.StatusHistory
+		if err := rows.Scan(
+			&history.Id,
+			&history.OrderId,
+			&history.FromStatus,
+			&history.ToStatus,
+			&history.ChangedBy,
+			&history.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan order_status_history failed: %v", err)
+		}
+		histories = append(histories, &history)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return histories, nil
+}
+
+// status -> reason of stock movement, stock of order is returned on these statuses
+var restockReasons = map[string]string{
+	orders.StatusCanceled: products.OrderCanceledStock,
+	orders.StatusRefunded: products.OrderRefundedStock,
+}
+
+// restoreStock returns reserved stock of the order back to its warehouses.
+// The order row is locked, so the stock is restored only once.
+func (r *orderRepository) restoreStock(ctx context.Context, tx *sql.Tx, orderId, reason string) error {
+	var status string
+	if err := tx.QueryRowContext(
+		ctx,
+		`SELECT "status" FROM "orders" WHERE "id" = $1 FOR UPDATE;`,
+		orderId,
+	).Scan(&status); err != nil {
+		return fmt.Errorf("get order failed: %v", err)
+	}
+
+	if _, ok := restockReasons[status]; ok {
+		return nil
+	}
+
+	updateQuery := `
+		UPDATE "products_stocks" "ps" SET
+			"qty" = "ps"."qty" - "m"."qty"
+		FROM (
+			SELECT
+				"product_id",
+				"warehouse_id",
+				SUM("qty") AS "qty"
+			FROM "stock_movements"
+			WHERE "order_id" = $1
+			GROUP BY "product_id", "warehouse_id"
+		) AS "m"
+		WHERE "ps"."product_id" = "m"."product_id"
+		AND "ps"."warehouse_id" = "m"."warehouse_id";
+	`
+
+	if _, err := tx.ExecContext(ctx, updateQuery, orderId); err != nil {
+		return fmt.Errorf("restore products_stocks failed: %v", err)
+	}
+
+	movementQuery := `
+		INSERT INTO "stock_movements" (
+			"product_id",
+			"warehouse_id",
+			"order_id",
+			"qty",
+			"reason"
+		)
+		SELECT
+			"product_id",
+			"warehouse_id",
+			"order_id",
+			-SUM("qty"),
+			$2
+		FROM "stock_movements"
+		WHERE "order_id" = $1
+		GROUP BY "product_id", "warehouse_id", "order_id"
+		HAVING SUM("qty") <> 0;
+	`
+
+	if _, err := tx.ExecContext(ctx, movementQuery, orderId, reason); err != nil {
+		return fmt.Errorf("insert stock_movements failed: %v", err)
+	}
+
 	return nil
-}
\ No newline at end of file
+}
@@ -3,27 +3,35 @@ package orderUsecases
 import (
 	"fmt"
 	"math"
+	"strings"
 
+	"github.com/codepnw/go-ecommerce/config"
 	"github.com/codepnw/go-ecommerce/internal/entities"
 	"github.com/codepnw/go-ecommerce/internal/orders"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderRepositories"
 	"github.com/codepnw/go-ecommerce/internal/products/productRepositories"
+	"github.com/codepnw/go-ecommerce/internal/roles"
 )
 
 type IOrderUsecase interface {
 	FindOneOrder(orderId string) (*orders.Order, error)
 	FindAllOrders(req *orders.OrderFilter) *entities.PaginateRes
 	InsertOrder(req *orders.Order) (*orders.Order, error)
-	UpdateOrder(req *orders.Order) (*orders.Order, error)
+	UpdateOrder(req *orders.Order, userId string, permissions roles.Permissions) (*orders.Order, error)
+	FindStatusHistory(orderId, userId string, permissions roles.Permissions) ([]*orders.StatusHistory, error)
+	FindSlipOwner(key string) (string, error)
+	CheckTransferSlip(orderId, userId string, permissions roles.Permissions) error
 }
 
 type orderUsecase struct {
+	cfg         config.Config
 	orderRepo   orderRepositories.IOrderRepository
 	productRepo productRepositories.IProductRepository
 }
 
-func OrderUsecase(orderRepo orderRepositories.IOrderRepository, productRepo productRepositories.IProductRepository) IOrderUsecase {
+func OrderUsecase(cfg config.Config, orderRepo orderRepositories.IOrderRepository, productRepo productRepositories.IProductRepository) IOrderUsecase {
 	return &orderUsecase{
+		cfg:         cfg,
 		orderRepo:   orderRepo,
 		productRepo: productRepo,
 	}
@@ -37,6 +45,20 @@ func (u *orderUsecase) FindOneOrder(orderId string) (*orders.Order, error) {
 	return order, nil
 }
 
+// FindSlipOwner returns user id of order the transfer slip key belongs to
+func (u *orderUsecase) FindSlipOwner(key string) (string, error) {
+	parts := strings.SplitN(key, "/", 3)
+	if len(parts) != 3 || parts[0] != orders.SlipDestination || parts[1] == "" {
+		return "", fmt.Errorf("file not found")
+	}
+
+	order, err := u.orderRepo.FindOneOrder(parts[1])
+	if err != nil {
+		return "", fmt.Errorf("file not found")
+	}
+	return order.UserId, nil
+}
+
 func (u *orderUsecase) FindAllOrders(req *orders.OrderFilter) *entities.PaginateRes {
 	orders, count := u.orderRepo.FindAllOrders(req)
 	return &entities.PaginateRes{
@@ -55,16 +77,22 @@ func (u *orderUsecase) InsertOrder(req *orders.Order) (*orders.Order, error) {
 			return nil, fmt.Errorf("product is nil")
 		}
 
+		if req.Products[i].Qty < 1 {
+			return nil, fmt.Errorf("qty must more than zero")
+		}
+
 		prod, err := u.productRepo.FindOneProduct(req.Products[i].Product.Id)
 		if err != nil {
 			return nil, err
 		}
 
-		// Set Price
-		req.TotalPaid += req.Products[i].Product.Price * float64(req.Products[i].Qty)
+		// Snapshot product with repository price
 		req.Products[i].Product = prod
 	}
 
+	// Set Price
+	req.CalcTotals(u.cfg.App().TaxRate(), u.cfg.App().ShippingFee())
+
 	orderId, err := u.orderRepo.InsertOrder(req)
 	if err != nil {
 		return nil, err
@@ -78,8 +106,26 @@ func (u *orderUsecase) InsertOrder(req *orders.Order) (*orders.Order, error) {
 	return order, nil
 }
 
-func (u *orderUsecase) UpdateOrder(req *orders.Order) (*orders.Order, error) {
-	if err := u.orderRepo.UpdateOrder(req); err != nil {
+func (u *orderUsecase) UpdateOrder(req *orders.Order, userId string, permissions roles.Permissions) (*orders.Order, error) {
+	current, err := u.orderRepo.FindOneOrder(req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permissions.Has(roles.PermOrdersWriteAny) && current.UserId != userId {
+		return nil, fmt.Errorf("no permission to access")
+	}
+
+	if req.Status != "" {
+		if err := orders.CheckStatusTransition(current.Status, req.Status, permissions); err != nil {
+			return nil, err
+		}
+	}
+	if req.TransferSlip != nil && current.Status != orders.StatusWaiting {
+		return nil, fmt.Errorf("transfer slip can not be changed when order is %s", current.Status)
+	}
+
+	if err := u.orderRepo.UpdateOrder(req, current.Status, userId); err != nil {
 		return nil, err
 	}
 
@@ -89,4 +135,38 @@ func (u *orderUsecase) UpdateOrder(req *orders.Order) (*orders.Order, error) {
 	}
 
 	return order, nil
-}
\ No newline at end of file
+}
+
+// CheckTransferSlip is done before slip is uploaded, so no file is stored
+// for order of other user or order which is already paid
+func (u *orderUsecase) CheckTransferSlip(orderId, userId string, permissions roles.Permissions) error {
+	order, err := u.orderRepo.FindOneOrder(orderId)
+	if err != nil {
+		return err
+	}
+
+	if !permissions.Has(roles.PermOrdersWriteAny) && order.UserId != userId {
+		return fmt.Errorf("no permission to access")
+	}
+	if order.Status != orders.StatusWaiting {
+		return fmt.Errorf("transfer slip can not be changed when order is %s", order.Status)
+	}
+	return nil
+}
+
+func (u *orderUsecase) FindStatusHistory(orderId, userId string, permissions roles.Permissions) ([]*orders.StatusHistory, error) {
+	order, err := u.orderRepo.FindOneOrder(orderId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !permissions.Has(roles.PermOrdersReadAny) && order.UserId != userId {
+		return nil, fmt.Errorf("no permission to access")
+	}
+
+	histories, err := u.orderRepo.FindStatusHistory(orderId)
+	if err != nil {
+		return nil, err
+	}
+	return histories, nil
+}
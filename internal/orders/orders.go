@@ -1,10 +1,15 @@
 package orders
 
 import (
+	"math"
+
 	"github.com/codepnw/go-ecommerce/internal/entities"
 	"github.com/codepnw/go-ecommerce/internal/products"
 )
 
+// SlipDestination is storage folder of transfer slips, key is slips/<order_id>/<file>
+const SlipDestination = "slips"
+
 type OrderFilter struct {
 	Search    string `query:"search"` // user_id, address, contact
 	Status    string `query:"status"`
@@ -17,12 +22,17 @@ type OrderFilter struct {
 type Order struct {
 	Id           string           `db:"id" json:"id"`
 	UserId       string           `db:"user_id" json:"user_id"`
+	CartId       string           `db:"cart_id" json:"-"`
 	TransferSlip *TransferSlip    `db:"transfer_slip" json:"transfer_slip"`
 	Products     []*ProductsOrder `json:"products"`
 	Address      string           `db:"address" json:"address"`
 	Contact      string           `db:"contact" json:"contact"`
 	Status       string           `db:"status" json:"status"`
-	TotalPaid    float64          `db:"total_paid" json:"total_paid"`
+	Subtotal     float64          `db:"subtotal" json:"subtotal"`
+	Discount     float64          `db:"discount" json:"discount"`
+	Tax          float64          `db:"tax" json:"tax"`
+	Shipping     float64          `db:"shipping" json:"shipping"`
+	TotalPaid    float64          `db:"total_paid" json:"total_paid"` // grand total
 	CreatedAt    string           `db:"created_at" json:"created_at"`
 	UpdatedAt    string           `db:"updated_at" json:"updated_at"`
 }
@@ -39,3 +49,22 @@ type ProductsOrder struct {
 	Qty     int               `db:"qty" json:"qty"`
 	Product *products.Product `db:"product" json:"product"`
 }
+
+// CalcTotals sums prices of products snapshot in the order, the products
+// must be loaded from the repository before calling it.
+func (o *Order) CalcTotals(taxRate, shippingFee float64) {
+	o.Subtotal = 0
+	for _, p := range o.Products {
+		o.Subtotal += p.Product.Price * float64(p.Qty)
+	}
+
+	o.Subtotal = roundPrice(o.Subtotal)
+	o.Discount = roundPrice(math.Min(o.Discount, o.Subtotal))
+	o.Tax = roundPrice((o.Subtotal - o.Discount) * taxRate / 100)
+	o.Shipping = roundPrice(shippingFee)
+	o.TotalPaid = roundPrice(o.Subtotal - o.Discount + o.Tax + o.Shipping)
+}
+
+func roundPrice(price float64) float64 {
+	return math.Round(price*100) / 100
+}
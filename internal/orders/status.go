@@ -0,0 +1,57 @@
+package orders
+
+import (
+	"fmt"
+
+	"github.com/codepnw/go-ecommerce/internal/roles"
+)
+
+const (
+	StatusWaiting   = "waiting"
+	StatusPaid      = "paid"
+	StatusShipping  = "shipping"
+	StatusCompleted = "completed"
+	StatusCanceled  = "canceled"
+	StatusRefunded  = "refunded"
+)
+
+type StatusHistory struct {
+	Id         string `db:"id" json:"id"`
+	OrderId    string `db:"order_id" json:"order_id"`
+	FromStatus string `db:"from_status" json:"from_status"`
+	ToStatus   string `db:"to_status" json:"to_status"`
+	ChangedBy  string `db:"changed_by" json:"changed_by"`
+	CreatedAt  string `db:"created_at" json:"created_at"`
+}
+
+// status -> next status -> permission required to change
+var statusTransitions = map[string]map[string]string{
+	StatusWaiting: {
+		StatusPaid:     roles.PermOrdersStatus,
+		StatusCanceled: roles.PermOrdersCancel,
+	},
+	StatusPaid: {
+		StatusShipping: roles.PermOrdersStatus,
+		StatusRefunded: roles.PermOrdersStatus,
+	},
+	StatusShipping: {
+		StatusCompleted: roles.PermOrdersStatus,
+	},
+	StatusCompleted: {
+		StatusRefunded: roles.PermOrdersStatus,
+	},
+	StatusCanceled: {},
+	StatusRefunded: {},
+}
+
+func IsStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+func CheckStatusTransition(from, to string, permissions roles.Permissions) error {
+	if p, ok := statusTransitions[from][to]; ok && permissions.Has(p) {
+		return nil
+	}
+	return fmt.Errorf("order status cannot change from %s to %s", from, to)
+}
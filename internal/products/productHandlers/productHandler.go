@@ -22,6 +22,9 @@ const (
 	insertProductsErrCode  productHandlerErrCode = "products-003"
 	updateProductsErrCode  productHandlerErrCode = "products-004"
 	deleteProductsErrCode  productHandlerErrCode = "products-005"
+	findStocksErrCode      productHandlerErrCode = "products-006"
+	adjustStockErrCode     productHandlerErrCode = "products-007"
+	findMovementsErrCode   productHandlerErrCode = "products-008"
 )
 
 type IProductHandler interface {
@@ -30,6 +33,9 @@ type IProductHandler interface {
 	InsertProduct(c *fiber.Ctx) error
 	UpdateProduct(c *fiber.Ctx) error
 	DeleteProduct(c *fiber.Ctx) error
+	FindStocks(c *fiber.Ctx) error
+	AdjustStock(c *fiber.Ctx) error
+	FindStockMovements(c *fiber.Ctx) error
 }
 
 type productHandler struct {
@@ -117,6 +123,14 @@ func (h *productHandler) InsertProduct(c *fiber.Ctx) error {
 		).Res()
 	}
 
+	if err := h.validateImages(req.Images); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertProductsErrCode),
+			err.Error(),
+		).Res()
+	}
+
 	product, err := h.productUsecase.InsertProduct(req)
 	if err != nil {
 		return entities.NewResponse(c).Error(
@@ -147,6 +161,14 @@ func (h *productHandler) UpdateProduct(c *fiber.Ctx) error {
 
 	req.Id = productId
 
+	if err := h.validateImages(req.Images); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateProductsErrCode),
+			err.Error(),
+		).Res()
+	}
+
 	product, err := h.productUsecase.UpdateProduct(req)
 	if err != nil {
 		return entities.NewResponse(c).Error(
@@ -173,9 +195,11 @@ func (h *productHandler) DeleteProduct(c *fiber.Ctx) error {
 
 	deleteFileReq := make([]*files.DeleteFileReq, 0)
 	for _, p := range product.Images {
-		deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
-			Destination: fmt.Sprintf("images/products/%s", p.FileName),
-		})
+		for _, name := range p.FileNames() {
+			deleteFileReq = append(deleteFileReq, &files.DeleteFileReq{
+				Destination: fmt.Sprintf("images/products/%s", name),
+			})
+		}
 	}
 
 	if err := h.filesUsecase.DeleteFileOnStorage(deleteFileReq); err != nil {
@@ -196,3 +220,102 @@ func (h *productHandler) DeleteProduct(c *fiber.Ctx) error {
 
 	return entities.NewResponse(c).Success(fiber.StatusNoContent, nil).Res()
 }
+
+func (h *productHandler) FindStocks(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+
+	stocks, err := h.productUsecase.FindStocks(productId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findStocksErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, stocks).Res()
+}
+
+func (h *productHandler) AdjustStock(c *fiber.Ctx) error {
+	req := new(products.StockAdjustReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	req.ProductId = strings.Trim(c.Params("product_id"), " ")
+	req.CreatedBy, _ = c.Locals("userId").(string)
+
+	if req.Qty == 0 {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(adjustStockErrCode),
+			"qty must not be zero",
+		).Res()
+	}
+
+	if req.WarehouseId <= 0 {
+		req.WarehouseId = products.DefaultWarehouseId
+	}
+
+	if req.Reason == "" {
+		req.Reason = products.AdjustmentStock
+	}
+
+	stocks, err := h.productUsecase.AdjustStock(req)
+	if err != nil {
+		switch err.Error() {
+		case "insufficient stock":
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(adjustStockErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(adjustStockErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, stocks).Res()
+}
+
+func (h *productHandler) FindStockMovements(c *fiber.Ctx) error {
+	productId := strings.Trim(c.Params("product_id"), " ")
+
+	movements, err := h.productUsecase.FindStockMovements(productId)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findMovementsErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, movements).Res()
+}
+
+// validateImages allows variants of image config only, file names of images
+// are used as storage keys when product is deleted
+func (h *productHandler) validateImages(images []*entities.Image) error {
+	names := make([]string, 0)
+	for _, v := range h.cfg.Image().Variants() {
+		names = append(names, v.Name)
+	}
+
+	for _, img := range images {
+		if img == nil {
+			return fmt.Errorf("image is invalid")
+		}
+		if err := img.Validate(names); err != nil {
+			return err
+		}
+	}
+	return nil
+}
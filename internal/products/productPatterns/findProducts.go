@@ -58,6 +58,12 @@ func (b *findProductBuilder) initQuery() {
 				"p"."title",
 				"p"."description",
 				"p"."price",
+				(
+					SELECT
+						COALESCE(SUM("ps"."qty"), 0)
+					FROM "products_stocks" "ps"
+					WHERE "ps"."product_id" = "p"."id"
+				) AS "stock",
 				(
 					SELECT
 						to_jsonb("ct")
@@ -79,7 +85,8 @@ func (b *findProductBuilder) initQuery() {
 						SELECT
 							"i"."id",
 							"i"."filename",
-							"i"."url"
+							"i"."url",
+							"i"."variants"
 						FROM "images" "i"
 						WHERE "i"."product_id" = "p"."id"
 					) AS "it"
@@ -2,6 +2,7 @@ package productPatterns
 
 import (
 	"context"
+	"encoding/json"
 	"database/sql"
 	"fmt"
 	"time"
@@ -14,6 +15,7 @@ type IInsertProductBuilder interface {
 	insertProduct() error
 	insertCategory() error
 	insertAttachment() error
+	insertStock() error
 	commit() error
 	getProductId() string
 }
@@ -105,6 +107,7 @@ func (b *insertProductBuilder) insertAttachment() error {
 		INSERT INTO "images" (
 			"filename",
 			"url",
+			"variants",
 			"product_id"
 		)
 		VALUES
@@ -113,19 +116,25 @@ func (b *insertProductBuilder) insertAttachment() error {
 	valueStack := make([]any, 0)
 	var index int
 	for i := range b.req.Images {
+		variants, err := json.Marshal(b.req.Images[i].Variants)
+		if err != nil || b.req.Images[i].Variants == nil {
+			variants = []byte("{}")
+		}
+
 		valueStack = append(
 			valueStack,
 			b.req.Images[i].FileName,
 			b.req.Images[i].Url,
+			string(variants),
 			b.req.Id,
 		)
 
 		if i != len(b.req.Images)-1 {
-			query += fmt.Sprintf(`	($%d, $%d, $%d),`, index+1, index+2, index+3)
+			query += fmt.Sprintf(`	($%d, $%d, $%d::jsonb, $%d),`, index+1, index+2, index+3, index+4)
 		} else {
-			query += fmt.Sprintf(`	($%d, $%d, $%d);`, index+1, index+2, index+3)
+			query += fmt.Sprintf(`	($%d, $%d, $%d::jsonb, $%d);`, index+1, index+2, index+3, index+4)
 		}
-		index += 3
+		index += 4
 	}
 
 	if _, err := b.tx.ExecContext(
@@ -140,6 +149,59 @@ func (b *insertProductBuilder) insertAttachment() error {
 	return nil
 }
 
+func (b *insertProductBuilder) insertStock() error {
+	if b.req.Stock <= 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "products_stocks" (
+			"product_id",
+			"warehouse_id",
+			"qty"
+		)
+		VALUES ($1, $2, $3);
+	`
+
+	if _, err := b.tx.ExecContext(
+		ctx,
+		query,
+		b.req.Id,
+		products.DefaultWarehouseId,
+		b.req.Stock,
+	); err != nil {
+		b.tx.Rollback()
+		return fmt.Errorf("insert products_stocks failed: %v", err)
+	}
+
+	movementQuery := `
+		INSERT INTO "stock_movements" (
+			"product_id",
+			"warehouse_id",
+			"qty",
+			"reason"
+		)
+		VALUES ($1, $2, $3, $4);
+	`
+
+	if _, err := b.tx.ExecContext(
+		ctx,
+		movementQuery,
+		b.req.Id,
+		products.DefaultWarehouseId,
+		b.req.Stock,
+		products.InitialStock,
+	); err != nil {
+		b.tx.Rollback()
+		return fmt.Errorf("insert stock_movements failed: %v", err)
+	}
+
+	return nil
+}
+
 func (b *insertProductBuilder) commit() error {
 	if err := b.tx.Commit(); err != nil {
 		return err
@@ -174,6 +236,10 @@ func (en *insertProductEngineer) InsertProduct() (string, error) {
 		return "", err
 	}
 
+	if err := en.builder.insertStock(); err != nil {
+		return "", err
+	}
+
 	if err := en.builder.commit(); err != nil {
 		return "", err
 	}
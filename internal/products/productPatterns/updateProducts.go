@@ -3,6 +3,7 @@ package productPatterns
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 
 	"github.com/codepnw/go-ecommerce/internal/entities"
@@ -134,6 +135,7 @@ func (b *updateProductBuilder) insertImages() error {
 		INSERT INTO "images" (
 			"filename",
 			"url",
+			"variants",
 			"product_id"
 		)
 		VALUES
@@ -142,19 +144,25 @@ func (b *updateProductBuilder) insertImages() error {
 	valueStack := make([]any, 0)
 	var index int
 	for i := range b.req.Images {
+		variants, err := json.Marshal(b.req.Images[i].Variants)
+		if err != nil || b.req.Images[i].Variants == nil {
+			variants = []byte("{}")
+		}
+
 		valueStack = append(
 			valueStack,
 			b.req.Images[i].FileName,
 			b.req.Images[i].Url,
+			string(variants),
 			b.req.Id,
 		)
 
 		if i != len(b.req.Images)-1 {
-			query += fmt.Sprintf(`	($%d, $%d, $%d),`, index+1, index+2, index+3)
+			query += fmt.Sprintf(`	($%d, $%d, $%d::jsonb, $%d),`, index+1, index+2, index+3, index+4)
 		} else {
-			query += fmt.Sprintf(`	($%d, $%d, $%d);`, index+1, index+2, index+3)
+			query += fmt.Sprintf(`	($%d, $%d, $%d::jsonb, $%d);`, index+1, index+2, index+3, index+4)
 		}
-		index += 3
+		index += 4
 	}
 
 	if _, err := b.tx.ExecContext(
@@ -174,7 +182,8 @@ func (b *updateProductBuilder) getOldImages() []*entities.Image {
 		SELECT
 			"id",
 			"filename",
-			"url"
+			"url",
+			"variants"
 		FROM "images"
 		WHERE "product_id" = $1;
 	`
@@ -188,9 +197,11 @@ func (b *updateProductBuilder) getOldImages() []*entities.Image {
 
 	for rows.Next() {
 		var image entities.Image
-		if err := rows.Scan(&image.Id, &image.FileName, &image.Url); err != nil {
+		variants := make([]byte, 0)
+		if err := rows.Scan(&image.Id, &image.FileName, &image.Url, &variants); err != nil {
 			return make([]*entities.Image, 0)
 		}
+		json.Unmarshal(variants, &image.Variants)
 		images = append(images, &image)
 	}
 
@@ -204,9 +215,11 @@ func (b *updateProductBuilder) deleteOldImages() error {
 	if len(images) > 0 {
 		delFileReq := make([]*files.DeleteFileReq, 0)
 		for _, img := range images {
-			delFileReq = append(delFileReq, &files.DeleteFileReq{
-				Destination: fmt.Sprintf("images/products/%s", img.FileName),
-			})
+			for _, name := range img.FileNames() {
+				delFileReq = append(delFileReq, &files.DeleteFileReq{
+					Destination: fmt.Sprintf("images/products/%s", name),
+				})
+			}
 		}
 		// Delete Images
 		if err := b.filesUsecase.DeleteFileOnStorage(delFileReq); err != nil {
@@ -5,6 +5,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
 	"github.com/codepnw/go-ecommerce/internal/entities"
@@ -19,6 +20,9 @@ type IProductRepository interface {
 	InsertProduct(req *products.Product) (*products.Product, error)
 	UpdateProduct(req *products.Product) (*products.Product, error)
 	DeleteProduct(productId string) error
+	FindStocks(productId string) ([]*products.Stock, error)
+	AdjustStock(req *products.StockAdjustReq) error
+	FindStockMovements(productId string) ([]*products.StockMovement, error)
 }
 
 type productRepository struct {
@@ -45,6 +49,12 @@ func (r *productRepository) FindOneProduct(productId string) (*products.Product,
 				"p"."title",
 				"p"."description",
 				"p"."price",
+				(
+					SELECT
+						COALESCE(SUM("ps"."qty"), 0)
+					FROM "products_stocks" "ps"
+					WHERE "ps"."product_id" = "p"."id"
+				) AS "stock",
 				(
 					SELECT
 						to_jsonb("ct")
@@ -66,7 +76,8 @@ func (r *productRepository) FindOneProduct(productId string) (*products.Product,
 						SELECT
 							"i"."id",
 							"i"."filename",
-							"i"."url"
+							"i"."url",
+							"i"."variants"
 						FROM "images" "i"
 						WHERE "i"."product_id" = "p"."id"
 					) AS "it"
@@ -145,4 +156,165 @@ func (r *productRepository) DeleteProduct(productId string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+func (r *productRepository) FindStocks(productId string) ([]*products.Stock, error) {
+	query := `
+		SELECT
+			"ps"."warehouse_id",
+			"w"."title",
+			"ps"."qty"
+		FROM "products_stocks" "ps"
+		LEFT JOIN "warehouses" "w" ON "w"."id" = "ps"."warehouse_id"
+		WHERE "ps"."product_id" = $1
+		ORDER BY "ps"."warehouse_id" ASC;
+	`
+
+	stocks := make([]*products.Stock, 0)
+
+	rows, err := r.db.Query(query, productId)
+	if err != nil {
+		return nil, fmt.Errorf("query stocks failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var stock products.Stock
+		if err := rows.Scan(&stock.WarehouseId, &stock.Warehouse, &stock.Qty); err != nil {
+			return nil, fmt.Errorf("scan stocks failed: %v", err)
+		}
+		stocks = append(stocks, &stock)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return stocks, nil
+}
+
+func (r *productRepository) AdjustStock(req *products.StockAdjustReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// Withdraw only updates a row which stays non negative, receive may create the row
+	query := `
+		UPDATE "products_stocks" SET
+			"qty" = "qty" + $3
+		WHERE "product_id" = $1
+		AND "warehouse_id" = $2
+		AND "qty" + $3 >= 0;
+	`
+	if req.Qty > 0 {
+		query = `
+			INSERT INTO "products_stocks" (
+				"product_id",
+				"warehouse_id",
+				"qty"
+			)
+			VALUES ($1, $2, $3)
+			ON CONFLICT ("product_id", "warehouse_id") DO UPDATE SET
+				"qty" = "products_stocks"."qty" + EXCLUDED."qty";
+		`
+	}
+
+	res, err := tx.ExecContext(
+		ctx,
+		query,
+		req.ProductId,
+		req.WarehouseId,
+		req.Qty,
+	)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("adjust stock failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("insufficient stock")
+	}
+
+	movementQuery := `
+		INSERT INTO "stock_movements" (
+			"product_id",
+			"warehouse_id",
+			"qty",
+			"reason",
+			"created_by"
+		)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''));
+	`
+
+	if _, err := tx.ExecContext(
+		ctx,
+		movementQuery,
+		req.ProductId,
+		req.WarehouseId,
+		req.Qty,
+		req.Reason,
+		req.CreatedBy,
+	); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert stock_movements failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return nil
+}
+
+func (r *productRepository) FindStockMovements(productId string) ([]*products.StockMovement, error) {
+	query := `
+		SELECT
+			"id",
+			"product_id",
+			"warehouse_id",
+			COALESCE("order_id", ''),
+			"qty",
+			"reason",
+			COALESCE("created_by", ''),
+			"created_at"
+		FROM "stock_movements"
+		WHERE "product_id" = $1
+		ORDER BY "created_at" DESC;
+	`
+
+	movements := make([]*products.StockMovement, 0)
+
+	rows, err := r.db.Query(query, productId)
+	if err != nil {
+		return nil, fmt.Errorf("query stock movements failed: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var movement products.StockMovement
+		if err := rows.Scan(
+			&movement.Id,
+			&movement.ProductId,
+			&movement.WarehouseId,
+			&movement.OrderId,
+			&movement.Qty,
+			&movement.Reason,
+			&movement.CreatedBy,
+			&movement.CreatedAt,
+		); err != nil {
+			return nil, fmt.Errorf("scan stock movements failed: %v", err)
+		}
+		movements = append(movements, &movement)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return movements, nil
+}
@@ -14,6 +14,9 @@ type IProductUsecase interface {
 	InsertProduct(req *products.Product) (*products.Product, error)
 	UpdateProduct(req *products.Product) (*products.Product, error)
 	DeleteProduct(productId string) error
+	FindStocks(productId string) ([]*products.Stock, error)
+	AdjustStock(req *products.StockAdjustReq) ([]*products.Stock, error)
+	FindStockMovements(productId string) ([]*products.StockMovement, error)
 }
 
 type productUsecase struct {
@@ -67,4 +70,32 @@ func (u *productUsecase) DeleteProduct(productId string) error {
 		return err
 	}
 	return nil
-}
\ No newline at end of file
+}
+
+func (u *productUsecase) FindStocks(productId string) ([]*products.Stock, error) {
+	stocks, err := u.repo.FindStocks(productId)
+	if err != nil {
+		return nil, err
+	}
+	return stocks, nil
+}
+
+func (u *productUsecase) AdjustStock(req *products.StockAdjustReq) ([]*products.Stock, error) {
+	if err := u.repo.AdjustStock(req); err != nil {
+		return nil, err
+	}
+
+	stocks, err := u.repo.FindStocks(req.ProductId)
+	if err != nil {
+		return nil, err
+	}
+	return stocks, nil
+}
+
+func (u *productUsecase) FindStockMovements(productId string) ([]*products.StockMovement, error) {
+	movements, err := u.repo.FindStockMovements(productId)
+	if err != nil {
+		return nil, err
+	}
+	return movements, nil
+}
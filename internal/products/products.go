@@ -13,12 +13,50 @@ type Product struct {
 	CreatedAt   string            `json:"created_at"`
 	UpdatedAt   string            `json:"updated_at"`
 	Price       float64           `json:"price"`
+	Stock       int               `json:"stock"`
 	Images      []*entities.Image `json:"images"`
 }
 
+// Default warehouse for products without location
+const DefaultWarehouseId = 1
+
+// Stock movement reasons
+const (
+	InitialStock       = "initial"
+	AdjustmentStock    = "adjustment"
+	OrderStock         = "order"
+	OrderCanceledStock = "order_canceled"
+	OrderRefundedStock = "order_refunded"
+)
+
 type ProductFilter struct {
 	Id     string `query:"id"`
 	Search string `query:"search"` // title & description
 	*entities.PaginationReq
 	*entities.SortReq
 }
+
+type Stock struct {
+	WarehouseId int    `db:"warehouse_id" json:"warehouse_id"`
+	Warehouse   string `db:"warehouse" json:"warehouse"`
+	Qty         int    `db:"qty" json:"qty"`
+}
+
+type StockAdjustReq struct {
+	ProductId   string `json:"-"`
+	WarehouseId int    `json:"warehouse_id" form:"warehouse_id"`
+	Qty         int    `json:"qty" form:"qty"` // + receive | - withdraw
+	Reason      string `json:"reason" form:"reason"`
+	CreatedBy   string `json:"-"`
+}
+
+type StockMovement struct {
+	Id          string `db:"id" json:"id"`
+	ProductId   string `db:"product_id" json:"product_id"`
+	WarehouseId int    `db:"warehouse_id" json:"warehouse_id"`
+	OrderId     string `db:"order_id" json:"order_id"`
+	Qty         int    `db:"qty" json:"qty"`
+	Reason      string `db:"reason" json:"reason"`
+	CreatedBy   string `db:"created_by" json:"created_by"`
+	CreatedAt   string `db:"created_at" json:"created_at"`
+}
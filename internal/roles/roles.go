@@ -0,0 +1,62 @@
+package roles
+
+// Role ids used in code, other roles are managed by admin
+const (
+	CustomerRoleId = 1
+	AdminRoleId    = 2
+)
+
+// Permission codes are resource:action, :any allows resources of other users
+const (
+	PermConfigRead      = "config:read"
+	PermRolesRead       = "roles:read"
+	PermRolesWrite      = "roles:write"
+	PermUsersReadAny    = "users:read:any"
+	PermUsersWriteAny   = "users:write:any"
+	PermUsersAdmin      = "users:admin"
+	PermApiKeyRead      = "apikey:read"
+	PermApiKeyWrite     = "apikey:write"
+	PermCategoriesWrite = "categories:write"
+	PermWarehousesRead  = "warehouses:read"
+	PermWarehousesWrite = "warehouses:write"
+	PermFilesWrite      = "files:write"
+	PermProductsWrite   = "products:write"
+	PermStocksRead      = "stocks:read"
+	PermStocksWrite     = "stocks:write"
+	PermOrdersReadAny   = "orders:read:any"
+	PermOrdersWriteAny  = "orders:write:any"
+	PermOrdersStatus    = "orders:status"
+	PermOrdersCancel    = "orders:cancel"
+)
+
+type Role struct {
+	Id          int      `db:"id" json:"id"`
+	Title       string   `db:"title" json:"title"`
+	Permissions []string `json:"permissions"`
+}
+
+type Permission struct {
+	Code        string `db:"code" json:"code"`
+	Description string `db:"description" json:"description"`
+}
+
+type UserRoleReq struct {
+	UserId string `json:"user_id"`
+	RoleId int    `json:"role_id"`
+}
+
+// Permissions is set of permission codes granted to a role
+type Permissions map[string]struct{}
+
+func NewPermissions(codes ...string) Permissions {
+	p := make(Permissions, len(codes))
+	for _, code := range codes {
+		p[code] = struct{}{}
+	}
+	return p
+}
+
+func (p Permissions) Has(code string) bool {
+	_, ok := p[code]
+	return ok
+}
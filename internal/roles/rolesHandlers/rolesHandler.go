@@ -0,0 +1,179 @@
+package rolesHandlers
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesUsecases"
+	"github.com/gofiber/fiber/v2"
+)
+
+type rolesErrCode string
+
+const (
+	findRolesErrCode       rolesErrCode = "roles-001"
+	findPermissionsErrCode rolesErrCode = "roles-002"
+	insertRoleErrCode      rolesErrCode = "roles-003"
+	updateRoleErrCode      rolesErrCode = "roles-004"
+	deleteRoleErrCode      rolesErrCode = "roles-005"
+	updateUserRoleErrCode  rolesErrCode = "roles-006"
+)
+
+type IRolesHandler interface {
+	FindRoles(c *fiber.Ctx) error
+	FindPermissions(c *fiber.Ctx) error
+	InsertRole(c *fiber.Ctx) error
+	UpdateRole(c *fiber.Ctx) error
+	DeleteRole(c *fiber.Ctx) error
+	UpdateUserRole(c *fiber.Ctx) error
+}
+
+type rolesHandler struct {
+	cfg     config.Config
+	usecase rolesUsecases.IRolesUsecase
+}
+
+func RolesHandler(cfg config.Config, usecase rolesUsecases.IRolesUsecase) IRolesHandler {
+	return &rolesHandler{
+		cfg:     cfg,
+		usecase: usecase,
+	}
+}
+
+func (h *rolesHandler) FindRoles(c *fiber.Ctx) error {
+	result, err := h.usecase.FindRoles()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findRolesErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+func (h *rolesHandler) FindPermissions(c *fiber.Ctx) error {
+	permissions, err := h.usecase.FindPermissions()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findPermissionsErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, permissions).Res()
+}
+
+func (h *rolesHandler) InsertRole(c *fiber.Ctx) error {
+	req := new(roles.Role)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(insertRoleErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.InsertRole(req); err != nil {
+		return roleError(c, insertRoleErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, req).Res()
+}
+
+func (h *rolesHandler) UpdateRole(c *fiber.Ctx) error {
+	roleId, err := strconv.Atoi(strings.Trim(c.Params("role_id"), " "))
+	if err != nil || roleId <= 0 {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateRoleErrCode),
+			"role_id is invalid",
+		).Res()
+	}
+
+	req := new(roles.Role)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateRoleErrCode),
+			err.Error(),
+		).Res()
+	}
+	req.Id = roleId
+
+	if err := h.usecase.UpdateRole(req); err != nil {
+		return roleError(c, updateRoleErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, req).Res()
+}
+
+func (h *rolesHandler) DeleteRole(c *fiber.Ctx) error {
+	roleId, err := strconv.Atoi(strings.Trim(c.Params("role_id"), " "))
+	if err != nil || roleId <= 0 {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(deleteRoleErrCode),
+			"role_id is invalid",
+		).Res()
+	}
+
+	if err := h.usecase.DeleteRole(roleId); err != nil {
+		return roleError(c, deleteRoleErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			RoleId int `json:"role_id"`
+		}{
+			RoleId: roleId,
+		},
+	).Res()
+}
+
+func (h *rolesHandler) UpdateUserRole(c *fiber.Ctx) error {
+	req := new(roles.UserRoleReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateUserRoleErrCode),
+			err.Error(),
+		).Res()
+	}
+	req.UserId = strings.Trim(c.Params("user_id"), " ")
+
+	if err := h.usecase.UpdateUserRole(req); err != nil {
+		return roleError(c, updateUserRoleErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, req).Res()
+}
+
+// roleError maps usecase errors to status code
+func roleError(c *fiber.Ctx, code rolesErrCode, err error) error {
+	status := fiber.ErrInternalServerError.Code
+	msg := err.Error()
+	switch {
+	case msg == "role not found", msg == "user not found":
+		status = fiber.ErrNotFound.Code
+	case msg == "title is required", strings.HasPrefix(msg, "permission "):
+		status = fiber.ErrBadRequest.Code
+	case msg == "built-in role cannot be deleted", msg == "role is assigned to users":
+		status = fiber.ErrConflict.Code
+	case strings.Contains(msg, "duplicate key"):
+		status = fiber.ErrConflict.Code
+		msg = "role title has been used"
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		msg,
+	).Res()
+}
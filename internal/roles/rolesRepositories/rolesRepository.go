@@ -0,0 +1,227 @@
+package rolesRepositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/roles"
+)
+
+type IRolesRepository interface {
+	FindRoles() ([]*roles.Role, error)
+	FindPermissions() ([]*roles.Permission, error)
+	InsertRole(req *roles.Role) error
+	UpdateRole(req *roles.Role) error
+	DeleteRole(id int) error
+	UpdateUserRole(req *roles.UserRoleReq) error
+}
+
+type rolesRepository struct {
+	db *sql.DB
+}
+
+func RolesRepository(db *sql.DB) IRolesRepository {
+	return &rolesRepository{db: db}
+}
+
+func (r *rolesRepository) FindRoles() ([]*roles.Role, error) {
+	query := `
+		SELECT
+			"r"."id",
+			"r"."title",
+			COALESCE(
+				array_to_json(array_agg("rp"."permission_code" ORDER BY "rp"."permission_code") FILTER (WHERE "rp"."permission_code" IS NOT NULL)),
+				'[]'::json
+			)
+		FROM "roles" "r"
+		LEFT JOIN "roles_permissions" "rp" ON "rp"."role_id" = "r"."id"
+		GROUP BY "r"."id"
+		ORDER BY "r"."id" ASC;
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query roles failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := make([]*roles.Role, 0)
+	for rows.Next() {
+		var role roles.Role
+		var permissions []byte
+		if err := rows.Scan(&role.Id, &role.Title, &permissions); err != nil {
+			return nil, fmt.Errorf("scan roles failed: %v", err)
+		}
+		if err := json.Unmarshal(permissions, &role.Permissions); err != nil {
+			return nil, fmt.Errorf("unmarshal role permissions failed: %v", err)
+		}
+		result = append(result, &role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return result, nil
+}
+
+func (r *rolesRepository) FindPermissions() ([]*roles.Permission, error) {
+	query := `
+		SELECT
+			"code",
+			"description"
+		FROM "permissions"
+		ORDER BY "code" ASC;
+	`
+
+	rows, err := r.db.Query(query)
+	if err != nil {
+		return nil, fmt.Errorf("query permissions failed: %v", err)
+	}
+	defer rows.Close()
+
+	permissions := make([]*roles.Permission, 0)
+	for rows.Next() {
+		var permission roles.Permission
+		if err := rows.Scan(&permission.Code, &permission.Description); err != nil {
+			return nil, fmt.Errorf("scan permissions failed: %v", err)
+		}
+		permissions = append(permissions, &permission)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return permissions, nil
+}
+
+func (r *rolesRepository) InsertRole(req *roles.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		INSERT INTO "roles" (
+			"title"
+		)
+		VALUES ($1)
+		RETURNING "id";
+	`
+	if err := tx.QueryRowContext(ctx, query, req.Title).Scan(&req.Id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert role failed: %v", err)
+	}
+
+	if err := insertPermissions(ctx, tx, req.Id, req.Permissions); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UpdateRole changes title if not empty, permissions are replaced if not nil
+func (r *rolesRepository) UpdateRole(req *roles.Role) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE "roles" SET
+			"title" = COALESCE(NULLIF($2, ''), "title")
+		WHERE "id" = $1;
+	`
+	res, err := tx.ExecContext(ctx, query, req.Id, req.Title)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update role failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("role not found")
+	}
+
+	if req.Permissions != nil {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "roles_permissions" WHERE "role_id" = $1;`, req.Id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("delete role permissions failed: %v", err)
+		}
+		if err := insertPermissions(ctx, tx, req.Id, req.Permissions); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func insertPermissions(ctx context.Context, tx *sql.Tx, roleId int, codes []string) error {
+	query := `
+		INSERT INTO "roles_permissions" (
+			"role_id",
+			"permission_code"
+		)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING;
+	`
+	for _, code := range codes {
+		if _, err := tx.ExecContext(ctx, query, roleId, code); err != nil {
+			return fmt.Errorf("insert role permission %s failed: %v", code, err)
+		}
+	}
+	return nil
+}
+
+func (r *rolesRepository) DeleteRole(id int) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Users are deleted with role by foreign key, so role must be unused
+	var used bool
+	if err := r.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM "users" WHERE "role_id" = $1);`, id).Scan(&used); err != nil {
+		return fmt.Errorf("find role users failed: %v", err)
+	}
+	if used {
+		return fmt.Errorf("role is assigned to users")
+	}
+
+	res, err := r.db.ExecContext(ctx, `DELETE FROM "roles" WHERE "id" = $1;`, id)
+	if err != nil {
+		return fmt.Errorf("delete role failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("role not found")
+	}
+	return nil
+}
+
+func (r *rolesRepository) UpdateUserRole(req *roles.UserRoleReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "users" SET
+			"role_id" = $2
+		WHERE "id" = $1;
+	`
+	res, err := r.db.ExecContext(ctx, query, req.UserId, req.RoleId)
+	if err != nil {
+		return fmt.Errorf("update user role failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package rolesUsecases
+
+import (
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesRepositories"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+)
+
+// Changes made by other instances are loaded after ttl
+const cacheTTL = time.Minute
+
+type IRolesUsecase interface {
+	Permissions(roleId int) (roles.Permissions, error)
+	FindRoles() ([]*roles.Role, error)
+	FindPermissions() ([]*roles.Permission, error)
+	InsertRole(req *roles.Role) error
+	UpdateRole(req *roles.Role) error
+	DeleteRole(id int) error
+	UpdateUserRole(req *roles.UserRoleReq) error
+	Invalidate()
+}
+
+type rolesUsecase struct {
+	repo   rolesRepositories.IRolesRepository
+	tokens auth.ITokenCache
+
+	mu       sync.RWMutex
+	cache    map[int]roles.Permissions
+	loadedAt time.Time
+}
+
+func RolesUsecase(repo rolesRepositories.IRolesRepository, tokens auth.ITokenCache) IRolesUsecase {
+	return &rolesUsecase{
+		repo:   repo,
+		tokens: tokens,
+	}
+}
+
+// Permissions returns permissions of role from cache, unknown role has none
+func (u *rolesUsecase) Permissions(roleId int) (roles.Permissions, error) {
+	u.mu.RLock()
+	if u.cache != nil && time.Since(u.loadedAt) < cacheTTL {
+		p := u.cache[roleId]
+		u.mu.RUnlock()
+		return p, nil
+	}
+	u.mu.RUnlock()
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	// Loaded by another request while waiting
+	if u.cache != nil && time.Since(u.loadedAt) < cacheTTL {
+		return u.cache[roleId], nil
+	}
+
+	if err := u.load(); err != nil {
+		if u.cache == nil {
+			return nil, err
+		}
+		// Database is down, stale permissions are better than none
+		slog.Warn("reload role permissions failed", slog.String("error", err.Error()))
+		return u.cache[roleId], nil
+	}
+	return u.cache[roleId], nil
+}
+
+// load must be called with mu locked
+func (u *rolesUsecase) load() error {
+	result, err := u.repo.FindRoles()
+	if err != nil {
+		return err
+	}
+
+	cache := make(map[int]roles.Permissions, len(result))
+	for _, role := range result {
+		cache[role.Id] = roles.NewPermissions(role.Permissions...)
+	}
+	u.cache = cache
+	u.loadedAt = time.Now()
+	return nil
+}
+
+// Invalidate makes next Permissions call load from database
+func (u *rolesUsecase) Invalidate() {
+	u.mu.Lock()
+	u.loadedAt = time.Time{}
+	u.mu.Unlock()
+}
+
+func (u *rolesUsecase) FindRoles() ([]*roles.Role, error) {
+	result, err := u.repo.FindRoles()
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+func (u *rolesUsecase) FindPermissions() ([]*roles.Permission, error) {
+	permissions, err := u.repo.FindPermissions()
+	if err != nil {
+		return nil, err
+	}
+	return permissions, nil
+}
+
+func (u *rolesUsecase) InsertRole(req *roles.Role) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if req.Title == "" {
+		return fmt.Errorf("title is required")
+	}
+	if err := u.checkPermissions(req.Permissions); err != nil {
+		return err
+	}
+
+	if err := u.repo.InsertRole(req); err != nil {
+		return err
+	}
+	u.Invalidate()
+	return nil
+}
+
+func (u *rolesUsecase) UpdateRole(req *roles.Role) error {
+	req.Title = strings.TrimSpace(req.Title)
+	if err := u.checkPermissions(req.Permissions); err != nil {
+		return err
+	}
+
+	if err := u.repo.UpdateRole(req); err != nil {
+		return err
+	}
+	u.Invalidate()
+	return nil
+}
+
+// DeleteRole refuses roles used in code
+func (u *rolesUsecase) DeleteRole(id int) error {
+	if id == roles.CustomerRoleId || id == roles.AdminRoleId {
+		return fmt.Errorf("built-in role cannot be deleted")
+	}
+
+	if err := u.repo.DeleteRole(id); err != nil {
+		return err
+	}
+	u.Invalidate()
+	return nil
+}
+
+// UpdateUserRole revokes access tokens of user, they carry old role id,
+// new role takes effect when user refreshes or signs in again
+func (u *rolesUsecase) UpdateUserRole(req *roles.UserRoleReq) error {
+	result, err := u.repo.FindRoles()
+	if err != nil {
+		return err
+	}
+
+	found := false
+	for _, role := range result {
+		if role.Id == req.RoleId {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("role not found")
+	}
+
+	if err := u.repo.UpdateUserRole(req); err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(req.UserId)
+	return nil
+}
+
+func (u *rolesUsecase) checkPermissions(codes []string) error {
+	if len(codes) == 0 {
+		return nil
+	}
+
+	permissions, err := u.repo.FindPermissions()
+	if err != nil {
+		return err
+	}
+
+	known := make(roles.Permissions, len(permissions))
+	for _, p := range permissions {
+		known[p.Code] = struct{}{}
+	}
+	for _, code := range codes {
+		if !known.Has(code) {
+			return fmt.Errorf("permission %s not found", code)
+		}
+	}
+	return nil
+}
@@ -1,32 +1,48 @@
 package server
 
 import (
+	"strings"
+
+	"github.com/codepnw/go-ecommerce/internal/apikeys"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysHandlers"
 	"github.com/codepnw/go-ecommerce/internal/appinfo/appinfoHandlers"
 	"github.com/codepnw/go-ecommerce/internal/appinfo/appinfoRepositories"
 	"github.com/codepnw/go-ecommerce/internal/appinfo/appinfoUsecases"
+	"github.com/codepnw/go-ecommerce/internal/carts/cartHandlers"
+	"github.com/codepnw/go-ecommerce/internal/carts/cartRepositories"
+	"github.com/codepnw/go-ecommerce/internal/carts/cartUsecases"
+	"github.com/codepnw/go-ecommerce/internal/files"
 	"github.com/codepnw/go-ecommerce/internal/files/filesHandlers"
 	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
 	"github.com/codepnw/go-ecommerce/internal/middleware"
 	"github.com/codepnw/go-ecommerce/internal/monitor"
+	"github.com/codepnw/go-ecommerce/internal/orders"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderHandlers"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderRepositories"
 	"github.com/codepnw/go-ecommerce/internal/orders/orderUsecases"
 	"github.com/codepnw/go-ecommerce/internal/products/productHandlers"
 	"github.com/codepnw/go-ecommerce/internal/products/productRepositories"
 	"github.com/codepnw/go-ecommerce/internal/products/productUsecases"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesHandlers"
 	"github.com/codepnw/go-ecommerce/internal/users/usersHandlers"
 	"github.com/codepnw/go-ecommerce/internal/users/usersRepositories"
 	"github.com/codepnw/go-ecommerce/internal/users/usersUsecases"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
 type IModuleFactory interface {
 	MonitorModule()
 	UsersModule()
+	RolesModule()
+	ApiKeysModule()
 	AppinfoModule()
 	FileModule()
 	ProductModule()
 	OrderModule()
+	CartModule()
+	AssetModule()
 }
 
 type moduleFactory struct {
@@ -46,33 +62,88 @@ func InitModule(r fiber.Router, s *server, m middleware.IMiddlewareHandler) IMod
 func InitMiddleware(s *server) middleware.IMiddlewareHandler {
 	repo := middleware.MiddlewareRepository(s.db.Get())
 	usecase := middleware.MiddlewareUsecase(repo)
-	return middleware.MiddlewareHandler(s.cfg, usecase)
+	s.sessions = usecase
+	return middleware.MiddlewareHandler(s.cfg, usecase, s.roles, s.tokens, s.apiKeys, s.limiter)
 }
 
 func (m *moduleFactory) MonitorModule() {
 	handler := monitor.MonitorHandler(m.s.cfg)
 
 	m.r.Get("/", handler.HealthCheck)
+	m.r.Get("/config", m.m.JwtAuth(), m.m.Authorize(roles.PermConfigRead), handler.EffectiveConfig)
 }
 
 func (m *moduleFactory) UsersModule() {
 	repo := usersRepositories.UsersRepository(m.s.db.Get())
-	usecase := usersUsecases.UsersUsecase(m.s.cfg, repo)
+	lockout := ratelimit.NewLockout(m.s.limiter, m.s.cfg.RateLimit())
+	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
+	usecase := usersUsecases.UsersUsecase(m.s.cfg, repo, lockout, m.s.tokens, m.s.mailer, fileUsecase)
 	handler := usersHandlers.UsersHandler(m.s.cfg, usecase)
 
 	router := m.r.Group("/users")
 
-	router.Post("/signup", m.m.ApiKeyAuth(), handler.SignUpCustomer)
-	router.Post("/signin", m.m.ApiKeyAuth(), handler.SignIn)
-	router.Post("/refresh", m.m.ApiKeyAuth(), handler.RefreshPassport)
-	router.Post("/signout", m.m.ApiKeyAuth(), handler.SignOut)
+	router.Post("/signup", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.SignUpCustomer)
+	router.Post("/signin", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.SignIn)
+	router.Post("/refresh", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.RefreshPassport)
+	router.Post("/signin/mfa", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.SignInMfa)
+	router.Post("/mfa/enroll", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.EnrollMfaByToken)
+	router.Post("/signout", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.SignOut)
+	router.Post("/verify-email", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.VerifyEmail)
+	router.Post("/verify-email/send", m.m.RateLimit(), m.m.JwtAuth(), handler.SendVerification)
+	router.Post("/forgot-password", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.ForgotPassword)
+	router.Post("/reset-password", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.ResetPassword)
+	router.Post("/change-email", m.m.RateLimit(), m.m.ApiKeyAuth(apikeys.ScopeAuth), handler.ConfirmEmailChange)
 
 	// Initial 1 admin in DB (insert sql)
 	// Generate admin key
-	router.Get("/admin/secret", m.m.JwtAuth(), m.m.Authotize(2), handler.GenerateAdminToken)
-	router.Post("/signup-admin", m.m.JwtAuth(), m.m.Authotize(2), handler.SignUpAdmin)
+	router.Get("/admin/secret", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersAdmin), handler.GenerateAdminToken)
+	router.Post("/signup-admin", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersAdmin), handler.SignUpAdmin)
+	router.Post("/:user_id/mfa/enroll-token", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersAdmin), handler.IssueMfaEnrollToken)
+
+	router.Post("/me/mfa", m.m.JwtAuth(), handler.EnrollMfa)
+	router.Post("/me/mfa/verify", m.m.RateLimit(), m.m.JwtAuth(), handler.EnableMfa)
+	router.Post("/me/mfa/recovery-codes", m.m.RateLimit(), m.m.JwtAuth(), handler.RegenerateRecoveryCodes)
+	router.Delete("/me/mfa", m.m.RateLimit(), m.m.JwtAuth(), handler.DisableMfa)
+
+	router.Patch("/me", m.m.JwtAuth(), handler.UpdateProfile)
+	router.Delete("/me", m.m.RateLimit(), m.m.JwtAuth(), handler.DeleteUser)
+	router.Post("/me/email", m.m.RateLimit(), m.m.JwtAuth(), handler.ChangeEmail)
+	router.Post("/me/password", m.m.RateLimit(), m.m.JwtAuth(), handler.ChangePassword)
 
-	router.Get("/:user_id", m.m.JwtAuth(), m.m.ParamsCheck(), handler.GetUserProfile)
+	router.Get("/me/sessions", m.m.JwtAuth(), handler.FindSessions)
+	router.Delete("/me/sessions", m.m.JwtAuth(), handler.DeleteSessions)
+	router.Delete("/me/sessions/:session_id", m.m.JwtAuth(), handler.DeleteSession)
+	router.Delete("/:user_id/sessions", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersWriteAny), handler.RevokeUserSessions)
+
+	router.Get("/", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersReadAny), handler.FindUsers)
+	router.Post("/:user_id/suspend", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersWriteAny), handler.SuspendUser)
+	router.Delete("/:user_id/suspend", m.m.JwtAuth(), m.m.Authorize(roles.PermUsersWriteAny), handler.UnsuspendUser)
+	router.Get("/:user_id", m.m.JwtAuth(), m.m.ParamsCheck(roles.PermUsersReadAny), handler.GetUserProfile)
+}
+
+func (m *moduleFactory) RolesModule() {
+	handler := rolesHandlers.RolesHandler(m.s.cfg, m.s.roles)
+
+	router := m.r.Group("/roles")
+
+	router.Get("/", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesRead), handler.FindRoles)
+	router.Post("/", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesWrite), handler.InsertRole)
+	router.Get("/permissions", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesRead), handler.FindPermissions)
+	router.Patch("/users/:user_id", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesWrite), handler.UpdateUserRole)
+	router.Patch("/:role_id", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesWrite), handler.UpdateRole)
+	router.Delete("/:role_id", m.m.JwtAuth(), m.m.Authorize(roles.PermRolesWrite), handler.DeleteRole)
+}
+
+func (m *moduleFactory) ApiKeysModule() {
+	handler := apikeysHandlers.ApiKeysHandler(m.s.cfg, m.s.apiKeys)
+
+	router := m.r.Group("/apikeys")
+
+	router.Get("/", m.m.JwtAuth(), m.m.Authorize(roles.PermApiKeyRead), handler.FindApiKeys)
+	router.Post("/", m.m.JwtAuth(), m.m.Authorize(roles.PermApiKeyWrite), handler.InsertApiKey)
+	router.Get("/:apikey_id", m.m.JwtAuth(), m.m.Authorize(roles.PermApiKeyRead), handler.FindOneApiKey)
+	router.Post("/:apikey_id/rotate", m.m.JwtAuth(), m.m.Authorize(roles.PermApiKeyWrite), handler.RotateApiKey)
+	router.Delete("/:apikey_id", m.m.JwtAuth(), m.m.Authorize(roles.PermApiKeyWrite), handler.RevokeApiKey)
 }
 
 func (m *moduleFactory) AppinfoModule() {
@@ -82,49 +153,107 @@ func (m *moduleFactory) AppinfoModule() {
 
 	router := m.r.Group("/appinfo")
 
-	router.Get("/apikey", m.m.JwtAuth(), m.m.Authotize(2), handler.GenerateApiKey)
-	router.Get("/categories", m.m.ApiKeyAuth(), handler.FindCategory)
-	router.Post("/categories", m.m.JwtAuth(), m.m.Authotize(2), handler.InsertCategory)
-	router.Delete("/categories/:id", m.m.JwtAuth(), m.m.Authotize(2), handler.DeleteCategory)
+	router.Get("/categories", m.m.ApiKeyAuth(apikeys.ScopeCategoriesRead), handler.FindCategory)
+	router.Post("/categories", m.m.JwtAuth(), m.m.Authorize(roles.PermCategoriesWrite), handler.InsertCategory)
+	router.Delete("/categories/:id", m.m.JwtAuth(), m.m.Authorize(roles.PermCategoriesWrite), handler.DeleteCategory)
+
+	router.Get("/warehouses", m.m.JwtAuth(), m.m.Authorize(roles.PermWarehousesRead), handler.FindWarehouse)
+	router.Post("/warehouses", m.m.JwtAuth(), m.m.Authorize(roles.PermWarehousesWrite), handler.InsertWarehouse)
 }
 
 func (m *moduleFactory) FileModule() {
-	usecase := filesUsecases.FilesUsecase(m.s.cfg)
+	usecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
 	handler := filesHandlers.FilesHandler(m.s.cfg, usecase)
 
 	router := m.r.Group("/files")
 
-	router.Post("/upload", m.m.JwtAuth(), m.m.Authotize(2), handler.UploadFiles)
-	router.Delete("/delete", m.m.JwtAuth(), m.m.Authotize(2), handler.DeleteFile)
+	router.Post("/upload", m.m.JwtAuth(), m.m.Authorize(roles.PermFilesWrite), handler.UploadFiles)
+	router.Delete("/delete", m.m.JwtAuth(), m.m.Authorize(roles.PermFilesWrite), handler.DeleteFile)
 }
 
 func (m *moduleFactory) ProductModule() {
-	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg)
+	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
 	repo := productRepositories.ProductRepository(m.s.db.Get(), m.s.cfg, fileUsecase)
 	usecase := productUsecases.ProductUsecase(repo)
 	handler := productHandlers.ProductHandler(m.s.cfg, usecase, fileUsecase)
 
 	router := m.r.Group("/products")
 
-	router.Get("/", m.m.ApiKeyAuth(), handler.FindAllProducts)
-	router.Post("/", m.m.JwtAuth(), m.m.Authotize(2), handler.InsertProduct)
-	router.Get("/:product_id", m.m.ApiKeyAuth(), handler.FindOneProduct)
-	router.Patch("/:product_id", m.m.JwtAuth(), m.m.Authotize(2), handler.UpdateProduct)
-	router.Delete("/:product_id", m.m.JwtAuth(), m.m.Authotize(2), handler.DeleteProduct)
+	router.Get("/", m.m.ApiKeyAuth(apikeys.ScopeProductsRead), handler.FindAllProducts)
+	router.Post("/", m.m.JwtAuth(), m.m.Authorize(roles.PermProductsWrite), handler.InsertProduct)
+	router.Get("/:product_id", m.m.ApiKeyAuth(apikeys.ScopeProductsRead), handler.FindOneProduct)
+	router.Patch("/:product_id", m.m.JwtAuth(), m.m.Authorize(roles.PermProductsWrite), handler.UpdateProduct)
+	router.Delete("/:product_id", m.m.JwtAuth(), m.m.Authorize(roles.PermProductsWrite), handler.DeleteProduct)
+
+	router.Get("/:product_id/stocks", m.m.JwtAuth(), m.m.Authorize(roles.PermStocksRead), handler.FindStocks)
+	router.Post("/:product_id/stocks", m.m.JwtAuth(), m.m.Authorize(roles.PermStocksWrite), handler.AdjustStock)
+	router.Get("/:product_id/stocks/movements", m.m.JwtAuth(), m.m.Authorize(roles.PermStocksRead), handler.FindStockMovements)
 }
 
 func (m *moduleFactory) OrderModule() {
-	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg)
+	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
 	productRepo := productRepositories.ProductRepository(m.s.db.Get(), m.s.cfg, fileUsecase)
 
 	orderRepo := orderRepositories.OrderRepository(m.s.db.Get())
-	usecase := orderUsecases.OrderUsecase(orderRepo, productRepo)
-	handler := orderHandlers.OrderHandler(m.s.cfg, usecase)
+	usecase := orderUsecases.OrderUsecase(m.s.cfg, orderRepo, productRepo)
+	handler := orderHandlers.OrderHandler(m.s.cfg, usecase, fileUsecase)
 
 	router := m.r.Group("/orders")
 
-	router.Get("/", m.m.JwtAuth(), m.m.Authotize(2), handler.FindAllOrders)
-	router.Get("/:order_id", m.m.JwtAuth(), m.m.ParamsCheck(), handler.FindOneOrder)
+	router.Get("/", m.m.JwtAuth(), m.m.Authorize(roles.PermOrdersReadAny), handler.FindAllOrders)
+	router.Get("/:order_id", m.m.JwtAuth(), m.m.ParamsCheck(roles.PermOrdersReadAny), handler.FindOneOrder)
+	router.Get("/:order_id/history", m.m.JwtAuth(), handler.FindStatusHistory)
 	router.Post("/", m.m.JwtAuth(), handler.InsertOrder)
-	router.Patch("/:user_id/:order_id", m.m.JwtAuth(), m.m.ParamsCheck(), handler.UpdateOrder)
-}
\ No newline at end of file
+	router.Patch("/:user_id/:order_id", m.m.JwtAuth(), m.m.ParamsCheck(roles.PermOrdersWriteAny), handler.UpdateOrder)
+	router.Post("/:user_id/:order_id/transfer-slip", m.m.JwtAuth(), m.m.ParamsCheck(roles.PermOrdersWriteAny), handler.UploadTransferSlip)
+}
+
+func (m *moduleFactory) CartModule() {
+	fileUsecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
+	productRepo := productRepositories.ProductRepository(m.s.db.Get(), m.s.cfg, fileUsecase)
+
+	orderRepo := orderRepositories.OrderRepository(m.s.db.Get())
+	orderUsecase := orderUsecases.OrderUsecase(m.s.cfg, orderRepo, productRepo)
+
+	cartRepo := cartRepositories.CartRepository(m.s.db.Get())
+	usecase := cartUsecases.CartUsecase(cartRepo, productRepo, orderUsecase)
+	handler := cartHandlers.CartHandler(m.s.cfg, usecase)
+
+	router := m.r.Group("/carts")
+
+	router.Get("/", m.m.JwtAuth(), handler.FindOneCart)
+	router.Delete("/", m.m.JwtAuth(), handler.ClearCart)
+	router.Post("/items", m.m.JwtAuth(), handler.InsertItem)
+	router.Patch("/items/:product_id", m.m.JwtAuth(), handler.UpdateItem)
+	router.Delete("/items/:product_id", m.m.JwtAuth(), handler.DeleteItem)
+	router.Post("/checkout", m.m.JwtAuth(), handler.Checkout)
+}
+
+func (m *moduleFactory) AssetModule() {
+	usecase := filesUsecases.FilesUsecase(m.s.cfg, m.s.storage)
+	handler := filesHandlers.FilesHandler(m.s.cfg, usecase)
+
+	// Object urls are built from storage base url, served from root
+	for _, dest := range m.s.cfg.Storage().PublicDestinations() {
+		m.s.app.Get("/"+strings.Trim(dest, "/")+"/*", handler.ServeFile)
+	}
+
+	// Transfer slips are owned by user of the order, other private
+	// destinations need files permission
+	productRepo := productRepositories.ProductRepository(m.s.db.Get(), m.s.cfg, usecase)
+	orderRepo := orderRepositories.OrderRepository(m.s.db.Get())
+	orderUsecase := orderUsecases.OrderUsecase(m.s.cfg, orderRepo, productRepo)
+
+	for _, dest := range m.s.cfg.Storage().PrivateDestinations() {
+		dest = strings.Trim(dest, "/")
+
+		var owner files.OwnerFunc
+		permission := roles.PermFilesWrite
+		if dest == orders.SlipDestination {
+			owner = orderUsecase.FindSlipOwner
+			permission = roles.PermOrdersReadAny
+		}
+
+		m.s.app.Get("/"+dest+"/*", handler.PrivateCheck(m.m.JwtAuth()), handler.OwnerCheck(owner, permission), handler.ServeFile)
+	}
+}
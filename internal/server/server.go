@@ -1,51 +1,175 @@
 package server
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysRepositories"
+	"github.com/codepnw/go-ecommerce/internal/apikeys/apikeysUsecases"
+	"github.com/codepnw/go-ecommerce/internal/middleware"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesRepositories"
+	"github.com/codepnw/go-ecommerce/internal/roles/rolesUsecases"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
 	"github.com/codepnw/go-ecommerce/pkg/database"
+	"github.com/codepnw/go-ecommerce/pkg/logger"
+	"github.com/codepnw/go-ecommerce/pkg/mailer"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
+	"github.com/codepnw/go-ecommerce/pkg/storage"
 	"github.com/gofiber/fiber/v2"
 )
 
 type Server interface {
-	Start()
+	Start() error
 	GetServer() *server
 }
 
 type server struct {
-	db  database.Service
-	app *fiber.App
-	cfg config.Config
+	db       database.Service
+	storage  storage.Storage
+	limiter  ratelimit.Store
+	mailer   mailer.Mailer
+	watcher  config.IWatcher
+	roles    rolesUsecases.IRolesUsecase
+	tokens   auth.ITokenCache
+	apiKeys  apikeysUsecases.IApiKeysUsecase
+	sessions middleware.IMiddlewareUsecase // set by InitMiddleware
+	app      *fiber.App
+	cfg      config.Config
 }
 
-func NewServer(db database.Service, cfg config.Config) Server {
+func NewServer(db database.Service, storage storage.Storage, limiter ratelimit.Store, mailer mailer.Mailer, watcher config.IWatcher, cfg config.Config) Server {
+	// Caches are shared by middleware and modules, so changes apply at once
+	tokens := auth.NewTokenCache(cfg.Jwt())
+	roles := rolesUsecases.RolesUsecase(rolesRepositories.RolesRepository(db.Get()), tokens)
+	apiKeys := apikeysUsecases.ApiKeysUsecase(apikeysRepositories.ApiKeysRepository(db.Get()), tokens)
+
 	return &server{
-		db:  db,
-		app: fiber.New(),
+		db:      db,
+		storage: storage,
+		limiter: limiter,
+		mailer:  mailer,
+		watcher: watcher,
+		roles:   roles,
+		tokens:  tokens,
+		apiKeys: apiKeys,
+		app: fiber.New(fiber.Config{
+			AppName:      cfg.App().Name(),
+			BodyLimit:    cfg.App().BodyLimit(),
+			ReadTimeout:  cfg.App().ReadTimeout(),
+			WriteTimeout: cfg.App().WriteTimeout(),
+			JSONEncoder:  json.Marshal,
+			JSONDecoder:  json.Unmarshal,
+		}),
 		cfg: cfg,
 	}
 }
 
+// jwks is standard jwk set, not wrapped in response, so jwt libraries can read it
+func jwks(cfg config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.Status(fiber.StatusOK).JSON(auth.JwksKeys(cfg.Jwt()))
+	}
+}
+
 func (s *server) GetServer() *server {
 	return s
 }
 
-func (s *server) Start() {
+// Start blocks until the server fails or SIGINT/SIGTERM is received,
+// then drains requests and closes resources
+func (s *server) Start() error {
 	middleware := InitMiddleware(s)
+
+	// Cors handlers are built before serving, fiber panics on values it can not use
+	if err := middleware.BuildCors(s.cfg.Cors()); err != nil {
+		return errors.Join(append([]error{err}, s.close()...)...)
+	}
+	s.watcher.OnValidate(func(next config.Config) error {
+		return middleware.ValidateCors(next.Cors())
+	})
+	s.watcher.OnReload(func(cfg config.Config) {
+		if err := middleware.BuildCors(cfg.Cors()); err != nil {
+			slog.Error("build cors failed", slog.String("error", err.Error()))
+		}
+	})
 	s.app.Use(middleware.Cors())
 	s.app.Use(middleware.Logger())
 
+	// Other services verify tokens by public keys, served from root
+	s.app.Get("/.well-known/jwks.json", jwks(s.cfg))
+
 	v1 := s.app.Group("v1")
 	module := InitModule(v1, s, middleware)
 
 	module.MonitorModule()
 	module.UsersModule()
+	module.RolesModule()
+	module.ApiKeysModule()
 	module.AppinfoModule()
 	module.FileModule()
 	module.ProductModule()
 	module.OrderModule()
- 
-	log.Printf("server is starting on :8080")
-	s.app.Listen(":8080")
+	module.CartModule()
+	module.AssetModule()
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(quit)
+
+	listenErr := make(chan error, 1)
+	go func() {
+		log.Printf("server is starting on %v", s.cfg.App().Url())
+		listenErr <- s.app.Listen(s.cfg.App().Url())
+	}()
+
+	errs := make([]error, 0)
+	select {
+	case err := <-listenErr:
+		if err != nil {
+			errs = append(errs, fmt.Errorf("listen on %s failed: %v", s.cfg.App().Url(), err))
+		}
+	case sig := <-quit:
+		log.Printf("server is shutting down: %v", sig)
+		if err := s.app.ShutdownWithTimeout(s.cfg.App().ShutdownTimeout()); err != nil {
+			errs = append(errs, fmt.Errorf("shutdown server failed: %v", err))
+		}
+		if err := <-listenErr; err != nil {
+			errs = append(errs, fmt.Errorf("listen on %s failed: %v", s.cfg.App().Url(), err))
+		}
+	}
+
+	return errors.Join(append(errs, s.close()...)...)
+}
+
+func (s *server) close() []error {
+	errs := make([]error, 0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.cfg.App().ShutdownTimeout())
+	defer cancel()
+
+	// Queued session usage is written before database is closed
+	if s.sessions != nil {
+		if err := s.sessions.Close(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if err := s.db.Close(); err != nil {
+		errs = append(errs, fmt.Errorf("close database failed: %v", err))
+	}
+
+	// Logger is the last one, so logs of closing are written
+	if err := logger.Flush(ctx); err != nil {
+		errs = append(errs, err)
+	}
+	return errs
 }
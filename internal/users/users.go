@@ -1,19 +1,39 @@
 package users
 
 import (
+	"crypto/rand"
+	"encoding/base32"
+	"encoding/base64"
 	"fmt"
 	"regexp"
+	"strings"
+	"time"
 
+	"github.com/codepnw/go-ecommerce/internal/entities"
 	"golang.org/x/crypto/bcrypt"
 )
 
 type User struct {
-	Id       string `db:"id" json:"id"`
-	Email    string `db:"email" json:"email"`
-	Username string `db:"username" json:"username"`
-	RoleId   int    `db:"role_id" json:"role_id"`
+	Id            string `db:"id" json:"id"`
+	Email         string `db:"email" json:"email"`
+	Username      string `db:"username" json:"username"`
+	RoleId        int    `db:"role_id" json:"role_id"`
+	EmailVerified bool   `db:"email_verified" json:"email_verified"`
+	DisplayName   string `db:"display_name" json:"display_name"`
+	Phone         string `db:"phone" json:"phone"`
+	Status        string `db:"status" json:"status"`
 }
 
+// Status of user, only active users can sign in. Deleted users are kept
+// with anonymized data, so orders still have their user
+const (
+	ActiveStatus    = "active"
+	SuspendedStatus = "suspended"
+	DeletedStatus   = "deleted"
+)
+
+var Statuses = []string{ActiveStatus, SuspendedStatus, DeletedStatus}
+
 type UserRegisterReq struct {
 	Email    string `db:"email" json:"emai" form:"email"`
 	Password string `db:"password" json:"password" form:"password"`
@@ -30,7 +50,11 @@ func (obj *UserRegisterReq) BcryptHashing() error {
 }
 
 func (obj *UserRegisterReq) IsEmail() bool {
-	match, err := regexp.MatchString(`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`, obj.Email)
+	return IsEmail(obj.Email)
+}
+
+func IsEmail(email string) bool {
+	match, err := regexp.MatchString(`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`, email)
 	if err != nil {
 		return false
 	}
@@ -43,16 +67,24 @@ type UserCredential struct {
 }
 
 type UserCredentialCheck struct {
-	Id       string `db:"id"`
-	Email    string `db:"email"`
-	Password string `db:"password"`
-	Username string `db:"username"`
-	RoleId   int    `db:"role_id"`
+	Id            string `db:"id"`
+	Email         string `db:"email"`
+	Password      string `db:"password"`
+	Username      string `db:"username"`
+	RoleId        int    `db:"role_id"`
+	EmailVerified bool   `db:"email_verified"`
+	Status        string `db:"status"`
 }
 
+// UserPassport has only Mfa when sign in needs second step,
+// RecoveryCodes are set once when mfa is enabled at sign in.
+// MfaEnroll is set for new admin who must enroll mfa before sign in
 type UserPassport struct {
-	User  *User      `json:"user"`
-	Token *UserToken `json:"token"`
+	User          *User           `json:"user"`
+	Token         *UserToken      `json:"token"`
+	Mfa           *MfaChallenge   `json:"mfa,omitempty"`
+	RecoveryCodes []string        `json:"recovery_codes,omitempty"`
+	MfaEnroll     *MfaEnrollToken `json:"mfa_enroll,omitempty"`
 }
 
 type UserToken struct {
@@ -70,11 +102,219 @@ type UserRefreshCredential struct {
 	RefreshToken string `json:"refresh_token" form:"refresh_token"`
 }
 
+// Oauth is one sign in, refresh tokens rotated from it are one token family
 type Oauth struct {
-	Id     string `db:"id" json:"id"`
-	UserId string `db:"user_id" json:"user_id"`
+	Id               string    `db:"id" json:"id"`
+	UserId           string    `db:"user_id" json:"user_id"`
+	AccessTokenHash  string    `db:"access_token_hash" json:"-"`
+	RefreshTokenHash string    `db:"refresh_token_hash" json:"-"`
+	ExpiresAt        time.Time `db:"expires_at" json:"expires_at"`
+	Expired          bool      `db:"expired" json:"-"` // compared by database clock
+	UserAgent        string    `db:"user_agent" json:"user_agent"`
+	Ip               string    `db:"ip" json:"ip"`
+}
+
+// Longer user agents are cut, header is set by client
+const MaxUserAgentLength = 512
+
+// Device is client of sign in and refresh, it is shown in sessions
+type Device struct {
+	UserAgent string
+	Ip        string
+}
+
+func NewDevice(userAgent, ip string) *Device {
+	userAgent = strings.TrimSpace(userAgent)
+	if len(userAgent) > MaxUserAgentLength {
+		userAgent = strings.ToValidUTF8(userAgent[:MaxUserAgentLength], "")
+	}
+	return &Device{
+		UserAgent: userAgent,
+		Ip:        ip,
+	}
+}
+
+// Session is oauth shown to its user, Current is session of request
+type Session struct {
+	Id              string    `db:"id" json:"id"`
+	UserAgent       string    `db:"user_agent" json:"user_agent"`
+	Ip              string    `db:"ip" json:"ip"`
+	CreatedAt       time.Time `db:"created_at" json:"created_at"`
+	LastUsedAt      time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt       time.Time `db:"expires_at" json:"expires_at"`
+	Current         bool      `json:"current"`
+	AccessTokenHash string    `db:"access_token_hash" json:"-"`
+}
+
+// Purposes of verification, a token is used once and only for its purpose
+const (
+	VerifyEmailPurpose   = "verify_email"
+	ResetPasswordPurpose = "reset_password"
+	ChangeEmailPurpose   = "change_email"
+	MfaEnrollPurpose     = "mfa_enroll"
+)
+
+// New passwords of reset are at least MinPasswordLength bytes
+const MinPasswordLength = 8
+
+// Verification is token sent by mail, only its hash is stored.
+// Token is bound to email, it is invalid after email changes
+type Verification struct {
+	Id        string    `db:"id" json:"id"`
+	UserId    string    `db:"user_id" json:"user_id"`
+	Purpose   string    `db:"purpose" json:"purpose"`
+	Email     string    `db:"email" json:"email"`
+	TokenHash string    `db:"token_hash" json:"-"`
+	ExpiresAt time.Time `db:"expires_at" json:"expires_at"`
+}
+
+// NewVerificationToken is 32 random bytes, url safe so it fits in links
+func NewVerificationToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token failed: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token" form:"token"`
+}
+
+type ForgotPasswordReq struct {
+	Email string `json:"email" form:"email"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token" form:"token"`
+	Password string `json:"password" form:"password"`
+}
+
+// Limits of profile, phone is digits with optional + and separators
+const (
+	MaxUsernameLength    = 32
+	MaxDisplayNameLength = 64
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{5,19}$`)
+
+// UpdateProfileReq changes only fields which are set, empty display_name
+// and phone clear them
+type UpdateProfileReq struct {
+	Username    *string `json:"username" form:"username"`
+	DisplayName *string `json:"display_name" form:"display_name"`
+	Phone       *string `json:"phone" form:"phone"`
+}
+
+// Validate trims fields and checks limits
+func (obj *UpdateProfileReq) Validate() error {
+	if obj.Username == nil && obj.DisplayName == nil && obj.Phone == nil {
+		return fmt.Errorf("nothing to update")
+	}
+	if obj.Username != nil {
+		*obj.Username = strings.TrimSpace(*obj.Username)
+		if *obj.Username == "" {
+			return fmt.Errorf("username is required")
+		}
+		if len(*obj.Username) > MaxUsernameLength {
+			return fmt.Errorf("username must be at most %d characters", MaxUsernameLength)
+		}
+	}
+	if obj.DisplayName != nil {
+		*obj.DisplayName = strings.TrimSpace(*obj.DisplayName)
+		if len(*obj.DisplayName) > MaxDisplayNameLength {
+			return fmt.Errorf("display_name must be at most %d characters", MaxDisplayNameLength)
+		}
+	}
+	if obj.Phone != nil {
+		*obj.Phone = strings.TrimSpace(*obj.Phone)
+		if *obj.Phone != "" && !phonePattern.MatchString(*obj.Phone) {
+			return fmt.Errorf("phone is invalid")
+		}
+	}
+	return nil
+}
+
+// ChangeEmailReq needs password, new email is used after it is verified
+type ChangeEmailReq struct {
+	Email    string `json:"email" form:"email"`
+	Password string `json:"password" form:"password"`
+}
+
+type ChangePasswordReq struct {
+	OldPassword string `json:"old_password" form:"old_password"`
+	NewPassword string `json:"new_password" form:"new_password"`
+}
+
+type DeleteUserReq struct {
+	Password string `json:"password" form:"password"`
+}
+
+type UserFilter struct {
+	Search string `query:"search"` // id, email, username, display_name
+	Status string `query:"status"`
+	*entities.PaginationReq
+	*entities.SortReq
+}
+
+// Mfa is totp of user, Secret is decrypted. Mfa is pending until first code is verified
+type Mfa struct {
+	UserId   string `db:"user_id" json:"user_id"`
+	Secret   string `db:"secret" json:"-"`
+	LastStep int64  `db:"last_step" json:"-"`
+	Enabled  bool   `db:"enabled" json:"enabled"`
+}
+
+// MfaChallenge is second step of sign in, Enroll is set when it starts by enroll token
+type MfaChallenge struct {
+	Token     string         `json:"mfa_token"`
+	ExpiresAt time.Time      `json:"expires_at"`
+	Enroll    *MfaEnrollment `json:"enroll,omitempty"`
+}
+
+// MfaEnrollment is shown once, Uri is otpauth uri for qr code
+type MfaEnrollment struct {
+	Secret string `json:"secret"`
+	Uri    string `json:"uri"`
+}
+
+// MfaEnrollToken is issued by admin for user who must enroll mfa,
+// it is handed to user out of band and used once
+type MfaEnrollToken struct {
+	Token     string    `json:"enroll_token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// MfaEnrollReq starts enrollment without session, password is checked too
+type MfaEnrollReq struct {
+	Email    string `json:"email" form:"email"`
+	Password string `json:"password" form:"password"`
+	Token    string `json:"enroll_token" form:"enroll_token"`
+}
+
+// MfaCodeReq takes totp code or recovery code
+type MfaCodeReq struct {
+	Code string `json:"code" form:"code"`
+}
+
+type MfaSignInReq struct {
+	MfaToken string `json:"mfa_token" form:"mfa_token"`
+	Code     string `json:"code" form:"code"`
+}
+
+var recoveryEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// NewRecoveryCode is 50 random bits as xxxxx-xxxxx
+func NewRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate recovery code failed: %v", err)
+	}
+	code := strings.ToLower(recoveryEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
 }
 
-type UserRemoveCredential struct {
-	OauthId string `json:"oauth_id" form:"oauth_id"`
+// NormalizeRecoveryCode ignores case, spaces and dashes of typed code
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
 }
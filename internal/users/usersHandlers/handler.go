@@ -1,6 +1,9 @@
 package usersHandlers
 
 import (
+	"errors"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/codepnw/go-ecommerce/config"
@@ -8,6 +11,7 @@ import (
 	"github.com/codepnw/go-ecommerce/internal/users"
 	"github.com/codepnw/go-ecommerce/internal/users/usersUsecases"
 	"github.com/codepnw/go-ecommerce/pkg/auth"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
 	"github.com/gofiber/fiber/v2"
 )
 
@@ -21,6 +25,29 @@ const (
 	signupAdminErrCode        userErrCode = "users-005"
 	generateAdminTokenErrCode userErrCode = "users-006"
 	getUserProfileErrCode     userErrCode = "users-007"
+	sendVerificationErrCode   userErrCode = "users-008"
+	verifyEmailErrCode        userErrCode = "users-009"
+	forgotPasswordErrCode     userErrCode = "users-010"
+	resetPasswordErrCode      userErrCode = "users-011"
+	signInMfaErrCode          userErrCode = "users-012"
+	enrollMfaErrCode          userErrCode = "users-013"
+	enableMfaErrCode          userErrCode = "users-014"
+	recoveryCodesErrCode      userErrCode = "users-015"
+	disableMfaErrCode         userErrCode = "users-016"
+	findSessionsErrCode       userErrCode = "users-017"
+	deleteSessionErrCode      userErrCode = "users-018"
+	deleteSessionsErrCode     userErrCode = "users-019"
+	revokeSessionsErrCode     userErrCode = "users-020"
+	updateProfileErrCode      userErrCode = "users-021"
+	changeEmailErrCode        userErrCode = "users-022"
+	confirmEmailErrCode       userErrCode = "users-023"
+	changePasswordErrCode     userErrCode = "users-024"
+	deleteUserErrCode         userErrCode = "users-025"
+	findUsersErrCode          userErrCode = "users-026"
+	suspendUserErrCode        userErrCode = "users-027"
+	unsuspendUserErrCode      userErrCode = "users-028"
+	issueEnrollTokenErrCode   userErrCode = "users-029"
+	enrollMfaByTokenErrCode   userErrCode = "users-030"
 )
 
 type IUsersHandler interface {
@@ -31,6 +58,29 @@ type IUsersHandler interface {
 	SignUpAdmin(c *fiber.Ctx) error
 	GenerateAdminToken(c *fiber.Ctx) error
 	GetUserProfile(c *fiber.Ctx) error
+	SendVerification(c *fiber.Ctx) error
+	VerifyEmail(c *fiber.Ctx) error
+	ForgotPassword(c *fiber.Ctx) error
+	ResetPassword(c *fiber.Ctx) error
+	SignInMfa(c *fiber.Ctx) error
+	EnrollMfa(c *fiber.Ctx) error
+	EnableMfa(c *fiber.Ctx) error
+	RegenerateRecoveryCodes(c *fiber.Ctx) error
+	DisableMfa(c *fiber.Ctx) error
+	IssueMfaEnrollToken(c *fiber.Ctx) error
+	EnrollMfaByToken(c *fiber.Ctx) error
+	FindSessions(c *fiber.Ctx) error
+	DeleteSession(c *fiber.Ctx) error
+	DeleteSessions(c *fiber.Ctx) error
+	RevokeUserSessions(c *fiber.Ctx) error
+	UpdateProfile(c *fiber.Ctx) error
+	ChangeEmail(c *fiber.Ctx) error
+	ConfirmEmailChange(c *fiber.Ctx) error
+	ChangePassword(c *fiber.Ctx) error
+	DeleteUser(c *fiber.Ctx) error
+	FindUsers(c *fiber.Ctx) error
+	SuspendUser(c *fiber.Ctx) error
+	UnsuspendUser(c *fiber.Ctx) error
 }
 
 type usersHandler struct {
@@ -112,7 +162,7 @@ func (h *usersHandler) SignUpAdmin(c *fiber.Ctx) error {
 	}
 
 	// insert customer ; error case from user patterns
-	result, err := h.usecase.InsertAdmin(req)
+	result, err := h.usecase.InsertAdmin(c.Locals("userId").(string), req)
 	if err != nil {
 		switch err.Error() {
 		case "username has been used":
@@ -149,8 +199,24 @@ func (h *usersHandler) SignIn(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	passport, err := h.usecase.GetPassport(req)
+	passport, err := h.usecase.GetPassport(req, device(c))
 	if err != nil {
+		var locked *ratelimit.LockedError
+		if errors.As(err, &locked) {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+			return entities.NewResponse(c).Error(
+				fiber.StatusTooManyRequests,
+				string(signInErrCode),
+				err.Error(),
+			).Res()
+		}
+		if err.Error() == "mfa enrollment is required" {
+			return entities.NewResponse(c).Error(
+				fiber.ErrForbidden.Code,
+				string(signInErrCode),
+				err.Error(),
+			).Res()
+		}
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
 			string(signInErrCode),
@@ -171,34 +237,53 @@ func (h *usersHandler) RefreshPassport(c *fiber.Ctx) error {
 		).Res()
 	}
 
-	passport, err := h.usecase.RefreshPassport(req)
+	passport, err := h.usecase.RefreshPassport(req, device(c))
 	if err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(refreshErrCode),
-			err.Error(),
-		).Res()
+		switch err.Error() {
+		case "refresh token has been reused", "session has expired":
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(refreshErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(refreshErrCode),
+				err.Error(),
+			).Res()
+		}
 	}
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
 }
 
+// SignOut deletes session of refresh token, access token may have expired already
 func (h *usersHandler) SignOut(c *fiber.Ctx) error {
-	req := new(users.UserRemoveCredential)
+	req := new(users.UserRefreshCredential)
 	if err := c.BodyParser(req); err != nil {
 		return entities.NewResponse(c).Error(
 			fiber.ErrBadRequest.Code,
-			string(signInErrCode),
+			string(signoutErrCode),
 			err.Error(),
 		).Res()
 	}
 
-	if err := h.usecase.DeleteOauth(req.OauthId); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signInErrCode),
-			err.Error(),
-		).Res()
+	if err := h.usecase.SignOut(req); err != nil {
+		switch err.Error() {
+		case "session not found":
+			return entities.NewResponse(c).Error(
+				fiber.ErrUnauthorized.Code,
+				string(signoutErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrBadRequest.Code,
+				string(signoutErrCode),
+				err.Error(),
+			).Res()
+		}
 	}
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
@@ -215,12 +300,21 @@ func (h *usersHandler) GenerateAdminToken(c *fiber.Ctx) error {
 		).Res()
 	}
 
+	token, err := adminToken.SignToken()
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.StatusInternalServerError,
+			string(generateAdminTokenErrCode),
+			err.Error(),
+		).Res()
+	}
+
 	return entities.NewResponse(c).Success(
 		fiber.StatusOK,
 		&struct {
 			Token string `json:"token"`
 		}{
-			Token: adminToken.SignToken(),
+			Token: token,
 		},
 	).Res()
 }
@@ -249,3 +343,603 @@ func (h *usersHandler) GetUserProfile(c *fiber.Ctx) error {
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
+
+func (h *usersHandler) SendVerification(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	if err := h.usecase.SendVerification(userId); err != nil {
+		switch err.Error() {
+		case "email has been verified":
+			return entities.NewResponse(c).Error(
+				fiber.ErrConflict.Code,
+				string(sendVerificationErrCode),
+				err.Error(),
+			).Res()
+		default:
+			return entities.NewResponse(c).Error(
+				fiber.ErrInternalServerError.Code,
+				string(sendVerificationErrCode),
+				err.Error(),
+			).Res()
+		}
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusAccepted, nil).Res()
+}
+
+func (h *usersHandler) VerifyEmail(c *fiber.Ctx) error {
+	req := new(users.VerifyEmailReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(verifyEmailErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.VerifyEmail(req); err != nil {
+		return verificationError(c, verifyEmailErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// ForgotPassword is accepted for unknown email too
+func (h *usersHandler) ForgotPassword(c *fiber.Ctx) error {
+	req := new(users.ForgotPasswordReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(forgotPasswordErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.ForgotPassword(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(forgotPasswordErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusAccepted, nil).Res()
+}
+
+func (h *usersHandler) ResetPassword(c *fiber.Ctx) error {
+	req := new(users.ResetPasswordReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(resetPasswordErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.ResetPassword(req, device(c)); err != nil {
+		return verificationError(c, resetPasswordErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// verificationError maps errors of verify email and reset password to status code
+func verificationError(c *fiber.Ctx, code userErrCode, err error) error {
+	status := fiber.ErrInternalServerError.Code
+	switch msg := err.Error(); {
+	case msg == "token is required", msg == "token is invalid or expired", strings.HasPrefix(msg, "password must be"):
+		status = fiber.ErrBadRequest.Code
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		err.Error(),
+	).Res()
+}
+
+// SignInMfa is second step of sign in, mfa_token is from SignIn
+func (h *usersHandler) SignInMfa(c *fiber.Ctx) error {
+	req := new(users.MfaSignInReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(signInMfaErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	passport, err := h.usecase.SignInMfa(req, device(c))
+	if err != nil {
+		return mfaError(c, signInMfaErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
+}
+
+func (h *usersHandler) EnrollMfa(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	enrollment, err := h.usecase.EnrollMfa(userId)
+	if err != nil {
+		return mfaError(c, enrollMfaErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, enrollment).Res()
+}
+
+func (h *usersHandler) EnableMfa(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.MfaCodeReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(enableMfaErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	codes, err := h.usecase.EnableMfa(userId, req)
+	if err != nil {
+		return mfaError(c, enableMfaErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{
+			RecoveryCodes: codes,
+		},
+	).Res()
+}
+
+func (h *usersHandler) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.MfaCodeReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(recoveryCodesErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	codes, err := h.usecase.RegenerateRecoveryCodes(userId, req)
+	if err != nil {
+		return mfaError(c, recoveryCodesErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			RecoveryCodes []string `json:"recovery_codes"`
+		}{
+			RecoveryCodes: codes,
+		},
+	).Res()
+}
+
+func (h *usersHandler) DisableMfa(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.MfaCodeReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(disableMfaErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.DisableMfa(userId, req); err != nil {
+		return mfaError(c, disableMfaErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// IssueMfaEnrollToken is for admin who must use mfa, token is handed over out of band
+func (h *usersHandler) IssueMfaEnrollToken(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(string)
+	userId := strings.Trim(c.Params("user_id"), " ")
+
+	token, err := h.usecase.IssueMfaEnrollToken(adminId, userId)
+	if err != nil {
+		return mfaError(c, issueEnrollTokenErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusCreated, token).Res()
+}
+
+// EnrollMfaByToken replaces sign in for admin who must enroll, code of the
+// challenge is sent to SignInMfa
+func (h *usersHandler) EnrollMfaByToken(c *fiber.Ctx) error {
+	req := new(users.MfaEnrollReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(enrollMfaByTokenErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	challenge, err := h.usecase.EnrollMfaByToken(req)
+	if err != nil {
+		return mfaError(c, enrollMfaByTokenErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, &users.UserPassport{Mfa: challenge}).Res()
+}
+
+// mfaError maps mfa errors to status code, lockout has Retry-After like SignIn
+func mfaError(c *fiber.Ctx, code userErrCode, err error) error {
+	var locked *ratelimit.LockedError
+	if errors.As(err, &locked) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		return entities.NewResponse(c).Error(
+			fiber.StatusTooManyRequests,
+			string(code),
+			err.Error(),
+		).Res()
+	}
+
+	status := fiber.ErrInternalServerError.Code
+	switch msg := err.Error(); {
+	case msg == "code is invalid", msg == "password is invalid", msg == "token is not mfa token", strings.HasPrefix(msg, "token "), strings.HasPrefix(msg, "parse token failed"):
+		status = fiber.ErrUnauthorized.Code
+	case msg == "mfa not found":
+		status = fiber.ErrNotFound.Code
+	case msg == "mfa has been enabled", msg == "mfa is required for admin", msg == "mfa is not required for user", msg == "can not issue enroll token for yourself", strings.HasPrefix(msg, "user is "):
+		status = fiber.ErrConflict.Code
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		err.Error(),
+	).Res()
+}
+
+// device is client of request, it is stored with session
+func device(c *fiber.Ctx) *users.Device {
+	return users.NewDevice(c.Get(fiber.HeaderUserAgent), c.IP())
+}
+
+func (h *usersHandler) FindSessions(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	accessToken := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+
+	sessions, err := h.usecase.FindSessions(userId, accessToken)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findSessionsErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, sessions).Res()
+}
+
+func (h *usersHandler) DeleteSession(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+	sessionId := strings.Trim(c.Params("session_id"), " ")
+
+	if err := h.usecase.DeleteSession(userId, sessionId); err != nil {
+		return sessionError(c, deleteSessionErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			SessionId string `json:"session_id"`
+		}{
+			SessionId: sessionId,
+		},
+	).Res()
+}
+
+// DeleteSessions signs out everywhere, session of request too
+func (h *usersHandler) DeleteSessions(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	if err := h.usecase.DeleteSessions(userId); err != nil {
+		return sessionError(c, deleteSessionsErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// RevokeUserSessions signs out other user everywhere, e.g. when account is compromised
+func (h *usersHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	userId := strings.Trim(c.Params("user_id"), " ")
+
+	if err := h.usecase.DeleteSessions(userId); err != nil {
+		return sessionError(c, revokeSessionsErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			UserId string `json:"user_id"`
+		}{
+			UserId: userId,
+		},
+	).Res()
+}
+
+// sessionError maps session errors to status code
+func sessionError(c *fiber.Ctx, code userErrCode, err error) error {
+	status := fiber.ErrInternalServerError.Code
+	msg := err.Error()
+	switch {
+	case msg == "session id is required":
+		status = fiber.ErrBadRequest.Code
+	case msg == "session not found":
+		status = fiber.ErrNotFound.Code
+	case strings.HasSuffix(msg, "no rows in result set"):
+		status = fiber.ErrNotFound.Code
+		msg = "user not found"
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		msg,
+	).Res()
+}
+
+// UpdateProfile changes only fields in body
+func (h *usersHandler) UpdateProfile(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.UpdateProfileReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(updateProfileErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	profile, err := h.usecase.UpdateProfile(userId, req)
+	if err != nil {
+		return accountError(c, updateProfileErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, profile).Res()
+}
+
+// ChangeEmail is accepted when mail is sent to new email, email is not changed yet
+func (h *usersHandler) ChangeEmail(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.ChangeEmailReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(changeEmailErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.ChangeEmail(userId, req); err != nil {
+		return accountError(c, changeEmailErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusAccepted, nil).Res()
+}
+
+func (h *usersHandler) ConfirmEmailChange(c *fiber.Ctx) error {
+	req := new(users.VerifyEmailReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(confirmEmailErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.ConfirmEmailChange(req); err != nil {
+		return accountError(c, confirmEmailErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// ChangePassword signs out all sessions, session of request too
+func (h *usersHandler) ChangePassword(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.ChangePasswordReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(changePasswordErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.ChangePassword(userId, req); err != nil {
+		return accountError(c, changePasswordErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+// DeleteUser deletes account of signed in user, orders are kept anonymized
+func (h *usersHandler) DeleteUser(c *fiber.Ctx) error {
+	userId := c.Locals("userId").(string)
+
+	req := new(users.DeleteUserReq)
+	if err := c.BodyParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(deleteUserErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	if err := h.usecase.DeleteUser(userId, req); err != nil {
+		return accountError(c, deleteUserErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
+}
+
+func (h *usersHandler) FindUsers(c *fiber.Ctx) error {
+	req := &users.UserFilter{
+		SortReq:       &entities.SortReq{},
+		PaginationReq: &entities.PaginationReq{},
+	}
+
+	if err := c.QueryParser(req); err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findUsersErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	// Paginate
+	if req.Page < 1 {
+		req.Page = 1
+	}
+	if req.Limit < 5 {
+		req.Limit = 5
+	}
+	if req.Limit > 100 {
+		req.Limit = 100
+	}
+
+	// Sort
+	orderByMap := map[string]string{
+		"id":         `"id"`,
+		"username":   `"username"`,
+		"created_at": `"created_at"`,
+	}
+	if orderByMap[req.OrderBy] == "" {
+		req.OrderBy = "id"
+	}
+	req.OrderBy = orderByMap[req.OrderBy]
+
+	req.Sort = strings.ToUpper(req.Sort)
+	if req.Sort != "ASC" && req.Sort != "DESC" {
+		req.Sort = "DESC"
+	}
+
+	req.Search = strings.TrimSpace(req.Search)
+	req.Status = strings.ToLower(strings.TrimSpace(req.Status))
+	if req.Status != "" && !contains(users.Statuses, req.Status) {
+		return entities.NewResponse(c).Error(
+			fiber.ErrBadRequest.Code,
+			string(findUsersErrCode),
+			"status is invalid",
+		).Res()
+	}
+
+	result, err := h.usecase.FindUsers(req)
+	if err != nil {
+		return entities.NewResponse(c).Error(
+			fiber.ErrInternalServerError.Code,
+			string(findUsersErrCode),
+			err.Error(),
+		).Res()
+	}
+
+	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
+}
+
+// SuspendUser signs out user everywhere, user can not sign in until unsuspended
+func (h *usersHandler) SuspendUser(c *fiber.Ctx) error {
+	adminId := c.Locals("userId").(string)
+	userId := strings.Trim(c.Params("user_id"), " ")
+
+	if err := h.usecase.SuspendUser(adminId, userId); err != nil {
+		return accountError(c, suspendUserErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			UserId string `json:"user_id"`
+			Status string `json:"status"`
+		}{
+			UserId: userId,
+			Status: users.SuspendedStatus,
+		},
+	).Res()
+}
+
+func (h *usersHandler) UnsuspendUser(c *fiber.Ctx) error {
+	userId := strings.Trim(c.Params("user_id"), " ")
+
+	if err := h.usecase.UnsuspendUser(userId); err != nil {
+		return accountError(c, unsuspendUserErrCode, err)
+	}
+
+	return entities.NewResponse(c).Success(
+		fiber.StatusOK,
+		&struct {
+			UserId string `json:"user_id"`
+			Status string `json:"status"`
+		}{
+			UserId: userId,
+			Status: users.ActiveStatus,
+		},
+	).Res()
+}
+
+// accountError maps profile and account errors to status code, lockout has Retry-After like SignIn
+func accountError(c *fiber.Ctx, code userErrCode, err error) error {
+	var locked *ratelimit.LockedError
+	if errors.As(err, &locked) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		return entities.NewResponse(c).Error(
+			fiber.StatusTooManyRequests,
+			string(code),
+			err.Error(),
+		).Res()
+	}
+
+	status := fiber.ErrInternalServerError.Code
+	switch msg := err.Error(); {
+	case msg == "user not found":
+		status = fiber.ErrNotFound.Code
+	case msg == "username has been used",
+		msg == "email has been used",
+		msg == "email is not changed",
+		msg == "admin can not be deleted",
+		msg == "can not suspend yourself",
+		strings.HasPrefix(msg, "user is "):
+		status = fiber.ErrConflict.Code
+	case msg == "nothing to update",
+		msg == "password is invalid",
+		msg == "phone is invalid",
+		msg == "email pattern is invalid",
+		msg == "token is required",
+		msg == "token is invalid or expired",
+		strings.HasPrefix(msg, "username "),
+		strings.HasPrefix(msg, "display_name "),
+		strings.HasPrefix(msg, "password must be"):
+		status = fiber.ErrBadRequest.Code
+	}
+
+	return entities.NewResponse(c).Error(
+		status,
+		string(code),
+		err.Error(),
+	).Res()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -138,7 +138,11 @@ func (u *userReq) Result() (*users.UserPassport, error) {
 				"u"."id",
 				"u"."email",
 				"u"."username",
-				"u"."role_id"
+				"u"."role_id",
+				("u"."email_verified_at" IS NOT NULL) AS "email_verified",
+				"u"."display_name",
+				"u"."phone",
+				"u"."status"
 			FROM "users" "u"
 			WHERE "u"."id" = $1
 		) AS "t"
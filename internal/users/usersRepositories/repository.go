@@ -4,8 +4,10 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/codepnw/go-ecommerce/internal/orders"
 	"github.com/codepnw/go-ecommerce/internal/users"
 	"github.com/codepnw/go-ecommerce/internal/users/usersPatterns"
 )
@@ -13,11 +15,33 @@ import (
 type IUsersRepository interface {
 	InsertUser(req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error)
 	FindOneUserByEmail(email string) (*users.UserCredentialCheck, error)
-	InsertOauth(req *users.UserPassport) error
-	FindOneOauth(refreshToken string) (*users.Oauth, error)
-	UpdateOauth(req *users.UserToken) error
+	FindOneUserById(userId string) (*users.UserCredentialCheck, error)
+	FindUsers(req *users.UserFilter) ([]*users.User, int, error)
+	InsertOauth(req *users.Oauth) error
+	FindOneOauth(refreshTokenHash string) (*users.Oauth, error)
+	FindUsedOauth(refreshTokenHash string) (*users.Oauth, error)
+	RotateOauth(req *users.Oauth, usedTokenHash string) error
 	GetProfile(userId string) (*users.User, error)
-	DeleteOauth(oauthId string) error
+	DeleteOauth(oauthId string) (string, error)
+	FindSessions(userId string) ([]*users.Session, error)
+	DeleteSession(userId, oauthId string) (string, error)
+	DeleteSessions(userId string) error
+	InsertVerification(req *users.Verification) error
+	VerifyEmail(tokenHash string) (*users.Verification, error)
+	ResetPassword(tokenHash, password string) (*users.Verification, error)
+	FindMfa(userId string) (*users.Mfa, error)
+	UpsertMfa(req *users.Mfa) error
+	EnableMfa(userId string, step int64, codeHashes []string) error
+	UseMfaStep(userId string, step int64) error
+	UseRecoveryCode(userId, codeHash string) error
+	ReplaceRecoveryCodes(userId string, codeHashes []string) error
+	DeleteMfa(userId string) error
+	UseMfaEnrollToken(userId, tokenHash string) error
+	UpdateProfile(userId string, req *users.UpdateProfileReq) error
+	ChangeEmail(tokenHash string) (*users.Verification, string, error)
+	ChangePassword(userId, password string) error
+	UpdateStatus(userId, status string) error
+	DeleteUser(userId string) ([]string, error)
 }
 
 type usersRepository struct {
@@ -59,14 +83,16 @@ func (r *usersRepository) FindOneUserByEmail(email string) (*users.UserCredentia
 			"email",
 			"password",
 			"username",
-			"role_id"
+			"role_id",
+			"email_verified_at" IS NOT NULL,
+			"status"
 		FROM "users"
 		WHERE "email" = $1;
 	`
 
 	user := new(users.UserCredentialCheck)
 
-	err := r.db.QueryRow(query, email).Scan(&user.Id, &user.Email, &user.Password, &user.Username, &user.RoleId)
+	err := r.db.QueryRow(query, email).Scan(&user.Id, &user.Email, &user.Password, &user.Username, &user.RoleId, &user.EmailVerified, &user.Status)
 	if err != nil {
 		return nil, fmt.Errorf("user not found")
 	}
@@ -74,27 +100,149 @@ func (r *usersRepository) FindOneUserByEmail(email string) (*users.UserCredentia
 	return user, nil
 }
 
-func (r *usersRepository) InsertOauth(req *users.UserPassport) error {
+func (r *usersRepository) FindOneUserById(userId string) (*users.UserCredentialCheck, error) {
+	query := `
+		SELECT
+			"id",
+			"email",
+			"password",
+			"username",
+			"role_id",
+			"email_verified_at" IS NOT NULL,
+			"status"
+		FROM "users"
+		WHERE "id" = $1;
+	`
+
+	user := new(users.UserCredentialCheck)
+	if err := r.db.QueryRow(query, userId).Scan(
+		&user.Id,
+		&user.Email,
+		&user.Password,
+		&user.Username,
+		&user.RoleId,
+		&user.EmailVerified,
+		&user.Status,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("user not found")
+		}
+		return nil, fmt.Errorf("get user failed: %v", err)
+	}
+
+	return user, nil
+}
+
+// FindUsers filters by search and status, OrderBy and Sort are checked by handler
+func (r *usersRepository) FindUsers(req *users.UserFilter) ([]*users.User, int, error) {
+	where := `
+		WHERE 1 = 1
+	`
+	values := make([]any, 0)
+	if req.Search != "" {
+		values = append(values, "%"+strings.ToLower(req.Search)+"%")
+		where += fmt.Sprintf(`
+		AND (
+			LOWER("id") LIKE $%[1]d OR
+			LOWER("email") LIKE $%[1]d OR
+			LOWER("username") LIKE $%[1]d OR
+			LOWER("display_name") LIKE $%[1]d
+		)`, len(values))
+	}
+	if req.Status != "" {
+		values = append(values, req.Status)
+		where += fmt.Sprintf(`
+		AND "status" = $%d`, len(values))
+	}
+
+	var count int
+	if err := r.db.QueryRow(`SELECT COUNT(*) FROM "users"`+where+`;`, values...).Scan(&count); err != nil {
+		return nil, 0, fmt.Errorf("count users failed: %v", err)
+	}
+
+	query := `
+		SELECT
+			"id",
+			"email",
+			"username",
+			"role_id",
+			"email_verified_at" IS NOT NULL,
+			"display_name",
+			"phone",
+			"status"
+		FROM "users"` + where + fmt.Sprintf(`
+		ORDER BY %s %s, "id" ASC
+		OFFSET $%d LIMIT $%d;`,
+		req.OrderBy,
+		req.Sort,
+		len(values)+1,
+		len(values)+2,
+	)
+	values = append(values, (req.Page-1)*req.Limit, req.Limit)
+
+	rows, err := r.db.Query(query, values...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("query users failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := make([]*users.User, 0)
+	for rows.Next() {
+		user := new(users.User)
+		if err := rows.Scan(
+			&user.Id,
+			&user.Email,
+			&user.Username,
+			&user.RoleId,
+			&user.EmailVerified,
+			&user.DisplayName,
+			&user.Phone,
+			&user.Status,
+		); err != nil {
+			return nil, 0, fmt.Errorf("scan users failed: %v", err)
+		}
+		result = append(result, user)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, 0, fmt.Errorf("rows error: %v", err)
+	}
+
+	return result, count, nil
+}
+
+// InsertOauth also deletes expired oauth of user
+func (r *usersRepository) InsertOauth(req *users.Oauth) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM "oauth" WHERE "user_id" = $1 AND "expires_at" < now();`, req.UserId); err != nil {
+		return fmt.Errorf("delete expired oauth failed: %v", err)
+	}
+
 	query := `
 		INSERT INTO "oauth" (
 			"user_id",
-			"access_token",
-			"refresh_token"
+			"access_token_hash",
+			"refresh_token_hash",
+			"expires_at",
+			"user_agent",
+			"ip"
 		)
-		VALUES ($1, $2, $3)
+		VALUES ($1, $2, $3, $4, $5, $6)
 		RETURNING "id";
 	`
 
 	err := r.db.QueryRowContext(
 		ctx,
 		query,
-		req.User.Id,
-		req.Token.AccessToken,
-		req.Token.RefreshToken,
-	).Scan(&req.Token.Id)
+		req.UserId,
+		req.AccessTokenHash,
+		req.RefreshTokenHash,
+		req.ExpiresAt,
+		req.UserAgent,
+		req.Ip,
+	).Scan(&req.Id)
 
 	if err != nil {
 		return fmt.Errorf("insert oauth failed: %v", err)
@@ -103,36 +251,110 @@ func (r *usersRepository) InsertOauth(req *users.UserPassport) error {
 	return nil
 }
 
-func (r *usersRepository) FindOneOauth(refreshToken string) (*users.Oauth, error) {
+func (r *usersRepository) FindOneOauth(refreshTokenHash string) (*users.Oauth, error) {
 	query := `
 		SELECT
 			"id",
-			"user_id"
+			"user_id",
+			"access_token_hash",
+			"refresh_token_hash",
+			"expires_at",
+			"expires_at" <= now()
 		FROM "oauth"
-		WHERE "refresh_token" = $1;
+		WHERE "refresh_token_hash" = $1;
 	`
 
 	oauth := new(users.Oauth)
-	if err := r.db.QueryRow(query, refreshToken).Scan(&oauth); err != nil {
+	err := r.db.QueryRow(query, refreshTokenHash).Scan(
+		&oauth.Id,
+		&oauth.UserId,
+		&oauth.AccessTokenHash,
+		&oauth.RefreshTokenHash,
+		&oauth.ExpiresAt,
+		&oauth.Expired,
+	)
+	if err != nil {
 		return nil, fmt.Errorf("oauth not found")
 	}
 
 	return oauth, nil
 }
 
-func (r *usersRepository) UpdateOauth(req *users.UserToken) error {
+// FindUsedOauth finds oauth of refresh token which was rotated already
+func (r *usersRepository) FindUsedOauth(refreshTokenHash string) (*users.Oauth, error) {
 	query := `
-		UPDATE "oauth" SET
-			"access_token" = :access_token,
-			"refresh_token" = :refresh_token
-		WHERE "id" = :id;
+		SELECT
+			"o"."id",
+			"o"."user_id",
+			"o"."access_token_hash",
+			"o"."refresh_token_hash",
+			"o"."expires_at",
+			"o"."expires_at" <= now()
+		FROM "oauth_used_tokens" "u"
+		JOIN "oauth" "o" ON "o"."id" = "u"."oauth_id"
+		WHERE "u"."token_hash" = $1;
 	`
 
-	if _, err := r.db.ExecContext(context.Background(), query, req); err != nil {
+	oauth := new(users.Oauth)
+	err := r.db.QueryRow(query, refreshTokenHash).Scan(
+		&oauth.Id,
+		&oauth.UserId,
+		&oauth.AccessTokenHash,
+		&oauth.RefreshTokenHash,
+		&oauth.ExpiresAt,
+		&oauth.Expired,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("oauth not found")
+	}
+
+	return oauth, nil
+}
+
+// RotateOauth replaces tokens only if used token is still current,
+// so one of concurrent refreshes with same token wins. Device is of last refresh
+func (r *usersRepository) RotateOauth(req *users.Oauth, usedTokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE "oauth" SET
+			"access_token_hash" = $3,
+			"refresh_token_hash" = $4,
+			"user_agent" = $5,
+			"ip" = $6,
+			"last_used_at" = now()
+		WHERE "id" = $1
+		AND "refresh_token_hash" = $2;
+	`
+	res, err := tx.ExecContext(ctx, query, req.Id, usedTokenHash, req.AccessTokenHash, req.RefreshTokenHash, req.UserAgent, req.Ip)
+	if err != nil {
+		tx.Rollback()
 		return fmt.Errorf("update oauth failed: %v", err)
 	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("refresh token has been reused")
+	}
 
-	return nil
+	query = `
+		INSERT INTO "oauth_used_tokens" (
+			"token_hash",
+			"oauth_id"
+		)
+		VALUES ($1, $2);
+	`
+	if _, err := tx.ExecContext(ctx, query, usedTokenHash, req.Id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert used token failed: %v", err)
+	}
+
+	return tx.Commit()
 }
 
 func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
@@ -141,7 +363,11 @@ func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
 			"id",
 			"email",
 			"username",
-			"role_id"
+			"role_id",
+			"email_verified_at" IS NOT NULL,
+			"display_name",
+			"phone",
+			"status"
 		FROM "users"
 		WHERE "id" = $1;
 	`
@@ -153,6 +379,10 @@ func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
 		&profile.Email,
 		&profile.Username,
 		&profile.RoleId,
+		&profile.EmailVerified,
+		&profile.DisplayName,
+		&profile.Phone,
+		&profile.Status,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get user failed: %v", err)
@@ -161,12 +391,723 @@ func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
 	return profile, nil
 }
 
-func (r *usersRepository) DeleteOauth(oauthId string) error {
-	query := `DELETE FROM "oauth" WHERE "id" = $1;`
+// DeleteOauth deletes token family, access token hash is returned so it can be revoked
+func (r *usersRepository) DeleteOauth(oauthId string) (string, error) {
+	query := `DELETE FROM "oauth" WHERE "id" = $1 RETURNING "access_token_hash";`
+
+	var accessTokenHash string
+	if err := r.db.QueryRowContext(context.Background(), query, oauthId).Scan(&accessTokenHash); err != nil {
+		return "", fmt.Errorf("oauth not found")
+	}
+
+	return accessTokenHash, nil
+}
+
+// FindSessions returns oauth of user which are not expired, last used first
+func (r *usersRepository) FindSessions(userId string) ([]*users.Session, error) {
+	query := `
+		SELECT
+			"id",
+			"user_agent",
+			"ip",
+			"created_at",
+			"last_used_at",
+			"expires_at",
+			"access_token_hash"
+		FROM "oauth"
+		WHERE "user_id" = $1
+		AND "expires_at" > now()
+		ORDER BY "last_used_at" DESC;
+	`
+
+	rows, err := r.db.Query(query, userId)
+	if err != nil {
+		return nil, fmt.Errorf("query sessions failed: %v", err)
+	}
+	defer rows.Close()
+
+	result := make([]*users.Session, 0)
+	for rows.Next() {
+		session := new(users.Session)
+		if err := rows.Scan(
+			&session.Id,
+			&session.UserAgent,
+			&session.Ip,
+			&session.CreatedAt,
+			&session.LastUsedAt,
+			&session.ExpiresAt,
+			&session.AccessTokenHash,
+		); err != nil {
+			return nil, fmt.Errorf("scan sessions failed: %v", err)
+		}
+		result = append(result, session)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error: %v", err)
+	}
+
+	return result, nil
+}
+
+// DeleteSession is DeleteOauth of owner, oauth of other users is not found
+func (r *usersRepository) DeleteSession(userId, oauthId string) (string, error) {
+	query := `
+		DELETE FROM "oauth"
+		WHERE "id"::TEXT = $1
+		AND "user_id" = $2
+		RETURNING "access_token_hash";
+	`
 
-	if _, err := r.db.ExecContext(context.Background(), query, oauthId); err != nil {
-		return fmt.Errorf("oauth not found")
+	var accessTokenHash string
+	if err := r.db.QueryRowContext(context.Background(), query, oauthId, userId).Scan(&accessTokenHash); err != nil {
+		if err == sql.ErrNoRows {
+			return "", fmt.Errorf("session not found")
+		}
+		return "", fmt.Errorf("delete session failed: %v", err)
 	}
 
+	return accessTokenHash, nil
+}
+
+func (r *usersRepository) DeleteSessions(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM "oauth" WHERE "user_id" = $1;`, userId); err != nil {
+		return fmt.Errorf("delete sessions failed: %v", err)
+	}
 	return nil
-}
\ No newline at end of file
+}
+
+// InsertVerification deletes unused tokens of same purpose, only the last one sent works
+func (r *usersRepository) InsertVerification(req *users.Verification) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		DELETE FROM "users_verifications"
+		WHERE "user_id" = $1
+		AND ("purpose" = $2 OR "expires_at" < now());
+	`
+	if _, err := tx.ExecContext(ctx, query, req.UserId, req.Purpose); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete verifications failed: %v", err)
+	}
+
+	query = `
+		INSERT INTO "users_verifications" (
+			"user_id",
+			"purpose",
+			"email",
+			"token_hash",
+			"expires_at"
+		)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING "id";
+	`
+	if err := tx.QueryRowContext(
+		ctx,
+		query,
+		req.UserId,
+		req.Purpose,
+		req.Email,
+		req.TokenHash,
+		req.ExpiresAt,
+	).Scan(&req.Id); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("insert verification failed: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// useVerification marks token used, so concurrent requests with one token use it once
+func useVerification(ctx context.Context, tx *sql.Tx, tokenHash, purpose string) (*users.Verification, error) {
+	query := `
+		UPDATE "users_verifications" SET
+			"used_at" = now()
+		WHERE "token_hash" = $1
+		AND "purpose" = $2
+		AND "used_at" IS NULL
+		AND "expires_at" > now()
+		RETURNING "id", "user_id", "purpose", "email", "expires_at";
+	`
+
+	v := &users.Verification{TokenHash: tokenHash}
+	if err := tx.QueryRowContext(ctx, query, tokenHash, purpose).Scan(
+		&v.Id,
+		&v.UserId,
+		&v.Purpose,
+		&v.Email,
+		&v.ExpiresAt,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("token is invalid or expired")
+		}
+		return nil, fmt.Errorf("use verification failed: %v", err)
+	}
+	return v, nil
+}
+
+func (r *usersRepository) VerifyEmail(tokenHash string) (*users.Verification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := useVerification(ctx, tx, tokenHash, users.VerifyEmailPurpose)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := `
+		UPDATE "users" SET
+			"email_verified_at" = COALESCE("email_verified_at", now())
+		WHERE "id" = $1
+		AND "email" = $2;
+	`
+	res, err := tx.ExecContext(ctx, query, v.UserId, v.Email)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("verify email failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// ResetPassword also verifies email, mail was received, and deletes all oauth of user
+func (r *usersRepository) ResetPassword(tokenHash, password string) (*users.Verification, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	v, err := useVerification(ctx, tx, tokenHash, users.ResetPasswordPurpose)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	query := `
+		UPDATE "users" SET
+			"password" = $3,
+			"email_verified_at" = COALESCE("email_verified_at", now())
+		WHERE "id" = $1
+		AND "email" = $2;
+	`
+	res, err := tx.ExecContext(ctx, query, v.UserId, v.Email, password)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("reset password failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "oauth" WHERE "user_id" = $1;`, v.UserId); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("delete oauth failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// FindMfa returns secret as stored, it is decrypted by usecase
+func (r *usersRepository) FindMfa(userId string) (*users.Mfa, error) {
+	query := `
+		SELECT
+			"user_id",
+			"secret",
+			"last_step",
+			"enabled_at" IS NOT NULL
+		FROM "users_mfa"
+		WHERE "user_id" = $1;
+	`
+
+	mfa := new(users.Mfa)
+	if err := r.db.QueryRow(query, userId).Scan(
+		&mfa.UserId,
+		&mfa.Secret,
+		&mfa.LastStep,
+		&mfa.Enabled,
+	); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("mfa not found")
+		}
+		return nil, fmt.Errorf("get mfa failed: %v", err)
+	}
+	return mfa, nil
+}
+
+// UpsertMfa replaces secret of pending mfa, enabled mfa is kept
+func (r *usersRepository) UpsertMfa(req *users.Mfa) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		INSERT INTO "users_mfa" (
+			"user_id",
+			"secret"
+		)
+		VALUES ($1, $2)
+		ON CONFLICT ("user_id") DO UPDATE SET
+			"secret" = EXCLUDED."secret",
+			"last_step" = 0
+		WHERE "users_mfa"."enabled_at" IS NULL;
+	`
+	res, err := r.db.ExecContext(ctx, query, req.UserId, req.Secret)
+	if err != nil {
+		return fmt.Errorf("upsert mfa failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("mfa has been enabled")
+	}
+	return nil
+}
+
+// EnableMfa enables pending mfa with step of first code and its recovery codes
+func (r *usersRepository) EnableMfa(userId string, step int64, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE "users_mfa" SET
+			"enabled_at" = now(),
+			"last_step" = $2
+		WHERE "user_id" = $1
+		AND "enabled_at" IS NULL;
+	`
+	res, err := tx.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("enable mfa failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("mfa has been enabled")
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UseMfaStep accepts step only after last used one, so a code is used once
+func (r *usersRepository) UseMfaStep(userId string, step int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "users_mfa" SET
+			"last_step" = $2
+		WHERE "user_id" = $1
+		AND "last_step" < $2;
+	`
+	res, err := r.db.ExecContext(ctx, query, userId, step)
+	if err != nil {
+		return fmt.Errorf("update mfa step failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("code is invalid")
+	}
+	return nil
+}
+
+func (r *usersRepository) UseRecoveryCode(userId, codeHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	query := `
+		UPDATE "users_recovery_codes" SET
+			"used_at" = now()
+		WHERE "user_id" = $1
+		AND "code_hash" = $2
+		AND "used_at" IS NULL;
+	`
+	res, err := r.db.ExecContext(ctx, query, userId, codeHash)
+	if err != nil {
+		return fmt.Errorf("use recovery code failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("code is invalid")
+	}
+	return nil
+}
+
+func (r *usersRepository) ReplaceRecoveryCodes(userId string, codeHashes []string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userId, codeHashes); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx *sql.Tx, userId string, codeHashes []string) error {
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "users_recovery_codes" WHERE "user_id" = $1;`, userId); err != nil {
+		return fmt.Errorf("delete recovery codes failed: %v", err)
+	}
+
+	query := `
+		INSERT INTO "users_recovery_codes" (
+			"user_id",
+			"code_hash"
+		)
+		VALUES ($1, $2);
+	`
+	for _, hash := range codeHashes {
+		if _, err := tx.ExecContext(ctx, query, userId, hash); err != nil {
+			return fmt.Errorf("insert recovery code failed: %v", err)
+		}
+	}
+	return nil
+}
+
+func (r *usersRepository) DeleteMfa(userId string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "users_recovery_codes" WHERE "user_id" = $1;`, userId); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete recovery codes failed: %v", err)
+	}
+	res, err := tx.ExecContext(ctx, `DELETE FROM "users_mfa" WHERE "user_id" = $1;`, userId)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete mfa failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("mfa not found")
+	}
+
+	return tx.Commit()
+}
+
+// UseMfaEnrollToken uses token only when it was issued for the user
+func (r *usersRepository) UseMfaEnrollToken(userId, tokenHash string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	v, err := useVerification(ctx, tx, tokenHash, users.MfaEnrollPurpose)
+	if err != nil {
+		tx.Rollback()
+		return err
+	}
+	if v.UserId != userId {
+		tx.Rollback()
+		return fmt.Errorf("token is invalid or expired")
+	}
+
+	return tx.Commit()
+}
+
+func (r *usersRepository) UpdateProfile(userId string, req *users.UpdateProfileReq) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	sets := make([]string, 0)
+	values := []any{userId}
+	for _, f := range []struct {
+		column string
+		value  *string
+	}{
+		{"username", req.Username},
+		{"display_name", req.DisplayName},
+		{"phone", req.Phone},
+	} {
+		if f.value != nil {
+			values = append(values, *f.value)
+			sets = append(sets, fmt.Sprintf(`"%s" = $%d`, f.column, len(values)))
+		}
+	}
+	if len(sets) == 0 {
+		return fmt.Errorf("nothing to update")
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE "users" SET
+			%s
+		WHERE "id" = $1
+		AND "status" = 'active';
+	`, strings.Join(sets, ",\n\t\t\t"))
+	res, err := r.db.ExecContext(ctx, query, values...)
+	if err != nil {
+		if strings.Contains(err.Error(), "users_username_key") {
+			return fmt.Errorf("username has been used")
+		}
+		return fmt.Errorf("update profile failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("user not found")
+	}
+	return nil
+}
+
+// ChangeEmail sets email of token, it is verified by the token. Unused tokens
+// of old email are deleted, so links sent to it stop working
+func (r *usersRepository) ChangeEmail(tokenHash string) (*users.Verification, string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, "", err
+	}
+
+	v, err := useVerification(ctx, tx, tokenHash, users.ChangeEmailPurpose)
+	if err != nil {
+		tx.Rollback()
+		return nil, "", err
+	}
+
+	var oldEmail string
+	query := `SELECT "email" FROM "users" WHERE "id" = $1 AND "status" = 'active' FOR UPDATE;`
+	if err := tx.QueryRowContext(ctx, query, v.UserId).Scan(&oldEmail); err != nil {
+		tx.Rollback()
+		if err == sql.ErrNoRows {
+			return nil, "", fmt.Errorf("token is invalid or expired")
+		}
+		return nil, "", fmt.Errorf("get user failed: %v", err)
+	}
+
+	query = `
+		UPDATE "users" SET
+			"email" = $2,
+			"email_verified_at" = now()
+		WHERE "id" = $1;
+	`
+	if _, err := tx.ExecContext(ctx, query, v.UserId, v.Email); err != nil {
+		tx.Rollback()
+		if strings.Contains(err.Error(), "users_email_key") {
+			return nil, "", fmt.Errorf("email has been used")
+		}
+		return nil, "", fmt.Errorf("change email failed: %v", err)
+	}
+
+	query = `
+		DELETE FROM "users_verifications"
+		WHERE "user_id" = $1
+		AND "used_at" IS NULL
+		AND "email" <> $2;
+	`
+	if _, err := tx.ExecContext(ctx, query, v.UserId, v.Email); err != nil {
+		tx.Rollback()
+		return nil, "", fmt.Errorf("delete verifications failed: %v", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, "", err
+	}
+	return v, oldEmail, nil
+}
+
+// ChangePassword also deletes all oauth of user like ResetPassword
+func (r *usersRepository) ChangePassword(userId, password string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := tx.ExecContext(ctx, `UPDATE "users" SET "password" = $2 WHERE "id" = $1 AND "status" = 'active';`, userId, password)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("change password failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("user not found")
+	}
+	if _, err := tx.ExecContext(ctx, `DELETE FROM "oauth" WHERE "user_id" = $1;`, userId); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("delete oauth failed: %v", err)
+	}
+
+	return tx.Commit()
+}
+
+// UpdateStatus does not change deleted users. Oauth of users who are not
+// active is deleted and their api keys are revoked, unsuspend does not restore them
+func (r *usersRepository) UpdateStatus(userId, status string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	query := `
+		UPDATE "users" SET
+			"status" = $2
+		WHERE "id" = $1
+		AND "status" <> 'deleted';
+	`
+	res, err := tx.ExecContext(ctx, query, userId, status)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("update user status failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return fmt.Errorf("user not found")
+	}
+
+	if status != users.ActiveStatus {
+		if _, err := tx.ExecContext(ctx, `DELETE FROM "oauth" WHERE "user_id" = $1;`, userId); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("delete oauth failed: %v", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE "api_keys" SET "revoked_at" = now() WHERE "owner_id" = $1 AND "revoked_at" IS NULL;`, userId); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("revoke api keys failed: %v", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// DeleteUser keeps row of user, orders still refer to it. Personal data of
+// user and its orders is anonymized, sign in data is deleted and api keys
+// of user are revoked. Keys of removed transfer slips are returned, objects
+// are deleted from storage by caller after commit
+func (r *usersRepository) DeleteUser(userId string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+		UPDATE "users" SET
+			"email" = "id" || '@deleted.invalid',
+			"username" = 'deleted-' || "id",
+			"password" = '',
+			"display_name" = '',
+			"phone" = '',
+			"email_verified_at" = NULL,
+			"status" = 'deleted',
+			"deleted_at" = now()
+		WHERE "id" = $1
+		AND "status" <> 'deleted';
+	`
+	res, err := tx.ExecContext(ctx, query, userId)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("delete user failed: %v", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		tx.Rollback()
+		return nil, fmt.Errorf("user not found")
+	}
+
+	query = `
+		SELECT
+			"id",
+			"transfer_slip"->>'filename'
+		FROM "orders"
+		WHERE "user_id" = $1
+		AND "transfer_slip" IS NOT NULL
+		FOR UPDATE;
+	`
+	rows, err := tx.QueryContext(ctx, query, userId)
+	if err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("get transfer slips failed: %v", err)
+	}
+	slips := make([]string, 0)
+	for rows.Next() {
+		var orderId string
+		var filename sql.NullString
+		if err := rows.Scan(&orderId, &filename); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return nil, fmt.Errorf("scan transfer slip failed: %v", err)
+		}
+		if filename.String != "" {
+			slips = append(slips, fmt.Sprintf("%s/%s/%s", orders.SlipDestination, orderId, filename.String))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return nil, fmt.Errorf("get transfer slips failed: %v", err)
+	}
+
+	for _, q := range []struct {
+		query string
+		name  string
+	}{
+		{`UPDATE "orders" SET "contact" = '', "address" = '', "transfer_slip" = NULL WHERE "user_id" = $1;`, "anonymize orders"},
+		{`DELETE FROM "oauth" WHERE "user_id" = $1;`, "delete oauth"},
+		{`DELETE FROM "users_verifications" WHERE "user_id" = $1;`, "delete verifications"},
+		{`DELETE FROM "users_recovery_codes" WHERE "user_id" = $1;`, "delete recovery codes"},
+		{`DELETE FROM "users_mfa" WHERE "user_id" = $1;`, "delete mfa"},
+		{`UPDATE "api_keys" SET "revoked_at" = now() WHERE "owner_id" = $1 AND "revoked_at" IS NULL;`, "revoke api keys"},
+	} {
+		if _, err := tx.ExecContext(ctx, q.query, userId); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("%s failed: %v", q.name, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return slips, nil
+}
@@ -0,0 +1,192 @@
+package usersUsecases
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"strings"
+
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/files"
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/users"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+	"github.com/codepnw/go-ecommerce/pkg/mailer"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func (u *usersUsecase) UpdateProfile(userId string, req *users.UpdateProfileReq) (*users.User, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	if err := u.repo.UpdateProfile(userId, req); err != nil {
+		return nil, err
+	}
+	return u.repo.GetProfile(userId)
+}
+
+// ChangeEmail sends link to new email, email is changed when link is opened
+func (u *usersUsecase) ChangeEmail(userId string, req *users.ChangeEmailReq) error {
+	email := strings.TrimSpace(req.Email)
+	if !users.IsEmail(email) {
+		return fmt.Errorf("email pattern is invalid")
+	}
+
+	user, err := u.checkPassword(userId, req.Password)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(email, user.Email) {
+		return fmt.Errorf("email is not changed")
+	}
+	if _, err := u.repo.FindOneUserByEmail(email); err == nil {
+		return fmt.Errorf("email has been used")
+	}
+
+	token, err := u.insertVerification(user.Id, email, users.ChangeEmailPurpose, u.cfg.Mail().VerifyExpires())
+	if err != nil {
+		return err
+	}
+
+	u.send(&mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to use this email for your account, it expires in %s:\n\n%s\n\nIf you did not ask for it, you can ignore this mail.\n",
+			user.Username,
+			u.cfg.Mail().VerifyExpires(),
+			u.link("/change-email", token),
+		),
+	})
+	return nil
+}
+
+// ConfirmEmailChange uses token of ChangeEmail, old email is told about the change
+func (u *usersUsecase) ConfirmEmailChange(req *users.VerifyEmailReq) error {
+	if req.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	v, oldEmail, err := u.repo.ChangeEmail(auth.HashToken(req.Token))
+	if err != nil {
+		return err
+	}
+
+	u.send(&mailer.Message{
+		To:      oldEmail,
+		Subject: "Your email has been changed",
+		Body: fmt.Sprintf(
+			"Hi,\n\nEmail of your account has been changed to %s.\n\nIf you did not do it, reset your password and contact us.\n",
+			v.Email,
+		),
+	})
+	return nil
+}
+
+// ChangePassword signs user out of all sessions like ResetPassword
+func (u *usersUsecase) ChangePassword(userId string, req *users.ChangePasswordReq) error {
+	if len(req.NewPassword) < users.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", users.MinPasswordLength)
+	}
+
+	if _, err := u.checkPassword(userId, req.OldPassword); err != nil {
+		return err
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), 10)
+	if err != nil {
+		return fmt.Errorf("hashed password failed: %v", err)
+	}
+	if err := u.repo.ChangePassword(userId, string(hashed)); err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(userId)
+	return nil
+}
+
+// DeleteUser anonymizes user, role of admin must be changed before.
+// Transfer slips are deleted from storage after user is deleted in database
+func (u *usersUsecase) DeleteUser(userId string, req *users.DeleteUserReq) error {
+	user, err := u.checkPassword(userId, req.Password)
+	if err != nil {
+		return err
+	}
+	if user.RoleId == roles.AdminRoleId {
+		return fmt.Errorf("admin can not be deleted")
+	}
+
+	slips, err := u.repo.DeleteUser(userId)
+	if err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(userId)
+
+	// User is deleted even if storage fails, objects are no longer referenced
+	if len(slips) > 0 {
+		req := make([]*files.DeleteFileReq, 0, len(slips))
+		for _, key := range slips {
+			req = append(req, &files.DeleteFileReq{Destination: key})
+		}
+		if err := u.files.DeleteFileOnStorage(req); err != nil {
+			slog.Error("delete transfer slips failed", slog.String("user_id", userId), slog.String("error", err.Error()))
+		}
+	}
+	return nil
+}
+
+func (u *usersUsecase) FindUsers(req *users.UserFilter) (*entities.PaginateRes, error) {
+	result, count, err := u.repo.FindUsers(req)
+	if err != nil {
+		return nil, err
+	}
+	return &entities.PaginateRes{
+		Data:      result,
+		Page:      req.Page,
+		Limit:     req.Limit,
+		TotalItem: count,
+		TotalPage: int(math.Ceil(float64(count) / float64(req.Limit))),
+	}, nil
+}
+
+// SuspendUser signs user out everywhere and revokes api keys of user,
+// suspended users can not sign in
+func (u *usersUsecase) SuspendUser(adminId, userId string) error {
+	if adminId == userId {
+		return fmt.Errorf("can not suspend yourself")
+	}
+
+	if err := u.repo.UpdateStatus(userId, users.SuspendedStatus); err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(userId)
+	return nil
+}
+
+func (u *usersUsecase) UnsuspendUser(userId string) error {
+	return u.repo.UpdateStatus(userId, users.ActiveStatus)
+}
+
+// checkPassword locks out user after repeated invalid passwords, like sign in
+func (u *usersUsecase) checkPassword(userId, password string) (*users.UserCredentialCheck, error) {
+	lockKey := "password:" + userId
+	if err := u.lockout.Check(lockKey); err != nil {
+		return nil, err
+	}
+
+	user, err := u.repo.FindOneUserById(userId)
+	if err != nil {
+		return nil, err
+	}
+	if user.Status != users.ActiveStatus {
+		return nil, fmt.Errorf("user is %s", user.Status)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(password)); err != nil {
+		if lockErr := u.lockout.Fail(lockKey); lockErr != nil {
+			return nil, lockErr
+		}
+		return nil, fmt.Errorf("password is invalid")
+	}
+	u.lockout.Reset(lockKey)
+	return user, nil
+}
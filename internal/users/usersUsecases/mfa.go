@@ -0,0 +1,378 @@
+package usersUsecases
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/internal/roles"
+	"github.com/codepnw/go-ecommerce/internal/users"
+	"github.com/codepnw/go-ecommerce/pkg/auth"
+	"github.com/codepnw/go-ecommerce/pkg/totp"
+)
+
+// mfaRequired reports whether user must pass mfa even if not enrolled
+func (u *usersUsecase) mfaRequired(user *users.User) bool {
+	return u.cfg.Mfa().RequireAdmin() && user.RoleId == roles.AdminRoleId
+}
+
+// mfaChallenge returns nil when user signs in by password only. Admins who
+// must use mfa but have not enrolled are refused, password alone must not
+// give out a secret, they enroll by token of EnrollMfaByToken
+func (u *usersUsecase) mfaChallenge(user *users.User) (*users.MfaChallenge, error) {
+	mfa, err := u.repo.FindMfa(user.Id)
+	if err != nil && err.Error() != "mfa not found" {
+		return nil, err
+	}
+	if mfa == nil || !mfa.Enabled {
+		if u.mfaRequired(user) {
+			return nil, fmt.Errorf("mfa enrollment is required")
+		}
+		return nil, nil
+	}
+	return u.newChallenge(user)
+}
+
+func (u *usersUsecase) newChallenge(user *users.User) (*users.MfaChallenge, error) {
+	expires := u.cfg.Mfa().ChallengeExpires()
+	token, err := auth.MfaToken(u.cfg.Jwt(), &users.UserClaims{Id: user.Id, RoleId: user.RoleId}, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &users.MfaChallenge{
+		Token:     token,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// IssueMfaEnrollToken is done by another admin, so an unenrolled admin
+// needs more than own password to get a secret. When no admin has enrolled,
+// token is issued by seed command: go run ./cmd/seed -mfa-enroll <email>
+func (u *usersUsecase) IssueMfaEnrollToken(adminId, userId string) (*users.MfaEnrollToken, error) {
+	if adminId == userId {
+		return nil, fmt.Errorf("can not issue enroll token for yourself")
+	}
+
+	profile, err := u.repo.GetProfile(userId)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Status != users.ActiveStatus {
+		return nil, fmt.Errorf("user is %s", profile.Status)
+	}
+	if !u.mfaRequired(profile) {
+		return nil, fmt.Errorf("mfa is not required for user")
+	}
+	mfa, err := u.repo.FindMfa(userId)
+	if err != nil && err.Error() != "mfa not found" {
+		return nil, err
+	}
+	if mfa != nil && mfa.Enabled {
+		return nil, fmt.Errorf("mfa has been enabled")
+	}
+
+	expires := u.cfg.Mfa().EnrollExpires()
+	token, err := u.insertVerification(profile.Id, profile.Email, users.MfaEnrollPurpose, expires)
+	if err != nil {
+		return nil, err
+	}
+	return &users.MfaEnrollToken{
+		Token:     token,
+		ExpiresAt: time.Now().Add(expires),
+	}, nil
+}
+
+// EnrollMfaByToken checks password and enroll token, the challenge has new
+// secret and mfa is enabled by SignInMfa with first code
+func (u *usersUsecase) EnrollMfaByToken(req *users.MfaEnrollReq) (*users.MfaChallenge, error) {
+	if req.Token == "" {
+		return nil, fmt.Errorf("token is required")
+	}
+
+	user, err := u.repo.FindOneUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		return nil, fmt.Errorf("token is invalid or expired")
+	}
+	if _, err := u.checkPassword(user.Id, req.Password); err != nil {
+		return nil, err
+	}
+
+	profile, err := u.repo.GetProfile(user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if !u.mfaRequired(profile) {
+		return nil, fmt.Errorf("mfa is not required for user")
+	}
+	if err := u.repo.UseMfaEnrollToken(user.Id, auth.HashToken(req.Token)); err != nil {
+		return nil, err
+	}
+
+	challenge, err := u.newChallenge(profile)
+	if err != nil {
+		return nil, err
+	}
+	if challenge.Enroll, err = u.newEnrollment(profile); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+// SignInMfa checks code of challenge, mfa pending from EnrollMfaByToken is enabled by it
+func (u *usersUsecase) SignInMfa(req *users.MfaSignInReq, device *users.Device) (*users.UserPassport, error) {
+	claims, err := auth.ParseToken(u.cfg.Jwt(), req.MfaToken)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Subject != "mfa-token" {
+		return nil, fmt.Errorf("token is not mfa token")
+	}
+	userId := claims.Claims.Id
+
+	profile, err := u.repo.GetProfile(userId)
+	if err != nil {
+		return nil, err
+	}
+	if profile.Status != users.ActiveStatus {
+		return nil, fmt.Errorf("user is %s", profile.Status)
+	}
+	mfa, err := u.findMfa(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var codes []string
+	if mfa.Enabled {
+		err = u.checkCode(mfa, req.Code)
+	} else if u.mfaRequired(profile) {
+		codes, err = u.enable(mfa, req.Code)
+	} else {
+		return nil, fmt.Errorf("mfa not found")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	passport, err := u.issuePassport(profile, device)
+	if err != nil {
+		return nil, err
+	}
+	passport.RecoveryCodes = codes
+	return passport, nil
+}
+
+// EnrollMfa starts enrollment, mfa is enabled by EnableMfa with first code
+func (u *usersUsecase) EnrollMfa(userId string) (*users.MfaEnrollment, error) {
+	profile, err := u.repo.GetProfile(userId)
+	if err != nil {
+		return nil, err
+	}
+	return u.newEnrollment(profile)
+}
+
+func (u *usersUsecase) EnableMfa(userId string, req *users.MfaCodeReq) ([]string, error) {
+	mfa, err := u.findMfa(userId)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Enabled {
+		return nil, fmt.Errorf("mfa has been enabled")
+	}
+	return u.enable(mfa, req.Code)
+}
+
+// RegenerateRecoveryCodes replaces all codes, unused old codes stop working
+func (u *usersUsecase) RegenerateRecoveryCodes(userId string, req *users.MfaCodeReq) ([]string, error) {
+	mfa, err := u.findEnabledMfa(userId)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.checkCode(mfa, req.Code); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := u.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.ReplaceRecoveryCodes(userId, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+func (u *usersUsecase) DisableMfa(userId string, req *users.MfaCodeReq) error {
+	profile, err := u.repo.GetProfile(userId)
+	if err != nil {
+		return err
+	}
+	if u.mfaRequired(profile) {
+		return fmt.Errorf("mfa is required for admin")
+	}
+
+	mfa, err := u.findEnabledMfa(userId)
+	if err != nil {
+		return err
+	}
+	if err := u.checkCode(mfa, req.Code); err != nil {
+		return err
+	}
+	return u.repo.DeleteMfa(userId)
+}
+
+func (u *usersUsecase) newEnrollment(user *users.User) (*users.MfaEnrollment, error) {
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := u.sealSecret(secret)
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.UpsertMfa(&users.Mfa{UserId: user.Id, Secret: sealed}); err != nil {
+		return nil, err
+	}
+
+	return &users.MfaEnrollment{
+		Secret: secret,
+		Uri:    totp.Uri(u.cfg.Mfa().Issuer(), user.Email, secret),
+	}, nil
+}
+
+// enable verifies first code of pending mfa, recovery codes are returned once
+func (u *usersUsecase) enable(mfa *users.Mfa, code string) ([]string, error) {
+	var step int64
+	if err := u.attempt(mfa.UserId, func() error {
+		var ok bool
+		if step, ok = totp.Validate(mfa.Secret, code, time.Now()); !ok {
+			return fmt.Errorf("code is invalid")
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	codes, hashes, err := u.newRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.repo.EnableMfa(mfa.UserId, step, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// checkCode accepts totp code once, or unused recovery code
+func (u *usersUsecase) checkCode(mfa *users.Mfa, code string) error {
+	return u.attempt(mfa.UserId, func() error {
+		if step, ok := totp.Validate(mfa.Secret, code, time.Now()); ok {
+			return u.repo.UseMfaStep(mfa.UserId, step)
+		}
+
+		normalized := users.NormalizeRecoveryCode(code)
+		if normalized == "" {
+			return fmt.Errorf("code is invalid")
+		}
+		return u.repo.UseRecoveryCode(mfa.UserId, auth.HashToken(normalized))
+	})
+}
+
+// attempt locks out user after repeated invalid codes, codes are short like pins
+func (u *usersUsecase) attempt(userId string, check func() error) error {
+	lockKey := "mfa:" + userId
+	if err := u.lockout.Check(lockKey); err != nil {
+		return err
+	}
+
+	if err := check(); err != nil {
+		if err.Error() == "code is invalid" {
+			if lockErr := u.lockout.Fail(lockKey); lockErr != nil {
+				return lockErr
+			}
+		}
+		return err
+	}
+	u.lockout.Reset(lockKey)
+	return nil
+}
+
+func (u *usersUsecase) newRecoveryCodes() ([]string, []string, error) {
+	n := u.cfg.Mfa().RecoveryCodes()
+	codes := make([]string, 0, n)
+	hashes := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		code, err := users.NewRecoveryCode()
+		if err != nil {
+			return nil, nil, err
+		}
+		codes = append(codes, code)
+		hashes = append(hashes, auth.HashToken(users.NormalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// findMfa returns mfa with decrypted secret
+func (u *usersUsecase) findMfa(userId string) (*users.Mfa, error) {
+	mfa, err := u.repo.FindMfa(userId)
+	if err != nil {
+		return nil, err
+	}
+	if mfa.Secret, err = u.openSecret(mfa.Secret); err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func (u *usersUsecase) findEnabledMfa(userId string) (*users.Mfa, error) {
+	mfa, err := u.findMfa(userId)
+	if err != nil {
+		return nil, err
+	}
+	if !mfa.Enabled {
+		return nil, fmt.Errorf("mfa not found")
+	}
+	return mfa, nil
+}
+
+// sealSecret encrypts totp secret by AES-GCM, a database dump does not reveal secrets
+func (u *usersUsecase) sealSecret(secret string) (string, error) {
+	gcm, err := u.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("generate nonce failed: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(secret), nil)), nil
+}
+
+func (u *usersUsecase) openSecret(sealed string) (string, error) {
+	gcm, err := u.mfaCipher()
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("mfa secret is invalid")
+	}
+	secret, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("decrypt mfa secret failed: %v", err)
+	}
+	return string(secret), nil
+}
+
+func (u *usersUsecase) mfaCipher() (cipher.AEAD, error) {
+	key := sha256.Sum256(u.cfg.Mfa().SecretKey())
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, fmt.Errorf("init mfa cipher failed: %v", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -1,33 +1,75 @@
 package usersUsecases
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
+	"github.com/codepnw/go-ecommerce/internal/entities"
+	"github.com/codepnw/go-ecommerce/internal/files/filesUsecases"
 	"github.com/codepnw/go-ecommerce/internal/users"
 	"github.com/codepnw/go-ecommerce/internal/users/usersRepositories"
 	"github.com/codepnw/go-ecommerce/pkg/auth"
+	"github.com/codepnw/go-ecommerce/pkg/mailer"
+	"github.com/codepnw/go-ecommerce/pkg/ratelimit"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// Mails are sent in background, each one is given up after timeout
+const mailTimeout = 30 * time.Second
+
 type IUsersUsecase interface {
 	InsertCustomer(req *users.UserRegisterReq) (*users.UserPassport, error)
-	InsertAdmin(req *users.UserRegisterReq) (*users.UserPassport, error)
-	GetPassport(req *users.UserCredential) (*users.UserPassport, error)
-	RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error)
-	DeleteOauth(oauthId string) error
+	InsertAdmin(adminId string, req *users.UserRegisterReq) (*users.UserPassport, error)
+	GetPassport(req *users.UserCredential, device *users.Device) (*users.UserPassport, error)
+	RefreshPassport(req *users.UserRefreshCredential, device *users.Device) (*users.UserPassport, error)
+	FindSessions(userId, accessToken string) ([]*users.Session, error)
+	SignOut(req *users.UserRefreshCredential) error
+	DeleteSession(userId, sessionId string) error
+	DeleteSessions(userId string) error
 	GetUserProfile(userId string) (*users.User, error)
+	SendVerification(userId string) error
+	VerifyEmail(req *users.VerifyEmailReq) error
+	ForgotPassword(req *users.ForgotPasswordReq) error
+	ResetPassword(req *users.ResetPasswordReq, device *users.Device) error
+	SignInMfa(req *users.MfaSignInReq, device *users.Device) (*users.UserPassport, error)
+	EnrollMfa(userId string) (*users.MfaEnrollment, error)
+	EnableMfa(userId string, req *users.MfaCodeReq) ([]string, error)
+	RegenerateRecoveryCodes(userId string, req *users.MfaCodeReq) ([]string, error)
+	DisableMfa(userId string, req *users.MfaCodeReq) error
+	IssueMfaEnrollToken(adminId, userId string) (*users.MfaEnrollToken, error)
+	EnrollMfaByToken(req *users.MfaEnrollReq) (*users.MfaChallenge, error)
+	UpdateProfile(userId string, req *users.UpdateProfileReq) (*users.User, error)
+	ChangeEmail(userId string, req *users.ChangeEmailReq) error
+	ConfirmEmailChange(req *users.VerifyEmailReq) error
+	ChangePassword(userId string, req *users.ChangePasswordReq) error
+	DeleteUser(userId string, req *users.DeleteUserReq) error
+	FindUsers(req *users.UserFilter) (*entities.PaginateRes, error)
+	SuspendUser(adminId, userId string) error
+	UnsuspendUser(userId string) error
 }
 
 type usersUsecase struct {
-	cfg  config.Config
-	repo usersRepositories.IUsersRepository
+	cfg     config.Config
+	repo    usersRepositories.IUsersRepository
+	lockout ratelimit.ILockout
+	tokens  auth.ITokenCache
+	mailer  mailer.Mailer
+	files   filesUsecases.IFilesUsecase
 }
 
-func UsersUsecase(cfg config.Config, repo usersRepositories.IUsersRepository) IUsersUsecase {
+func UsersUsecase(cfg config.Config, repo usersRepositories.IUsersRepository, lockout ratelimit.ILockout, tokens auth.ITokenCache, mailer mailer.Mailer, files filesUsecases.IFilesUsecase) IUsersUsecase {
 	return &usersUsecase{
-		cfg:  cfg,
-		repo: repo,
+		cfg:     cfg,
+		repo:    repo,
+		lockout: lockout,
+		tokens:  tokens,
+		mailer:  mailer,
+		files:   files,
 	}
 }
 
@@ -42,10 +84,16 @@ func (u *usersUsecase) InsertCustomer(req *users.UserRegisterReq) (*users.UserPa
 		return nil, err
 	}
 
+	// User is created even if mail fails, it can be sent again
+	if err := u.sendVerification(result.User); err != nil {
+		slog.Error("send verification failed", slog.String("user_id", result.User.Id), slog.String("error", err.Error()))
+	}
 	return result, nil
 }
 
-func (u *usersUsecase) InsertAdmin(req *users.UserRegisterReq) (*users.UserPassport, error) {
+// InsertAdmin returns enroll token when new admin must use mfa, it is
+// issued by the admin who creates the user
+func (u *usersUsecase) InsertAdmin(adminId string, req *users.UserRegisterReq) (*users.UserPassport, error) {
 	if err := req.BcryptHashing(); err != nil {
 		return nil, err
 	}
@@ -55,20 +103,68 @@ func (u *usersUsecase) InsertAdmin(req *users.UserRegisterReq) (*users.UserPassp
 	if err != nil {
 		return nil, err
 	}
+
+	if err := u.sendVerification(result.User); err != nil {
+		slog.Error("send verification failed", slog.String("user_id", result.User.Id), slog.String("error", err.Error()))
+	}
+
+	// Token can be issued again by IssueMfaEnrollToken
+	if u.mfaRequired(result.User) {
+		if result.MfaEnroll, err = u.IssueMfaEnrollToken(adminId, result.User.Id); err != nil {
+			slog.Error("issue mfa enroll token failed", slog.String("user_id", result.User.Id), slog.String("error", err.Error()))
+		}
+	}
 	return result, nil
 }
 
-func (u *usersUsecase) GetPassport(req *users.UserCredential) (*users.UserPassport, error) {
+func (u *usersUsecase) GetPassport(req *users.UserCredential, device *users.Device) (*users.UserPassport, error) {
+	// Failed attempts are counted by email and client ip, unknown emails too
+	lockKey := signInLockKey(req.Email, device)
+	if err := u.lockout.Check(lockKey); err != nil {
+		return nil, err
+	}
+
 	// find user
 	user, err := u.repo.FindOneUserByEmail(req.Email)
 	if err != nil {
+		if lockErr := u.lockout.Fail(lockKey); lockErr != nil {
+			return nil, lockErr
+		}
 		return nil, err
 	}
 
 	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		if lockErr := u.lockout.Fail(lockKey); lockErr != nil {
+			return nil, lockErr
+		}
 		return nil, fmt.Errorf("password is invalid")
 	}
+	u.lockout.Reset(lockKey)
 
+	// Checked after password, so status of account is shown only to its owner
+	if user.Status != users.ActiveStatus {
+		return nil, fmt.Errorf("user is %s", user.Status)
+	}
+
+	profile, err := u.repo.GetProfile(user.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Tokens are issued by SignInMfa when second step is needed
+	challenge, err := u.mfaChallenge(profile)
+	if err != nil {
+		return nil, err
+	}
+	if challenge != nil {
+		return &users.UserPassport{Mfa: challenge}, nil
+	}
+
+	return u.issuePassport(profile, device)
+}
+
+// issuePassport signs tokens of new sign in, device is shown in sessions
+func (u *usersUsecase) issuePassport(user *users.User, device *users.Device) (*users.UserPassport, error) {
 	// sign token
 	accessToken, err := auth.NewAuth(auth.Access, u.cfg.Jwt(), &users.UserClaims{
 		Id: user.Id,
@@ -86,43 +182,75 @@ func (u *usersUsecase) GetPassport(req *users.UserCredential) (*users.UserPasspo
 		return nil, fmt.Errorf("can not sign refresh_token")
 	}
 
+	signedAccessToken, err := accessToken.SignToken()
+	if err != nil {
+		return nil, err
+	}
+	signedRefreshToken, err := refreshToken.SignToken()
+	if err != nil {
+		return nil, err
+	}
+
 	// set passport
 	passport := &users.UserPassport{
-		User: &users.User{
-			Id: user.Id,
-			Email: user.Email,
-			Username: user.Username,
-			RoleId: user.RoleId,
-		},
+		User: user,
 		Token: &users.UserToken{
-			AccessToken: accessToken.SignToken(),
-			RefreshToken: refreshToken.SignToken(),
+			AccessToken: signedAccessToken,
+			RefreshToken: signedRefreshToken,
 		},
 	}
 
-	if err = u.repo.InsertOauth(passport); err != nil {
+	oauth := &users.Oauth{
+		UserId:           user.Id,
+		AccessTokenHash:  auth.HashToken(signedAccessToken),
+		RefreshTokenHash: auth.HashToken(signedRefreshToken),
+		ExpiresAt:        time.Now().Add(u.cfg.Jwt().SessionMaxAge()),
+		UserAgent:        device.UserAgent,
+		Ip:               device.Ip,
+	}
+	if err = u.repo.InsertOauth(oauth); err != nil {
 		return nil, err
 	}
+	passport.Token.Id = oauth.Id
 
 	return passport, nil
 }
 
-func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error) {
+// RefreshPassport rotates refresh token, each one is used once. Using a
+// rotated token again revokes its token family, it may have been stolen
+func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential, device *users.Device) (*users.UserPassport, error) {
 	claims, err := auth.ParseToken(u.cfg.Jwt(), req.RefreshToken)
 	if err != nil {
 		return nil, err
 	}
+	if claims.Subject != "refresh-token" {
+		return nil, fmt.Errorf("token is not refresh token")
+	}
 
-	oauth, err := u.repo.FindOneOauth(req.RefreshToken)
+	usedTokenHash := auth.HashToken(req.RefreshToken)
+	oauth, err := u.repo.FindOneOauth(usedTokenHash)
 	if err != nil {
+		if used, usedErr := u.repo.FindUsedOauth(usedTokenHash); usedErr == nil {
+			u.deleteOauth(used.Id)
+			return nil, fmt.Errorf("refresh token has been reused")
+		}
 		return nil, err
 	}
 
+	if oauth.Expired {
+		u.deleteOauth(oauth.Id)
+		return nil, fmt.Errorf("session has expired")
+	}
+
 	// find profile
 	profile, err := u.repo.GetProfile(oauth.UserId)
 	if err != nil {
 		return nil, err
 	}
+	if profile.Status != users.ActiveStatus {
+		u.deleteOauth(oauth.Id)
+		return nil, fmt.Errorf("user is %s", profile.Status)
+	}
 
 	newClaims := &users.UserClaims{
 		Id: profile.Id,
@@ -138,32 +266,122 @@ func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users
 		return nil, err
 	}
 
-	refreshToken := auth.RepeatToken(
-		u.cfg.Jwt(), 
+	signedAccessToken, err := accessToken.SignToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Refresh token never outlives session
+	expiresAt := time.Now().Add(time.Duration(u.cfg.Jwt().RefreshExpiresAt()) * time.Second)
+	if expiresAt.After(oauth.ExpiresAt) {
+		expiresAt = oauth.ExpiresAt
+	}
+
+	refreshToken, err := auth.RepeatToken(
+		u.cfg.Jwt(),
 		newClaims,
-		claims.ExpiresAt.Unix(),
-	 )
+		expiresAt.Unix(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	next := &users.Oauth{
+		Id:               oauth.Id,
+		AccessTokenHash:  auth.HashToken(signedAccessToken),
+		RefreshTokenHash: auth.HashToken(refreshToken),
+		UserAgent:        device.UserAgent,
+		Ip:               device.Ip,
+	}
+	if err := u.repo.RotateOauth(next, usedTokenHash); err != nil {
+		// Token was rotated by concurrent request
+		if err.Error() == "refresh token has been reused" {
+			u.deleteOauth(oauth.Id)
+		}
+		return nil, err
+	}
+	u.tokens.Revoke(oauth.AccessTokenHash)
 
 	passport := &users.UserPassport{
 		User: profile,
 		Token: &users.UserToken{
 			Id: oauth.Id,
-			AccessToken: accessToken.SignToken(),
+			AccessToken: signedAccessToken,
 			RefreshToken: refreshToken,
 		},
 	}
 
-	if err := u.repo.UpdateOauth(passport.Token); err != nil {
+	return passport, nil
+}
+
+// SignOut deletes session of current refresh token, rotated tokens are not accepted
+func (u *usersUsecase) SignOut(req *users.UserRefreshCredential) error {
+	if req.RefreshToken == "" {
+		return fmt.Errorf("refresh token is required")
+	}
+
+	claims, err := auth.ParseToken(u.cfg.Jwt(), req.RefreshToken)
+	if err != nil {
+		return err
+	}
+	if claims.Subject != "refresh-token" {
+		return fmt.Errorf("token is not refresh token")
+	}
+
+	oauth, err := u.repo.FindOneOauth(auth.HashToken(req.RefreshToken))
+	if err != nil {
+		return fmt.Errorf("session not found")
+	}
+	return u.deleteOauth(oauth.Id)
+}
+
+func (u *usersUsecase) deleteOauth(oauthId string) error {
+	accessTokenHash, err := u.repo.DeleteOauth(oauthId)
+	if err != nil {
+		return err
+	}
+	u.tokens.Revoke(accessTokenHash)
+	return nil
+}
+
+// FindSessions marks session of access token as current
+func (u *usersUsecase) FindSessions(userId, accessToken string) ([]*users.Session, error) {
+	sessions, err := u.repo.FindSessions(userId)
+	if err != nil {
 		return nil, err
 	}
 
-	return passport, nil
+	accessTokenHash := auth.HashToken(accessToken)
+	for _, session := range sessions {
+		session.Current = session.AccessTokenHash == accessTokenHash
+	}
+	return sessions, nil
 }
 
-func (u *usersUsecase) DeleteOauth(oauthId string) error {
-	if err := u.repo.DeleteOauth(oauthId); err != nil {
+// DeleteSession signs out one session of user, sessions of other users are not found
+func (u *usersUsecase) DeleteSession(userId, sessionId string) error {
+	if sessionId == "" {
+		return fmt.Errorf("session id is required")
+	}
+
+	accessTokenHash, err := u.repo.DeleteSession(userId, sessionId)
+	if err != nil {
 		return err
 	}
+	u.tokens.Revoke(accessTokenHash)
+	return nil
+}
+
+// DeleteSessions signs out user everywhere, access tokens are refused at once
+func (u *usersUsecase) DeleteSessions(userId string) error {
+	if _, err := u.repo.GetProfile(userId); err != nil {
+		return err
+	}
+
+	if err := u.repo.DeleteSessions(userId); err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(userId)
 	return nil
 }
 
@@ -173,4 +391,149 @@ func (u *usersUsecase) GetUserProfile(userId string) (*users.User, error) {
 		return nil, err
 	}
 	return profile, nil
-}
\ No newline at end of file
+}
+
+// SendVerification sends verification mail again, previous link stops working
+func (u *usersUsecase) SendVerification(userId string) error {
+	profile, err := u.repo.GetProfile(userId)
+	if err != nil {
+		return err
+	}
+	if profile.EmailVerified {
+		return fmt.Errorf("email has been verified")
+	}
+	return u.sendVerification(profile)
+}
+
+func (u *usersUsecase) VerifyEmail(req *users.VerifyEmailReq) error {
+	if req.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+
+	if _, err := u.repo.VerifyEmail(auth.HashToken(req.Token)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ForgotPassword returns at once for every email, lookup and token are done in
+// background, so neither response nor its timing shows whether email is of a user
+func (u *usersUsecase) ForgotPassword(req *users.ForgotPasswordReq) error {
+	email := strings.TrimSpace(req.Email)
+	go func() {
+		if err := u.sendResetPassword(email); err != nil {
+			slog.Error("send reset password failed", slog.String("error", err.Error()))
+		}
+	}()
+	return nil
+}
+
+func (u *usersUsecase) sendResetPassword(email string) error {
+	user, err := u.repo.FindOneUserByEmail(email)
+	if err != nil || user.Status != users.ActiveStatus {
+		return nil
+	}
+
+	token, err := u.insertVerification(user.Id, user.Email, users.ResetPasswordPurpose, u.cfg.Mail().ResetExpires())
+	if err != nil {
+		return err
+	}
+
+	u.send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to set a new password, it expires in %s:\n\n%s\n\nIf you did not ask for it, you can ignore this mail.\n",
+			user.Username,
+			u.cfg.Mail().ResetExpires(),
+			u.link("/reset-password", token),
+		),
+	})
+	return nil
+}
+
+// ResetPassword signs user out of all sessions, old tokens may have been stolen with password
+func (u *usersUsecase) ResetPassword(req *users.ResetPasswordReq, device *users.Device) error {
+	if req.Token == "" {
+		return fmt.Errorf("token is required")
+	}
+	if len(req.Password) < users.MinPasswordLength {
+		return fmt.Errorf("password must be at least %d characters", users.MinPasswordLength)
+	}
+
+	hashed, err := bcrypt.GenerateFromPassword([]byte(req.Password), 10)
+	if err != nil {
+		return fmt.Errorf("hashed password failed: %v", err)
+	}
+
+	v, err := u.repo.ResetPassword(auth.HashToken(req.Token), string(hashed))
+	if err != nil {
+		return err
+	}
+	u.tokens.RevokeUser(v.UserId)
+	u.lockout.Reset(signInLockKey(v.Email, device))
+	return nil
+}
+
+// signInLockKey is scoped to client ip, so others can not lock user out by failing sign in with its email
+func signInLockKey(email string, device *users.Device) string {
+	ip := ""
+	if device != nil {
+		ip = device.Ip
+	}
+	return "signin:" + strings.ToLower(strings.TrimSpace(email)) + "|" + ip
+}
+
+func (u *usersUsecase) sendVerification(user *users.User) error {
+	token, err := u.insertVerification(user.Id, user.Email, users.VerifyEmailPurpose, u.cfg.Mail().VerifyExpires())
+	if err != nil {
+		return err
+	}
+
+	u.send(&mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf(
+			"Hi %s,\n\nOpen the link below to verify your email, it expires in %s:\n\n%s\n",
+			user.Username,
+			u.cfg.Mail().VerifyExpires(),
+			u.link("/verify-email", token),
+		),
+	})
+	return nil
+}
+
+// insertVerification returns token, only its hash is stored
+func (u *usersUsecase) insertVerification(userId, email, purpose string, expires time.Duration) (string, error) {
+	token, err := users.NewVerificationToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := u.repo.InsertVerification(&users.Verification{
+		UserId:    userId,
+		Purpose:   purpose,
+		Email:     email,
+		TokenHash: auth.HashToken(token),
+		ExpiresAt: time.Now().Add(expires),
+	}); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// send does not block request, time of response does not show whether mail is sent
+func (u *usersUsecase) send(msg *mailer.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailTimeout)
+		defer cancel()
+
+		if err := u.mailer.Send(ctx, msg); err != nil {
+			slog.Error("send mail failed", slog.String("subject", msg.Subject), slog.String("error", err.Error()))
+		}
+	}()
+}
+
+func (u *usersUsecase) link(path, token string) string {
+	return strings.TrimSuffix(u.cfg.Mail().LinkBaseUrl(), "/") + path + "?token=" + url.QueryEscape(token)
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/codepnw/go-ecommerce/internal/users"
 	"github.com/gofiber/fiber/v2/log"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type TokenType string
@@ -18,19 +19,14 @@ const (
 	Access  TokenType = "access"
 	Refresh TokenType = "refresh"
 	Admin   TokenType = "admin"
-	ApiKey  TokenType = "apikey"
 )
 
 type IAuth interface {
-	SignToken() string
+	SignToken() (string, error)
 }
 
 type IAuthAdmin interface {
-	SignToken() string
-}
-
-type IAuthApiKey interface {
-	SignToken() string
+	SignToken() (string, error)
 }
 
 type auth struct {
@@ -42,10 +38,6 @@ type authAdmin struct {
 	*auth
 }
 
-type authApiKey struct {
-	*auth
-}
-
 type mapClaims struct {
 	Claims *users.UserClaims `json:"claims"`
 	jwt.RegisteredClaims
@@ -59,31 +51,27 @@ func jwtTimeRepeatAdapter(t int64) *jwt.NumericDate {
 	return jwt.NewNumericDate(time.Unix(t, 0))
 }
 
-func (a *auth) SignToken() string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, a.mapClaims)
-	ss, _ := token.SignedString(a.cfg.SecretKey())
-	return ss
-}
-
-func (a *authAdmin) SignToken() string {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, a.mapClaims)
-	ss, _ := token.SignedString(a.cfg.AdminKey())
-	return ss
+// SignToken signs access and refresh tokens by key set of JWT_ALGORITHM
+func (a *auth) SignToken() (string, error) {
+	ss, err := keySet(a.cfg).Sign(a.mapClaims)
+	if err != nil {
+		return "", fmt.Errorf("sign token failed: %v", err)
+	}
+	return ss, nil
 }
 
-func (a *authApiKey) SignToken() string {
+func (a *authAdmin) SignToken() (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, a.mapClaims)
-	ss, _ := token.SignedString(a.cfg.ApiKey())
-	return ss
+	ss, err := token.SignedString(a.cfg.AdminKey())
+	if err != nil {
+		return "", fmt.Errorf("sign admin token failed: %v", err)
+	}
+	return ss, nil
 }
 
+// ParseToken verifies access and refresh tokens by kid in header, HS256 tokens have no kid
 func ParseToken(cfg config.JwtConfig, tokenString string) (*mapClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &mapClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("signing method is invalid")
-		}
-		return cfg.SecretKey(), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &mapClaims{}, keySet(cfg).Keyfunc)
 
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenMalformed) {
@@ -128,41 +116,39 @@ func ParseTokenAdmin(cfg config.JwtConfig, tokenString string) (*mapClaims, erro
 	}
 }
 
-func ParseApiKey (cfg config.JwtConfig, tokenString string) (*mapClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &mapClaims{}, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("signing method is invalid")
-		}
-		return cfg.ApiKey(), nil
-	})
-
-	if err != nil {
-		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return nil, fmt.Errorf("token format is invalid")
-		} else if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, fmt.Errorf("token has expired")
-		} else {
-			return nil, fmt.Errorf("parse token failed: %v", err)
-		}
+// RepeatToken signs refresh token expiring at exp, rotated tokens keep end of session
+func RepeatToken(cfg config.JwtConfig, claims *users.UserClaims, exp int64) (string, error) {
+	obj := &auth{
+		cfg: cfg,
+		mapClaims: &mapClaims{
+			Claims: claims,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.NewString(),
+				Issuer:    "go-ecommerce",
+				Subject:   "refresh-token",
+				Audience:  []string{"customer", "admin"},
+				ExpiresAt: jwtTimeRepeatAdapter(exp),
+				NotBefore: jwt.NewNumericDate(time.Now()),
+				IssuedAt:  jwt.NewNumericDate(time.Now()),
+			},
+		},
 	}
 
-	if claims, ok := token.Claims.(*mapClaims); ok {
-		return claims, nil
-	} else {
-		return nil, fmt.Errorf("claims type is invalid")
-	}
+	return obj.SignToken()
 }
 
-func RepeatToken(cfg config.JwtConfig, claims *users.UserClaims, exp int64) string {
+// MfaToken signs challenge of second sign in step, it is not accepted as access token
+func MfaToken(cfg config.JwtConfig, claims *users.UserClaims, expires time.Duration) (string, error) {
 	obj := &auth{
 		cfg: cfg,
 		mapClaims: &mapClaims{
 			Claims: claims,
 			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.NewString(),
 				Issuer:    "go-ecommerce",
-				Subject:   "refresh-token",
+				Subject:   "mfa-token",
 				Audience:  []string{"customer", "admin"},
-				ExpiresAt: jwtTimeRepeatAdapter(exp),
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(expires)),
 				NotBefore: jwt.NewNumericDate(time.Now()),
 				IssuedAt:  jwt.NewNumericDate(time.Now()),
 			},
@@ -180,8 +166,6 @@ func NewAuth(tokenType TokenType, cfg config.JwtConfig, claims *users.UserClaims
 		return newRefreshToken(cfg, claims), nil
 	case Admin:
 		return newAdminToken(cfg), nil
-	case ApiKey:
-		return newApiKey(cfg), nil
 	default:
 		return nil, fmt.Errorf("unknow token type")
 	}
@@ -193,6 +177,7 @@ func newAccessToken(cfg config.JwtConfig, claims *users.UserClaims) IAuth {
 		mapClaims: &mapClaims{
 			Claims: claims,
 			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.NewString(),
 				Issuer:    "go-ecommerce",
 				Subject:   "access-token",
 				Audience:  []string{"customer", "admin"},
@@ -210,6 +195,7 @@ func newRefreshToken(cfg config.JwtConfig, claims *users.UserClaims) IAuth {
 		mapClaims: &mapClaims{
 			Claims: claims,
 			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        uuid.NewString(),
 				Issuer:    "go-ecommerce",
 				Subject:   "refresh-token",
 				Audience:  []string{"customer", "admin"},
@@ -239,22 +225,3 @@ func newAdminToken(cfg config.JwtConfig) IAuthAdmin {
 		},
 	}
 }
-
-func newApiKey(cfg config.JwtConfig) IAuthApiKey {
-	return &authApiKey{
-		auth: &auth{
-			cfg: cfg,
-			mapClaims: &mapClaims{
-				Claims: nil,
-				RegisteredClaims: jwt.RegisteredClaims{
-					Issuer:    "go-ecommerce",
-					Subject:   "api-key",
-					Audience:  []string{"admin", "customer"},
-					ExpiresAt: jwt.NewNumericDate(time.Now().AddDate(2, 0, 0)),
-					NotBefore: jwt.NewNumericDate(time.Now()),
-					IssuedAt:  jwt.NewNumericDate(time.Now()),
-				},
-			},
-		},
-	}
-}
@@ -0,0 +1,406 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key id is <created unix>-<random>, age of key is known from file name
+var keyFileRegexp = regexp.MustCompile(`^(\d+)-[0-9A-Za-z]+\.pem$`)
+
+// New key is in jwks this long before it signs, so other services refresh their jwks first
+const keyPublishAhead = 15 * time.Minute
+
+// Keys dir is read again every interval, keys added by other instances are loaded
+const keyCheckInterval = time.Minute
+
+// IKeySet signs access and refresh tokens and verifies them by kid
+type IKeySet interface {
+	Sign(claims jwt.Claims) (string, error)
+	Keyfunc(t *jwt.Token) (any, error)
+	Jwks() *Jwks
+	Start()
+	Stop()
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type Jwks struct {
+	Keys []*Jwk `json:"keys"`
+}
+
+var keys IKeySet
+
+// Init loads keys of JWT_ALGORITHM, they are rotated in background until Stop
+func Init(cfg config.JwtConfig) error {
+	set, err := NewKeySet(cfg)
+	if err != nil {
+		return err
+	}
+	set.Start()
+	keys = set
+	return nil
+}
+
+func Stop() {
+	if keys != nil {
+		keys.Stop()
+	}
+}
+
+// JwksKeys returns public keys of tokens, empty for HS256
+func JwksKeys(cfg config.JwtConfig) *Jwks {
+	return keySet(cfg).Jwks()
+}
+
+// keySet falls back to HS256 when Init is not called, e.g. in commands
+func keySet(cfg config.JwtConfig) IKeySet {
+	if keys != nil {
+		return keys
+	}
+	return &hmacKeySet{cfg: cfg}
+}
+
+func NewKeySet(cfg config.JwtConfig) (IKeySet, error) {
+	switch cfg.Algorithm() {
+	case "HS256":
+		return &hmacKeySet{cfg: cfg}, nil
+	case "RS256", "EdDSA":
+		set := &fileKeySet{cfg: cfg}
+		if err := set.check(time.Now()); err != nil {
+			return nil, err
+		}
+		return set, nil
+	default:
+		return nil, fmt.Errorf("jwt algorithm %s is not supported", cfg.Algorithm())
+	}
+}
+
+// hmacKeySet signs with shared secret key, there is no public key
+type hmacKeySet struct {
+	cfg config.JwtConfig
+}
+
+func (s *hmacKeySet) Sign(claims jwt.Claims) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.cfg.SecretKey())
+}
+
+func (s *hmacKeySet) Keyfunc(t *jwt.Token) (any, error) {
+	if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("signing method is invalid")
+	}
+	return s.cfg.SecretKey(), nil
+}
+
+func (s *hmacKeySet) Jwks() *Jwks { return &Jwks{Keys: make([]*Jwk, 0)} }
+func (s *hmacKeySet) Start()      {}
+func (s *hmacKeySet) Stop()       {}
+
+type signingKey struct {
+	id      string
+	created time.Time
+	method  jwt.SigningMethod
+	private crypto.Signer
+}
+
+// fileKeySet keeps private keys as pkcs8 pem files in keys dir, the newest
+// key of algorithm signs and older keys verify until grace is over
+type fileKeySet struct {
+	cfg config.JwtConfig
+
+	mu   sync.RWMutex
+	keys []*signingKey // oldest first
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (s *fileKeySet) Start() {
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(keyCheckInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-s.stop:
+				return
+			case now := <-ticker.C:
+				if err := s.check(now); err != nil {
+					slog.Error("check jwt keys failed", slog.String("error", err.Error()))
+				}
+			}
+		}
+	}()
+}
+
+func (s *fileKeySet) Stop() {
+	if s.stop == nil {
+		return
+	}
+	close(s.stop)
+	<-s.done
+	s.stop = nil
+}
+
+// check loads keys dir, adds a key when newest is older than rotation
+// and removes keys retired longer than grace
+func (s *fileKeySet) check(now time.Time) error {
+	loaded, err := s.load()
+	if err != nil {
+		return err
+	}
+
+	var newest *signingKey
+	for _, k := range loaded {
+		if k.method.Alg() == s.cfg.Algorithm() {
+			newest = k
+		}
+	}
+
+	rotation := s.cfg.KeyRotation()
+	if newest == nil || (rotation > 0 && now.Sub(newest.created) >= rotation) {
+		k, err := s.generate(now)
+		if err != nil {
+			return err
+		}
+		loaded = append(loaded, k)
+	}
+
+	kept := make([]*signingKey, 0, len(loaded))
+	for i, k := range loaded {
+		if retired, ok := s.retiredAt(loaded[i+1:]); ok && now.Sub(retired) > s.cfg.KeyGrace() {
+			if err := os.Remove(s.path(k.id)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("remove jwt key %s failed: %v", k.id, err)
+			}
+			slog.Info("jwt key removed", slog.String("kid", k.id))
+			continue
+		}
+		kept = append(kept, k)
+	}
+
+	s.mu.Lock()
+	s.keys = kept
+	s.mu.Unlock()
+	return nil
+}
+
+// retiredAt is when first newer key of algorithm starts signing
+func (s *fileKeySet) retiredAt(newer []*signingKey) (time.Time, bool) {
+	for _, k := range newer {
+		if k.method.Alg() == s.cfg.Algorithm() {
+			return k.created.Add(keyPublishAhead), true
+		}
+	}
+	return time.Time{}, false
+}
+
+func (s *fileKeySet) path(kid string) string {
+	return filepath.Join(s.cfg.KeysDir(), kid+".pem")
+}
+
+func (s *fileKeySet) load() ([]*signingKey, error) {
+	if err := os.MkdirAll(s.cfg.KeysDir(), 0700); err != nil {
+		return nil, fmt.Errorf("create jwt keys dir failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(s.cfg.KeysDir())
+	if err != nil {
+		return nil, fmt.Errorf("read jwt keys dir failed: %v", err)
+	}
+
+	loaded := make([]*signingKey, 0, len(entries))
+	for _, e := range entries {
+		match := keyFileRegexp.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+
+		k, err := readKey(filepath.Join(s.cfg.KeysDir(), e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		unix, _ := strconv.ParseInt(match[1], 10, 64)
+		k.id = e.Name()[:len(e.Name())-len(".pem")]
+		k.created = time.Unix(unix, 0)
+		loaded = append(loaded, k)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool {
+		if loaded[i].created.Equal(loaded[j].created) {
+			return loaded[i].id < loaded[j].id
+		}
+		return loaded[i].created.Before(loaded[j].created)
+	})
+	return loaded, nil
+}
+
+func readKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read jwt key failed: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("jwt key %s is not pem", path)
+	}
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse jwt key %s failed: %v", path, err)
+	}
+
+	switch key := private.(type) {
+	case *rsa.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodRS256, private: key}, nil
+	case ed25519.PrivateKey:
+		return &signingKey{method: jwt.SigningMethodEdDSA, private: key}, nil
+	default:
+		return nil, fmt.Errorf("jwt key %s is not rsa or ed25519", path)
+	}
+}
+
+// generate writes key to temp file then renames it, other instances never read half a file
+func (s *fileKeySet) generate(now time.Time) (*signingKey, error) {
+	k := &signingKey{created: time.Unix(now.Unix(), 0)}
+
+	var err error
+	switch s.cfg.Algorithm() {
+	case "RS256":
+		k.method = jwt.SigningMethodRS256
+		k.private, err = rsa.GenerateKey(rand.Reader, 2048)
+	case "EdDSA":
+		k.method = jwt.SigningMethodEdDSA
+		_, k.private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("generate jwt key failed: %v", err)
+	}
+
+	suffix := make([]byte, 4)
+	if _, err := rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	k.id = fmt.Sprintf("%d-%s", now.Unix(), hex.EncodeToString(suffix))
+
+	der, err := x509.MarshalPKCS8PrivateKey(k.private)
+	if err != nil {
+		return nil, fmt.Errorf("marshal jwt key failed: %v", err)
+	}
+
+	tmp := s.path(k.id) + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("write jwt key failed: %v", err)
+	}
+	if err := os.Rename(tmp, s.path(k.id)); err != nil {
+		os.Remove(tmp)
+		return nil, fmt.Errorf("write jwt key failed: %v", err)
+	}
+
+	slog.Info("jwt key created", slog.String("kid", k.id), slog.String("alg", k.method.Alg()))
+	return k, nil
+}
+
+// signer is newest key of algorithm published long enough, or oldest on first start
+func (s *fileKeySet) signer(now time.Time) *signingKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var first, active *signingKey
+	for _, k := range s.keys {
+		if k.method.Alg() != s.cfg.Algorithm() {
+			continue
+		}
+		if first == nil {
+			first = k
+		}
+		if !k.created.Add(keyPublishAhead).After(now) {
+			active = k
+		}
+	}
+	if active == nil {
+		return first
+	}
+	return active
+}
+
+func (s *fileKeySet) Sign(claims jwt.Claims) (string, error) {
+	k := s.signer(time.Now())
+	if k == nil {
+		return "", fmt.Errorf("no jwt key to sign")
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+func (s *fileKeySet) Keyfunc(t *jwt.Token) (any, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, k := range s.keys {
+		if k.id != kid {
+			continue
+		}
+		if t.Method.Alg() != k.method.Alg() {
+			return nil, fmt.Errorf("signing method is invalid")
+		}
+		return k.private.Public(), nil
+	}
+	return nil, fmt.Errorf("signing key is unknown")
+}
+
+func (s *fileKeySet) Jwks() *Jwks {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	jwks := &Jwks{Keys: make([]*Jwk, 0, len(s.keys))}
+	for _, k := range s.keys {
+		jwk := &Jwk{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch public := k.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	return jwks
+}
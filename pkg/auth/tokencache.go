@@ -0,0 +1,199 @@
+package auth
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+// Expired revocations are removed at most once per interval
+const revocationSweepInterval = time.Minute
+
+// ITokenCache remembers access tokens found in database and tokens revoked by
+// this instance, other instances see revocations after their cache ttl
+type ITokenCache interface {
+	// Valid reports whether token was found in database within ttl
+	Valid(token string) bool
+	Add(token, userId string, expiresAt time.Time)
+	// Revoked is checked before Valid, revoked tokens never reach database
+	Revoked(token, userId string, issuedAt time.Time) bool
+	// Revoke takes hash of token, database keeps only hashes
+	Revoke(tokenHash string)
+	// RevokeUser rejects all tokens of user issued before now
+	RevokeUser(userId string)
+	// UserRevoked reports whether RevokeUser was called since t, e.g. cached
+	// credentials of user loaded at t are stale
+	UserRevoked(userId string, t time.Time) bool
+}
+
+type tokenCache struct {
+	cfg config.JwtConfig
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // front is most recently used
+	tokens  map[string]time.Time
+	users   map[string]*userRevocation
+	swept   time.Time
+}
+
+type tokenEntry struct {
+	key     string
+	userId  string
+	expires time.Time
+}
+
+type userRevocation struct {
+	at      time.Time
+	expires time.Time
+}
+
+func NewTokenCache(cfg config.JwtConfig) ITokenCache {
+	return &tokenCache{
+		cfg:     cfg,
+		entries: make(map[string]*list.Element),
+		order:   list.New(),
+		tokens:  make(map[string]time.Time),
+		users:   make(map[string]*userRevocation),
+		swept:   time.Now(),
+	}
+}
+
+// HashToken is sha256 hex of token, tokens are stored by hash so a dump does not leak them
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (c *tokenCache) Valid(token string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[HashToken(token)]
+	if !ok {
+		return false
+	}
+	entry := e.Value.(*tokenEntry)
+	if time.Now().After(entry.expires) {
+		c.remove(e)
+		return false
+	}
+	c.order.MoveToFront(e)
+	return true
+}
+
+// Add keeps token until ttl or its expiry, whichever comes first
+func (c *tokenCache) Add(token, userId string, expiresAt time.Time) {
+	size := c.cfg.CacheSize()
+	if size <= 0 {
+		return
+	}
+	if ttl := time.Now().Add(c.cfg.CacheTTL()); ttl.Before(expiresAt) {
+		expiresAt = ttl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := HashToken(token)
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*tokenEntry).expires = expiresAt
+		c.order.MoveToFront(e)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&tokenEntry{key: key, userId: userId, expires: expiresAt})
+	for c.order.Len() > size {
+		c.remove(c.order.Back())
+	}
+}
+
+func (c *tokenCache) Revoked(token, userId string, issuedAt time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.tokens[HashToken(token)]; ok {
+		return true
+	}
+	// Token iat has second precision, tokens of same second are checked in database
+	if r, ok := c.users[userId]; ok && issuedAt.Before(r.at.Truncate(time.Second)) {
+		return true
+	}
+	return false
+}
+
+func (c *tokenCache) Revoke(tokenHash string) {
+	if tokenHash == "" {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	if e, ok := c.entries[tokenHash]; ok {
+		c.remove(e)
+	}
+	// Token is not valid longer than access expires
+	c.tokens[tokenHash] = now.Add(c.accessExpires())
+}
+
+func (c *tokenCache) RevokeUser(userId string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	c.sweep(now)
+
+	for e := c.order.Front(); e != nil; {
+		next := e.Next()
+		if e.Value.(*tokenEntry).userId == userId {
+			c.remove(e)
+		}
+		e = next
+	}
+	c.users[userId] = &userRevocation{at: now, expires: now.Add(c.accessExpires())}
+}
+
+func (c *tokenCache) UserRevoked(userId string, t time.Time) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	r, ok := c.users[userId]
+	return ok && !r.at.Before(t)
+}
+
+func (c *tokenCache) accessExpires() time.Duration {
+	return time.Duration(c.cfg.AccessExpiresAt()) * time.Second
+}
+
+// remove must be called with mu locked
+func (c *tokenCache) remove(e *list.Element) {
+	c.order.Remove(e)
+	delete(c.entries, e.Value.(*tokenEntry).key)
+}
+
+// sweep must be called with mu locked
+func (c *tokenCache) sweep(now time.Time) {
+	if now.Sub(c.swept) < revocationSweepInterval {
+		return
+	}
+	c.swept = now
+
+	for key, expires := range c.tokens {
+		if now.After(expires) {
+			delete(c.tokens, key)
+		}
+	}
+	for userId, r := range c.users {
+		if now.After(r.expires) {
+			delete(c.users, userId)
+		}
+	}
+}
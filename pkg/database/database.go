@@ -8,7 +8,6 @@ import (
 	"time"
 
 	"github.com/codepnw/go-ecommerce/config"
-	_ "github.com/joho/godotenv/autoload"
 	_ "github.com/lib/pq"
 )
 
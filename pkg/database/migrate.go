@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// Same table as golang-migrate, databases migrated by `migrate` cli keep working
+const migrationsTable = "schema_migrations"
+
+// Only one instance migrates at a time
+const migrationsLockId = 7295028341
+
+var migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+type IMigrator interface {
+	Up(steps int) error
+	Down(steps int) error
+	Force(version int) error
+	Status() (*MigrationStatus, error)
+}
+
+type Migration struct {
+	Version int    `json:"version"`
+	Name    string `json:"name"`
+	Applied bool   `json:"applied"`
+	up      string
+	down    string
+}
+
+type MigrationStatus struct {
+	Version    int          `json:"version"`
+	Dirty      bool         `json:"dirty"`
+	Migrations []*Migration `json:"migrations"`
+}
+
+type migrator struct {
+	db         *sql.DB
+	migrations []*Migration
+}
+
+func NewMigrator(db Service) (IMigrator, error) {
+	migrations, err := loadMigrations(migrationsFS)
+	if err != nil {
+		return nil, err
+	}
+
+	return &migrator{
+		db:         db.Get(),
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations failed: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, e := range entries {
+		match := migrationFileRegexp.FindStringSubmatch(e.Name())
+		if match == nil {
+			continue
+		}
+
+		version, _ := strconv.Atoi(match[1])
+		data, err := fs.ReadFile(fsys, "migrations/"+e.Name())
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s failed: %v", e.Name(), err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.up = string(data)
+		} else {
+			m.down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.up == "" {
+			return nil, fmt.Errorf("migration %d has no up file", m.Version)
+		}
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withLock runs fn on one connection holding the migration lock
+func (m *migrator) withLock(fn func(ctx context.Context, conn *sql.Conn) error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connect database failed: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationsLockId); err != nil {
+		return fmt.Errorf("lock migrations failed: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationsLockId)
+
+	query := fmt.Sprintf(`
+		CREATE TABLE IF NOT EXISTS "%s" (
+			"version" BIGINT NOT NULL PRIMARY KEY,
+			"dirty" BOOLEAN NOT NULL
+		);`, migrationsTable)
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("create %s failed: %v", migrationsTable, err)
+	}
+
+	return fn(ctx, conn)
+}
+
+// version returns current version, 0 is no migration applied
+func (m *migrator) version(ctx context.Context, conn *sql.Conn) (int, bool, error) {
+	var version int
+	var dirty bool
+
+	query := fmt.Sprintf(`SELECT "version", "dirty" FROM "%s" LIMIT 1;`, migrationsTable)
+	if err := conn.QueryRowContext(ctx, query).Scan(&version, &dirty); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("get migration version failed: %v", err)
+	}
+	return version, dirty, nil
+}
+
+func (m *migrator) setVersion(ctx context.Context, conn *sql.Conn, version int, dirty bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM "%s";`, migrationsTable)); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("set migration version failed: %v", err)
+	}
+
+	if version > 0 {
+		query := fmt.Sprintf(`INSERT INTO "%s" ("version", "dirty") VALUES ($1, $2);`, migrationsTable)
+		if _, err := tx.ExecContext(ctx, query, version, dirty); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("set migration version failed: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (m *migrator) checkClean(ctx context.Context, conn *sql.Conn) (int, error) {
+	version, dirty, err := m.version(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if dirty {
+		return 0, fmt.Errorf("database is dirty at version %d, fix it then force a version", version)
+	}
+	return version, nil
+}
+
+// run executes a migration file, it is marked dirty until it succeeds
+func (m *migrator) run(ctx context.Context, conn *sql.Conn, version int, target int, query string) error {
+	if err := m.setVersion(ctx, conn, version, true); err != nil {
+		return err
+	}
+
+	// Files may hold many statements and their own transactions
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		// Leave failed transaction of file, connection goes back to pool
+		conn.ExecContext(context.Background(), `ROLLBACK;`)
+		return fmt.Errorf("migration %d failed: %v", version, err)
+	}
+	return m.setVersion(ctx, conn, target, false)
+}
+
+// Up applies steps pending migrations, 0 applies all
+func (m *migrator) Up(steps int) error {
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		current, err := m.checkClean(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		applied := 0
+		for _, migration := range m.migrations {
+			if migration.Version <= current {
+				continue
+			}
+			if steps > 0 && applied >= steps {
+				break
+			}
+
+			if err := m.run(ctx, conn, migration.Version, migration.Version, migration.up); err != nil {
+				return err
+			}
+			applied++
+		}
+		return nil
+	})
+}
+
+// Down reverts steps applied migrations, 0 reverts all
+func (m *migrator) Down(steps int) error {
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		current, err := m.checkClean(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		reverted := 0
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			migration := m.migrations[i]
+			if migration.Version > current {
+				continue
+			}
+			if steps > 0 && reverted >= steps {
+				break
+			}
+			if migration.down == "" {
+				return fmt.Errorf("migration %d has no down file", migration.Version)
+			}
+
+			previous := 0
+			if i > 0 {
+				previous = m.migrations[i-1].Version
+			}
+
+			if err := m.run(ctx, conn, migration.Version, previous, migration.down); err != nil {
+				return err
+			}
+			reverted++
+		}
+		return nil
+	})
+}
+
+// Force sets version without running migrations, it clears dirty state
+func (m *migrator) Force(version int) error {
+	if version < 0 {
+		return fmt.Errorf("version must not be negative")
+	}
+
+	return m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		return m.setVersion(ctx, conn, version, false)
+	})
+}
+
+func (m *migrator) Status() (*MigrationStatus, error) {
+	status := &MigrationStatus{
+		Migrations: make([]*Migration, 0, len(m.migrations)),
+	}
+
+	err := m.withLock(func(ctx context.Context, conn *sql.Conn) error {
+		version, dirty, err := m.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		status.Version, status.Dirty = version, dirty
+		for _, migration := range m.migrations {
+			status.Migrations = append(status.Migrations, &Migration{
+				Version: migration.Version,
+				Name:    migration.Name,
+				Applied: migration.Version <= version && !(dirty && migration.Version == version),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
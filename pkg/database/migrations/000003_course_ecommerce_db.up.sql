@@ -0,0 +1,27 @@
+BEGIN;
+
+CREATE TABLE "carts" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "user_id" VARCHAR NOT NULL UNIQUE,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE "carts_items" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "cart_id" uuid NOT NULL,
+  "product_id" VARCHAR NOT NULL,
+  "qty" INT NOT NULL DEFAULT 1 CHECK ("qty" > 0),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE ("cart_id", "product_id")
+);
+
+ALTER TABLE "carts" ADD FOREIGN KEY ("user_id") REFERENCES "users" ("id") ON DELETE CASCADE;
+ALTER TABLE "carts_items" ADD FOREIGN KEY ("cart_id") REFERENCES "carts" ("id") ON DELETE CASCADE;
+ALTER TABLE "carts_items" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+
+CREATE TRIGGER set_updated_at_timestamp_carts_table BEFORE UPDATE ON "carts" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+CREATE TRIGGER set_updated_at_timestamp_carts_items_table BEFORE UPDATE ON "carts_items" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
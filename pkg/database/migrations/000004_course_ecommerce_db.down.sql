@@ -0,0 +1,9 @@
+BEGIN;
+
+DROP TRIGGER IF EXISTS set_updated_at_timestamp_products_stocks_table ON "products_stocks";
+
+DROP TABLE IF EXISTS "stock_movements" CASCADE;
+DROP TABLE IF EXISTS "products_stocks" CASCADE;
+DROP TABLE IF EXISTS "warehouses" CASCADE;
+
+COMMIT;
@@ -0,0 +1,64 @@
+BEGIN;
+
+CREATE TABLE "warehouses" (
+  "id" SERIAL PRIMARY KEY,
+  "title" VARCHAR UNIQUE NOT NULL
+);
+
+CREATE TABLE "products_stocks" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "product_id" VARCHAR NOT NULL,
+  "warehouse_id" INT NOT NULL,
+  "qty" INT NOT NULL DEFAULT 0 CHECK ("qty" >= 0),
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now(),
+  UNIQUE ("product_id", "warehouse_id")
+);
+
+CREATE TABLE "stock_movements" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "product_id" VARCHAR NOT NULL,
+  "warehouse_id" INT NOT NULL,
+  "order_id" VARCHAR,
+  "qty" INT NOT NULL,
+  "reason" VARCHAR NOT NULL,
+  "created_by" VARCHAR,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "products_stocks" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+ALTER TABLE "products_stocks" ADD FOREIGN KEY ("warehouse_id") REFERENCES "warehouses" ("id") ON DELETE CASCADE;
+ALTER TABLE "stock_movements" ADD FOREIGN KEY ("product_id") REFERENCES "products" ("id") ON DELETE CASCADE;
+ALTER TABLE "stock_movements" ADD FOREIGN KEY ("warehouse_id") REFERENCES "warehouses" ("id") ON DELETE CASCADE;
+ALTER TABLE "stock_movements" ADD FOREIGN KEY ("order_id") REFERENCES "orders" ("id") ON DELETE SET NULL;
+
+CREATE INDEX ON "stock_movements" ("product_id");
+CREATE INDEX ON "stock_movements" ("order_id");
+
+CREATE TRIGGER set_updated_at_timestamp_products_stocks_table BEFORE UPDATE ON "products_stocks" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+INSERT INTO "warehouses" (
+    "title"
+)
+VALUES
+    ('main');
+
+--RESTOCK REQUIRED: orders are refused beyond stock, existing products have no stock before
+--this migration. Their qty is stock.initial_qty, e.g. PGOPTIONS='-c stock.initial_qty=100'
+--when running migrate. Without it qty is 0, restock each product by POST /v1/products/:product_id/stocks
+INSERT INTO "products_stocks" (
+    "product_id",
+    "warehouse_id",
+    "qty"
+)
+SELECT "id", 1, COALESCE(NULLIF(current_setting('stock.initial_qty', TRUE), '')::INT, 0) FROM "products";
+
+INSERT INTO "stock_movements" (
+    "product_id",
+    "warehouse_id",
+    "qty",
+    "reason"
+)
+SELECT "product_id", "warehouse_id", "qty", 'initial' FROM "products_stocks" WHERE "qty" > 0;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE "orders"
+  DROP COLUMN IF EXISTS "subtotal",
+  DROP COLUMN IF EXISTS "discount",
+  DROP COLUMN IF EXISTS "tax",
+  DROP COLUMN IF EXISTS "shipping",
+  DROP COLUMN IF EXISTS "total_paid";
+
+COMMIT;
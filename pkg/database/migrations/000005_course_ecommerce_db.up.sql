@@ -0,0 +1,23 @@
+BEGIN;
+
+ALTER TABLE "orders"
+  ADD COLUMN "subtotal" FLOAT NOT NULL DEFAULT 0,
+  ADD COLUMN "discount" FLOAT NOT NULL DEFAULT 0,
+  ADD COLUMN "tax" FLOAT NOT NULL DEFAULT 0,
+  ADD COLUMN "shipping" FLOAT NOT NULL DEFAULT 0,
+  ADD COLUMN "total_paid" FLOAT NOT NULL DEFAULT 0;
+
+--Backfill totals of existing orders from products snapshot
+UPDATE "orders" "o" SET
+  "subtotal" = "t"."subtotal",
+  "total_paid" = "t"."subtotal"
+FROM (
+  SELECT
+    "po"."order_id",
+    SUM(COALESCE(("po"."product"->>'price')::FLOAT*("po"."qty")::FLOAT, 0)) AS "subtotal"
+  FROM "products_orders" "po"
+  GROUP BY "po"."order_id"
+) AS "t"
+WHERE "o"."id" = "t"."order_id";
+
+COMMIT;
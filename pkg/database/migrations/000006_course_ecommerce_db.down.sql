@@ -0,0 +1,22 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "order_status_history" CASCADE;
+
+--Enum values can not be dropped, recreate the type without paid and refunded
+UPDATE "orders" SET "status" = 'waiting' WHERE "status" = 'paid';
+UPDATE "orders" SET "status" = 'canceled' WHERE "status" = 'refunded';
+
+ALTER TYPE "order_status" RENAME TO "order_status_old";
+
+CREATE TYPE "order_status" AS ENUM (
+    'waiting',
+    'shipping',
+    'completed',
+    'canceled'
+);
+
+ALTER TABLE "orders" ALTER COLUMN "status" TYPE "order_status" USING "status"::TEXT::"order_status";
+
+DROP TYPE "order_status_old";
+
+COMMIT;
@@ -0,0 +1,28 @@
+ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS 'paid' AFTER 'waiting';
+ALTER TYPE "order_status" ADD VALUE IF NOT EXISTS 'refunded' AFTER 'canceled';
+
+BEGIN;
+
+CREATE TABLE "order_status_history" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "order_id" VARCHAR NOT NULL,
+  "from_status" order_status,
+  "to_status" order_status NOT NULL,
+  "changed_by" VARCHAR NOT NULL,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+ALTER TABLE "order_status_history" ADD FOREIGN KEY ("order_id") REFERENCES "orders" ("id") ON DELETE CASCADE;
+
+CREATE INDEX ON "order_status_history" ("order_id");
+
+--Initial history of existing orders
+INSERT INTO "order_status_history" (
+    "order_id",
+    "to_status",
+    "changed_by",
+    "created_at"
+)
+SELECT "id", "status", "user_id", "created_at" FROM "orders";
+
+COMMIT;
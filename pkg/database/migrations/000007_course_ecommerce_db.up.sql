@@ -0,0 +1,5 @@
+BEGIN;
+
+ALTER TABLE "images" ADD COLUMN "variants" JSONB NOT NULL DEFAULT '{}';
+
+COMMIT;
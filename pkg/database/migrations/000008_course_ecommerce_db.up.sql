@@ -0,0 +1,51 @@
+BEGIN;
+
+CREATE TABLE "permissions" (
+  "code" VARCHAR PRIMARY KEY,
+  "description" VARCHAR NOT NULL DEFAULT ''
+);
+
+CREATE TABLE "roles_permissions" (
+  "role_id" INT NOT NULL REFERENCES "roles" ("id") ON DELETE CASCADE,
+  "permission_code" VARCHAR NOT NULL REFERENCES "permissions" ("code") ON UPDATE CASCADE ON DELETE CASCADE,
+  PRIMARY KEY ("role_id", "permission_code")
+);
+
+INSERT INTO "permissions" (
+  "code",
+  "description"
+)
+VALUES
+  ('config:read', 'Read effective config'),
+  ('roles:read', 'List roles and permissions'),
+  ('roles:write', 'Manage roles and assign roles to users'),
+  ('users:read:any', 'Read profile of any user'),
+  ('users:admin', 'Sign up admins and generate admin token'),
+  ('apikey:write', 'Generate api keys'),
+  ('categories:write', 'Insert and delete categories'),
+  ('warehouses:read', 'List warehouses'),
+  ('warehouses:write', 'Insert warehouses'),
+  ('files:write', 'Upload and delete files'),
+  ('products:write', 'Insert, update and delete products'),
+  ('stocks:read', 'Read stocks and stock movements'),
+  ('stocks:write', 'Adjust stocks'),
+  ('orders:read:any', 'Read orders of any user'),
+  ('orders:write:any', 'Place and update orders of any user'),
+  ('orders:status', 'Change order status to paid, shipping, completed or refunded'),
+  ('orders:cancel', 'Cancel waiting orders');
+
+--Customer
+INSERT INTO "roles_permissions" (
+  "role_id",
+  "permission_code"
+)
+SELECT "id", 'orders:cancel' FROM "roles" WHERE "id" = 1;
+
+--Admin has all permissions
+INSERT INTO "roles_permissions" (
+  "role_id",
+  "permission_code"
+)
+SELECT "r"."id", "p"."code" FROM "roles" "r", "permissions" "p" WHERE "r"."id" = 2;
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "oauth_used_tokens" CASCADE;
+
+--Raw tokens cannot be restored, users sign in again
+DELETE FROM "oauth";
+
+DROP INDEX IF EXISTS "oauth_refresh_token_hash_idx";
+DROP INDEX IF EXISTS "oauth_user_id_idx";
+
+ALTER TABLE "oauth"
+  DROP COLUMN "access_token_hash",
+  DROP COLUMN "refresh_token_hash",
+  DROP COLUMN "expires_at",
+  ADD COLUMN "access_token" VARCHAR NOT NULL,
+  ADD COLUMN "refresh_token" VARCHAR NOT NULL;
+
+COMMIT;
@@ -0,0 +1,31 @@
+BEGIN;
+
+--Tokens are kept as sha256 hex, same as hash of token cache
+ALTER TABLE "oauth"
+  ADD COLUMN "access_token_hash" VARCHAR,
+  ADD COLUMN "refresh_token_hash" VARCHAR,
+  ADD COLUMN "expires_at" TIMESTAMP;
+
+UPDATE "oauth" SET
+  "access_token_hash" = encode(sha256(convert_to("access_token", 'UTF8')), 'hex'),
+  "refresh_token_hash" = encode(sha256(convert_to("refresh_token", 'UTF8')), 'hex'),
+  "expires_at" = "created_at" + INTERVAL '30 days';
+
+ALTER TABLE "oauth"
+  DROP COLUMN "access_token",
+  DROP COLUMN "refresh_token",
+  ALTER COLUMN "access_token_hash" SET NOT NULL,
+  ALTER COLUMN "refresh_token_hash" SET NOT NULL,
+  ALTER COLUMN "expires_at" SET NOT NULL;
+
+CREATE UNIQUE INDEX "oauth_refresh_token_hash_idx" ON "oauth" ("refresh_token_hash");
+CREATE INDEX "oauth_user_id_idx" ON "oauth" ("user_id");
+
+--Refresh tokens already rotated, using one again revokes its oauth (token family)
+CREATE TABLE "oauth_used_tokens" (
+  "token_hash" VARCHAR PRIMARY KEY,
+  "oauth_id" uuid NOT NULL REFERENCES "oauth" ("id") ON DELETE CASCADE,
+  "used_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+COMMIT;
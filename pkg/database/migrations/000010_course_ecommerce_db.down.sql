@@ -0,0 +1,8 @@
+BEGIN;
+
+DELETE FROM "permissions" WHERE "code" = 'apikey:read';
+UPDATE "permissions" SET "description" = 'Generate api keys' WHERE "code" = 'apikey:write';
+
+DROP TABLE IF EXISTS "api_keys" CASCADE;
+
+COMMIT;
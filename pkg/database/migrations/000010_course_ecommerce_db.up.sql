@@ -0,0 +1,38 @@
+BEGIN;
+
+CREATE TABLE "api_keys" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "name" VARCHAR NOT NULL,
+  "prefix" VARCHAR NOT NULL,
+  "key_hash" VARCHAR NOT NULL UNIQUE,
+  "owner_id" VARCHAR NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "scopes" JSONB NOT NULL DEFAULT '[]',
+  "allowed_origins" JSONB NOT NULL DEFAULT '[]',
+  "allowed_ips" JSONB NOT NULL DEFAULT '[]',
+  "expires_at" TIMESTAMP,
+  "last_used_at" TIMESTAMP,
+  "revoked_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "api_keys_owner_id_idx" ON "api_keys" ("owner_id");
+
+CREATE TRIGGER set_updated_at_timestamp_api_keys_table BEFORE UPDATE ON "api_keys" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+UPDATE "permissions" SET "description" = 'Create, revoke and rotate api keys' WHERE "code" = 'apikey:write';
+
+INSERT INTO "permissions" (
+  "code",
+  "description"
+)
+VALUES
+  ('apikey:read', 'List api keys');
+
+INSERT INTO "roles_permissions" (
+  "role_id",
+  "permission_code"
+)
+SELECT "id", 'apikey:read' FROM "roles" WHERE "id" = 2;
+
+COMMIT;
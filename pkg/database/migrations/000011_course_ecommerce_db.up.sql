@@ -0,0 +1,18 @@
+BEGIN;
+
+ALTER TABLE "users" ADD COLUMN "email_verified_at" TIMESTAMP;
+
+CREATE TABLE "users_verifications" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "user_id" VARCHAR NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "purpose" VARCHAR NOT NULL,
+  "email" VARCHAR NOT NULL,
+  "token_hash" VARCHAR NOT NULL UNIQUE,
+  "expires_at" TIMESTAMP NOT NULL,
+  "used_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "users_verifications_user_id_purpose_idx" ON "users_verifications" ("user_id", "purpose");
+
+COMMIT;
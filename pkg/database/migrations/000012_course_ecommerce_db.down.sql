@@ -0,0 +1,6 @@
+BEGIN;
+
+DROP TABLE IF EXISTS "users_recovery_codes" CASCADE;
+DROP TABLE IF EXISTS "users_mfa" CASCADE;
+
+COMMIT;
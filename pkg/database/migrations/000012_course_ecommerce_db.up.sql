@@ -0,0 +1,24 @@
+BEGIN;
+
+CREATE TABLE "users_mfa" (
+  "user_id" VARCHAR PRIMARY KEY REFERENCES "users" ("id") ON DELETE CASCADE,
+  "secret" VARCHAR NOT NULL,
+  "last_step" BIGINT NOT NULL DEFAULT 0,
+  "enabled_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now(),
+  "updated_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE "users_recovery_codes" (
+  "id" uuid NOT NULL UNIQUE PRIMARY KEY DEFAULT uuid_generate_v4(),
+  "user_id" VARCHAR NOT NULL REFERENCES "users" ("id") ON DELETE CASCADE,
+  "code_hash" VARCHAR NOT NULL,
+  "used_at" TIMESTAMP,
+  "created_at" TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX "users_recovery_codes_user_id_idx" ON "users_recovery_codes" ("user_id");
+
+CREATE TRIGGER set_updated_at_timestamp_users_mfa_table BEFORE UPDATE ON "users_mfa" FOR EACH ROW EXECUTE PROCEDURE set_updated_at_column();
+
+COMMIT;
@@ -0,0 +1,9 @@
+BEGIN;
+
+DELETE FROM "permissions" WHERE "code" = 'users:write:any';
+
+ALTER TABLE "oauth" DROP COLUMN IF EXISTS "last_used_at";
+ALTER TABLE "oauth" DROP COLUMN IF EXISTS "ip";
+ALTER TABLE "oauth" DROP COLUMN IF EXISTS "user_agent";
+
+COMMIT;
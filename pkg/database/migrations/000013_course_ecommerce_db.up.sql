@@ -0,0 +1,22 @@
+BEGIN;
+
+ALTER TABLE "oauth" ADD COLUMN "user_agent" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "oauth" ADD COLUMN "ip" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "oauth" ADD COLUMN "last_used_at" TIMESTAMP NOT NULL DEFAULT now();
+
+UPDATE "oauth" SET "last_used_at" = "updated_at";
+
+INSERT INTO "permissions" (
+  "code",
+  "description"
+)
+VALUES
+  ('users:write:any', 'Manage sessions and accounts of other users');
+
+INSERT INTO "roles_permissions" (
+  "role_id",
+  "permission_code"
+)
+SELECT "id", 'users:write:any' FROM "roles" WHERE "id" = 2;
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+DROP INDEX IF EXISTS "users_status_idx";
+
+ALTER TABLE "users" DROP COLUMN IF EXISTS "deleted_at";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "status";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "phone";
+ALTER TABLE "users" DROP COLUMN IF EXISTS "display_name";
+
+COMMIT;
@@ -0,0 +1,10 @@
+BEGIN;
+
+ALTER TABLE "users" ADD COLUMN "display_name" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "phone" VARCHAR NOT NULL DEFAULT '';
+ALTER TABLE "users" ADD COLUMN "status" VARCHAR NOT NULL DEFAULT 'active' CHECK ("status" IN ('active', 'suspended', 'deleted'));
+ALTER TABLE "users" ADD COLUMN "deleted_at" TIMESTAMP;
+
+CREATE INDEX "users_status_idx" ON "users" ("status");
+
+COMMIT;
@@ -0,0 +1,18 @@
+BEGIN;
+
+ALTER TABLE "users_verifications"
+  ALTER COLUMN "used_at" TYPE TIMESTAMP,
+  ALTER COLUMN "expires_at" TYPE TIMESTAMP;
+
+ALTER TABLE "api_keys"
+  ALTER COLUMN "revoked_at" TYPE TIMESTAMP,
+  ALTER COLUMN "last_used_at" TYPE TIMESTAMP,
+  ALTER COLUMN "expires_at" TYPE TIMESTAMP;
+
+ALTER TABLE "oauth_used_tokens" ALTER COLUMN "used_at" TYPE TIMESTAMP;
+
+ALTER TABLE "oauth"
+  ALTER COLUMN "last_used_at" TYPE TIMESTAMP,
+  ALTER COLUMN "expires_at" TYPE TIMESTAMP;
+
+COMMIT;
@@ -0,0 +1,19 @@
+BEGIN;
+
+--Expiry of tokens and keys is an instant, values without zone are read in zone of session
+ALTER TABLE "oauth"
+  ALTER COLUMN "expires_at" TYPE TIMESTAMPTZ,
+  ALTER COLUMN "last_used_at" TYPE TIMESTAMPTZ;
+
+ALTER TABLE "oauth_used_tokens" ALTER COLUMN "used_at" TYPE TIMESTAMPTZ;
+
+ALTER TABLE "api_keys"
+  ALTER COLUMN "expires_at" TYPE TIMESTAMPTZ,
+  ALTER COLUMN "last_used_at" TYPE TIMESTAMPTZ,
+  ALTER COLUMN "revoked_at" TYPE TIMESTAMPTZ;
+
+ALTER TABLE "users_verifications"
+  ALTER COLUMN "expires_at" TYPE TIMESTAMPTZ,
+  ALTER COLUMN "used_at" TYPE TIMESTAMPTZ;
+
+COMMIT;
@@ -0,0 +1,104 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	FormatJpeg = "jpeg"
+	FormatPng  = "png"
+	FormatWebp = "webp"
+)
+
+var ErrUnsupportedFormat = errors.New("file is not a supported image")
+
+// DetectFormat checks magic bytes, file extension is not trusted
+func DetectFormat(head []byte) string {
+	switch {
+	case bytes.HasPrefix(head, []byte("\xff\xd8\xff")):
+		return FormatJpeg
+	case bytes.HasPrefix(head, []byte("\x89PNG\r\n\x1a\n")):
+		return FormatPng
+	case len(head) >= 12 && string(head[0:4]) == "RIFF" && string(head[8:12]) == "WEBP":
+		return FormatWebp
+	}
+	return ""
+}
+
+func Extension(format string) string {
+	if format == FormatJpeg {
+		return "jpg"
+	}
+	return format
+}
+
+func ContentType(format string) string {
+	return "image/" + format
+}
+
+// Decode decodes an image and applies jpeg exif orientation,
+// metadata is dropped once the image is encoded again
+func Decode(data []byte, maxPixels int) (image.Image, string, error) {
+	format := DetectFormat(data)
+	if format == "" {
+		return nil, "", ErrUnsupportedFormat
+	}
+
+	cfg, name, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || name != format {
+		return nil, "", ErrUnsupportedFormat
+	}
+	if cfg.Width*cfg.Height > maxPixels {
+		return nil, "", fmt.Errorf("image must not exceed %d pixels", maxPixels)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", fmt.Errorf("decode image failed: %v", err)
+	}
+
+	if format == FormatJpeg {
+		img = orient(img, jpegOrientation(data))
+	}
+	return img, format, nil
+}
+
+// Resize scales img down to width keeping aspect ratio, never scales up
+func Resize(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	if width <= 0 || width >= b.Dx() {
+		return img
+	}
+
+	height := (b.Dy()*width + b.Dx()/2) / b.Dx()
+	if height < 1 {
+		height = 1
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+	return dst
+}
+
+// Encode uses quality for jpeg and as compression effort of lossless webp
+func Encode(w io.Writer, img image.Image, format string, quality int) error {
+	switch format {
+	case FormatJpeg:
+		return jpeg.Encode(w, img, &jpeg.Options{Quality: quality})
+	case FormatPng:
+		return png.Encode(w, img)
+	case FormatWebp:
+		return EncodeWebp(w, img, quality)
+	default:
+		return ErrUnsupportedFormat
+	}
+}
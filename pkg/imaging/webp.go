@@ -0,0 +1,711 @@
+package imaging
+
+import (
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"sort"
+)
+
+// Lossless webp (VP8L) encoder, the standard library and x/image only decode webp.
+// Uses subtract green and predictor transforms, LZ77 backward references and
+// one group of prefix codes, no color cache.
+
+// WebpMaxSize is max width and height of webp images
+const WebpMaxSize = 1 << 14
+
+const (
+	webpPredictorBits = 4 // 16x16 predictor blocks
+	webpMaxCodeLength = 15
+	webpMaxMatch      = 4096
+	webpMinMatch      = 3
+	webpWindow        = 1 << 16
+	webpHashBits      = 16
+	webpMaxChain      = 32 // hash chain length at quality 100
+)
+
+var webpCodeLengthOrder = [19]int{17, 18, 0, 1, 2, 3, 4, 5, 16, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+type bitWriter struct {
+	buf   []byte
+	acc   uint64
+	nbits uint
+}
+
+func (w *bitWriter) write(v uint32, n uint) {
+	w.acc |= uint64(v) << w.nbits
+	w.nbits += n
+	for w.nbits >= 8 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc >>= 8
+		w.nbits -= 8
+	}
+}
+
+func (w *bitWriter) flush() {
+	if w.nbits > 0 {
+		w.buf = append(w.buf, byte(w.acc))
+		w.acc, w.nbits = 0, 0
+	}
+}
+
+// CanEncodeWebp reports whether size of img fits in webp
+func CanEncodeWebp(img image.Image) bool {
+	b := img.Bounds()
+	return b.Dx() >= 1 && b.Dy() >= 1 && b.Dx() <= WebpMaxSize && b.Dy() <= WebpMaxSize
+}
+
+// EncodeWebp writes img as lossless webp. Pixels are kept as they are,
+// quality 1-100 is compression effort like lossless quality of libwebp
+func EncodeWebp(w io.Writer, img image.Image, quality int) error {
+	if !CanEncodeWebp(img) {
+		return fmt.Errorf("webp size must be 1-%d pixels", WebpMaxSize)
+	}
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+
+	argb := make([]uint32, width*height)
+	hasAlpha := false
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			c := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			if c.A != 0xff {
+				hasAlpha = true
+			}
+			argb[y*width+x] = uint32(c.A)<<24 | uint32(c.R)<<16 | uint32(c.G)<<8 | uint32(c.B)
+		}
+	}
+
+	bw := &bitWriter{}
+	bw.write(0x2f, 8)
+	bw.write(uint32(width-1), 14)
+	bw.write(uint32(height-1), 14)
+	if hasAlpha {
+		bw.write(1, 1)
+	} else {
+		bw.write(0, 1)
+	}
+	bw.write(0, 3)
+
+	// Subtract green transform
+	bw.write(1, 1)
+	bw.write(2, 2)
+	for i, p := range argb {
+		g := (p >> 8) & 0xff
+		r := ((p>>16)&0xff - g) & 0xff
+		bl := (p&0xff - g) & 0xff
+		argb[i] = p&0xff00ff00 | r<<16 | bl
+	}
+
+	// Predictor transform
+	bw.write(1, 1)
+	bw.write(0, 2)
+	bw.write(webpPredictorBits-2, 3)
+	modes, tilesX := choosePredictors(argb, width, height)
+	writeEntropyImage(bw, modes, tilesX, false, webpChain(quality))
+	argb = applyPredictors(argb, width, height, modes, tilesX)
+
+	// No more transforms
+	bw.write(0, 1)
+	writeEntropyImage(bw, argb, width, true, webpChain(quality))
+	bw.flush()
+
+	data := bw.buf
+	chunkSize := len(data)
+	padding := chunkSize & 1
+
+	header := make([]byte, 20)
+	copy(header[0:4], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:8], uint32(4+8+chunkSize+padding))
+	copy(header[8:12], "WEBP")
+	copy(header[12:16], "VP8L")
+	binary.LittleEndian.PutUint32(header[16:20], uint32(chunkSize))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	if padding == 1 {
+		if _, err := w.Write([]byte{0}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Predictors
+
+func choosePredictors(argb []uint32, width, height int) ([]uint32, int) {
+	size := 1 << webpPredictorBits
+	tilesX := (width + size - 1) >> webpPredictorBits
+	tilesY := (height + size - 1) >> webpPredictorBits
+	modes := make([]uint32, tilesX*tilesY)
+
+	for ty := 0; ty < tilesY; ty++ {
+		for tx := 0; tx < tilesX; tx++ {
+			best, bestCost := 0, -1
+			for mode := 0; mode < 14; mode++ {
+				cost := 0
+				for y := ty * size; y < (ty+1)*size && y < height; y++ {
+					for x := tx * size; x < (tx+1)*size && x < width; x++ {
+						pos := y*width + x
+						cost += residualCost(subPixels(argb[pos], predict(argb, width, x, y, mode)))
+					}
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = mode, cost
+				}
+			}
+			modes[ty*tilesX+tx] = 0xff000000 | uint32(best)<<8
+		}
+	}
+	return modes, tilesX
+}
+
+func applyPredictors(argb []uint32, width, height int, modes []uint32, tilesX int) []uint32 {
+	residuals := make([]uint32, len(argb))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			mode := int(modes[(y>>webpPredictorBits)*tilesX+(x>>webpPredictorBits)]>>8) & 0xff
+			pos := y*width + x
+			residuals[pos] = subPixels(argb[pos], predict(argb, width, x, y, mode))
+		}
+	}
+	return residuals
+}
+
+func predict(argb []uint32, width, x, y, mode int) uint32 {
+	pos := y*width + x
+	switch {
+	case x == 0 && y == 0:
+		return 0xff000000
+	case y == 0:
+		return argb[pos-1]
+	case x == 0:
+		return argb[pos-width]
+	}
+
+	// Top right of the rightmost column is the leftmost pixel of the current row
+	l, t, tl, tr := argb[pos-1], argb[pos-width], argb[pos-width-1], argb[pos-width+1]
+	switch mode {
+	case 0:
+		return 0xff000000
+	case 1:
+		return l
+	case 2:
+		return t
+	case 3:
+		return tr
+	case 4:
+		return tl
+	case 5:
+		return average2(average2(l, tr), t)
+	case 6:
+		return average2(l, tl)
+	case 7:
+		return average2(l, t)
+	case 8:
+		return average2(tl, t)
+	case 9:
+		return average2(t, tr)
+	case 10:
+		return average2(average2(l, tl), average2(t, tr))
+	case 11:
+		return selectPixel(l, t, tl)
+	case 12:
+		return clampAddSubtractFull(l, t, tl)
+	default:
+		return clampAddSubtractHalf(average2(l, t), tl)
+	}
+}
+
+func average2(a, b uint32) uint32 {
+	return (((a ^ b) & 0xfefefefe) >> 1) + (a & b)
+}
+
+func channel(p uint32, shift uint) int {
+	return int((p >> shift) & 0xff)
+}
+
+func abs(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func clamp(v int) uint32 {
+	if v < 0 {
+		return 0
+	}
+	if v > 255 {
+		return 255
+	}
+	return uint32(v)
+}
+
+func selectPixel(l, t, tl uint32) uint32 {
+	pl, pt := 0, 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		p := channel(l, shift) + channel(t, shift) - channel(tl, shift)
+		pl += abs(p - channel(l, shift))
+		pt += abs(p - channel(t, shift))
+	}
+	if pl < pt {
+		return l
+	}
+	return t
+}
+
+func clampAddSubtractFull(a, b, c uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		result |= clamp(channel(a, shift)+channel(b, shift)-channel(c, shift)) << shift
+	}
+	return result
+}
+
+func clampAddSubtractHalf(a, b uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		result |= clamp(channel(a, shift)+(channel(a, shift)-channel(b, shift))/2) << shift
+	}
+	return result
+}
+
+func subPixels(a, b uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 32; shift += 8 {
+		result |= ((a>>shift - b>>shift) & 0xff) << shift
+	}
+	return result
+}
+
+func residualCost(p uint32) int {
+	cost := 0
+	for shift := uint(0); shift < 32; shift += 8 {
+		v := channel(p, shift)
+		if v > 128 {
+			v = 256 - v
+		}
+		cost += v
+	}
+	return cost
+}
+
+// Entropy coded image
+
+type webpToken struct {
+	pixel  uint32
+	length int // 0 is literal
+	dist   int // distance code
+}
+
+// webpChain is hash chain length of LZ77 search, longer finds better matches
+func webpChain(quality int) int {
+	if quality < 1 {
+		quality = 1
+	}
+	if quality > 100 {
+		quality = 100
+	}
+	return 1 + (webpMaxChain-1)*quality/100
+}
+
+func writeEntropyImage(bw *bitWriter, argb []uint32, width int, main bool, chain int) {
+	// No color cache
+	bw.write(0, 1)
+	if main {
+		// No meta prefix codes
+		bw.write(0, 1)
+	}
+
+	tokens := backwardRefs(argb, width, chain)
+
+	green := make([]int, 256+24)
+	red := make([]int, 256)
+	blue := make([]int, 256)
+	alpha := make([]int, 256)
+	dist := make([]int, 40)
+	for _, t := range tokens {
+		if t.length == 0 {
+			green[(t.pixel>>8)&0xff]++
+			red[(t.pixel>>16)&0xff]++
+			blue[t.pixel&0xff]++
+			alpha[t.pixel>>24]++
+			continue
+		}
+		code, _, _ := prefixEncode(t.length)
+		green[256+code]++
+		code, _, _ = prefixEncode(t.dist)
+		dist[code]++
+	}
+
+	greenCodes := writePrefixCode(bw, green)
+	redCodes := writePrefixCode(bw, red)
+	blueCodes := writePrefixCode(bw, blue)
+	alphaCodes := writePrefixCode(bw, alpha)
+	distCodes := writePrefixCode(bw, dist)
+
+	for _, t := range tokens {
+		if t.length == 0 {
+			greenCodes.write(bw, int(t.pixel>>8)&0xff)
+			redCodes.write(bw, int(t.pixel>>16)&0xff)
+			blueCodes.write(bw, int(t.pixel)&0xff)
+			alphaCodes.write(bw, int(t.pixel>>24))
+			continue
+		}
+		code, extraBits, extra := prefixEncode(t.length)
+		greenCodes.write(bw, 256+code)
+		bw.write(uint32(extra), uint(extraBits))
+		code, extraBits, extra = prefixEncode(t.dist)
+		distCodes.write(bw, code)
+		bw.write(uint32(extra), uint(extraBits))
+	}
+}
+
+// prefixEncode returns prefix code, number of extra bits and extra bits of value >= 1
+func prefixEncode(v int) (int, int, int) {
+	d := v - 1
+	if d < 4 {
+		return d, 0, 0
+	}
+	h := 0
+	for d>>(h+1) != 0 {
+		h++
+	}
+	second := (d >> (h - 1)) & 1
+	extraBits := h - 1
+	return 2*h + second, extraBits, d & (1<<extraBits - 1)
+}
+
+// backwardRefs finds LZ77 matches with hash chains of chain length
+func backwardRefs(argb []uint32, width, chain int) []webpToken {
+	n := len(argb)
+	tokens := make([]webpToken, 0, n)
+	head := make([]int32, 1<<webpHashBits)
+	for i := range head {
+		head[i] = -1
+	}
+	prev := make([]int32, n)
+
+	hash := func(i int) uint32 {
+		return ((argb[i] * 0x9e3779b1) ^ (argb[i+1] * 0x85ebca6b)) >> (32 - webpHashBits)
+	}
+	insert := func(i int) {
+		if i+1 < n {
+			h := hash(i)
+			prev[i] = head[h]
+			head[h] = int32(i)
+		}
+	}
+	matchLen := func(i, j int) int {
+		l := 0
+		for i+l < n && l < webpMaxMatch && argb[i+l] == argb[j+l] {
+			l++
+		}
+		return l
+	}
+
+	for i := 0; i < n; {
+		bestLen, bestDist := 0, 0
+
+		// Left and top pixels have short distance codes
+		for _, d := range []int{1, width} {
+			if d <= i {
+				if l := matchLen(i, i-d); l > bestLen {
+					bestLen, bestDist = l, d
+				}
+			}
+		}
+
+		if i+1 < n {
+			j := head[hash(i)]
+			for c := 0; c < chain && j >= 0 && i-int(j) <= webpWindow; c++ {
+				if l := matchLen(i, int(j)); l > bestLen {
+					bestLen, bestDist = l, i-int(j)
+				}
+				j = prev[j]
+			}
+		}
+
+		if bestLen < webpMinMatch {
+			tokens = append(tokens, webpToken{pixel: argb[i]})
+			insert(i)
+			i++
+			continue
+		}
+
+		tokens = append(tokens, webpToken{length: bestLen, dist: distanceCode(bestDist, width)})
+		for k := 0; k < bestLen; k++ {
+			insert(i + k)
+		}
+		i += bestLen
+	}
+	return tokens
+}
+
+func distanceCode(dist, width int) int {
+	switch dist {
+	case width:
+		return 1
+	case 1:
+		return 2
+	}
+	return dist + 120
+}
+
+// Prefix codes
+
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint32
+	// single symbol codes are written with zero bits
+	single bool
+}
+
+func (c *prefixCode) write(bw *bitWriter, symbol int) {
+	if c.single {
+		return
+	}
+	bw.write(c.codes[symbol], uint(c.lengths[symbol]))
+}
+
+func writePrefixCode(bw *bitWriter, counts []int) *prefixCode {
+	used := make([]int, 0, 2)
+	for s, c := range counts {
+		if c > 0 {
+			used = append(used, s)
+			if len(used) > 2 {
+				break
+			}
+		}
+	}
+	if len(used) == 0 {
+		used = append(used, 0)
+	}
+
+	// Simple code
+	if len(used) <= 2 && used[len(used)-1] < 256 {
+		bw.write(1, 1)
+		bw.write(uint32(len(used)-1), 1)
+		if used[0] < 2 {
+			bw.write(0, 1)
+			bw.write(uint32(used[0]), 1)
+		} else {
+			bw.write(1, 1)
+			bw.write(uint32(used[0]), 8)
+		}
+		if len(used) == 2 {
+			bw.write(uint32(used[1]), 8)
+		}
+
+		code := &prefixCode{
+			lengths: make([]uint8, len(counts)),
+			codes:   make([]uint32, len(counts)),
+			single:  len(used) == 1,
+		}
+		if len(used) == 2 {
+			code.lengths[used[0]], code.codes[used[0]] = 1, 0
+			code.lengths[used[1]], code.codes[used[1]] = 1, 1
+		}
+		return code
+	}
+
+	// Normal code
+	lengths := huffmanLengths(counts, webpMaxCodeLength)
+	tokens := codeLengthTokens(lengths)
+
+	clCounts := make([]int, 19)
+	for _, t := range tokens {
+		clCounts[t[0]]++
+	}
+	clLengths := huffmanLengths(clCounts, 7)
+	clCodes := canonicalCodes(clLengths)
+
+	numCodes := 19
+	for numCodes > 4 && clLengths[webpCodeLengthOrder[numCodes-1]] == 0 {
+		numCodes--
+	}
+
+	bw.write(0, 1)
+	bw.write(uint32(numCodes-4), 4)
+	for i := 0; i < numCodes; i++ {
+		bw.write(uint32(clLengths[webpCodeLengthOrder[i]]), 3)
+	}
+	// Code lengths are written for every symbol
+	bw.write(0, 1)
+	for _, t := range tokens {
+		bw.write(clCodes[t[0]], uint(clLengths[t[0]]))
+		switch t[0] {
+		case 16:
+			bw.write(uint32(t[1]), 2)
+		case 17:
+			bw.write(uint32(t[1]), 3)
+		case 18:
+			bw.write(uint32(t[1]), 7)
+		}
+	}
+
+	return &prefixCode{
+		lengths: lengths,
+		codes:   canonicalCodes(lengths),
+	}
+}
+
+// codeLengthTokens run-length encodes code lengths as [symbol, extra bits]
+func codeLengthTokens(lengths []uint8) [][2]int {
+	tokens := make([][2]int, 0)
+	for i := 0; i < len(lengths); {
+		v := lengths[i]
+		run := 1
+		for i+run < len(lengths) && lengths[i+run] == v {
+			run++
+		}
+		i += run
+
+		if v == 0 {
+			for run >= 11 {
+				r := minInt(run, 138)
+				tokens = append(tokens, [2]int{18, r - 11})
+				run -= r
+			}
+			if run >= 3 {
+				tokens = append(tokens, [2]int{17, run - 3})
+				run = 0
+			}
+		} else {
+			tokens = append(tokens, [2]int{int(v), 0})
+			run--
+			for run >= 3 {
+				r := minInt(run, 6)
+				tokens = append(tokens, [2]int{16, r - 3})
+				run -= r
+			}
+		}
+		for ; run > 0; run-- {
+			tokens = append(tokens, [2]int{int(v), 0})
+		}
+	}
+	return tokens
+}
+
+// huffmanLengths returns code lengths limited to maxLength, at least two
+// symbols get a code so the tree is always complete
+func huffmanLengths(counts []int, maxLength int) []uint8 {
+	counts = append([]int(nil), counts...)
+
+	nonZero := 0
+	for _, c := range counts {
+		if c > 0 {
+			nonZero++
+		}
+	}
+	for s := 0; nonZero < 2 && s < len(counts); s++ {
+		if counts[s] == 0 {
+			counts[s] = 1
+			nonZero++
+		}
+	}
+
+	type leaf struct{ symbol, count int }
+	lengths := make([]uint8, len(counts))
+	for {
+		leaves := make([]leaf, 0, nonZero)
+		for s, c := range counts {
+			if c > 0 {
+				leaves = append(leaves, leaf{s, c})
+			}
+		}
+		sort.SliceStable(leaves, func(i, j int) bool { return leaves[i].count < leaves[j].count })
+
+		// Two queues, leaves [0, n) and internal nodes [n, next)
+		n := len(leaves)
+		weight := make([]int, 2*n-1)
+		parent := make([]int, 2*n-1)
+		for i, l := range leaves {
+			weight[i] = l.count
+		}
+		li, ii, next := 0, n, n
+		pick := func() int {
+			if li < n && (ii >= next || weight[li] <= weight[ii]) {
+				li++
+				return li - 1
+			}
+			ii++
+			return ii - 1
+		}
+		for next < 2*n-1 {
+			a, b := pick(), pick()
+			weight[next] = weight[a] + weight[b]
+			parent[a], parent[b] = next, next
+			next++
+		}
+
+		depth := make([]int, 2*n-1)
+		maxDepth := 0
+		for i := 2*n - 3; i >= 0; i-- {
+			depth[i] = depth[parent[i]] + 1
+		}
+		for i, l := range leaves {
+			lengths[l.symbol] = uint8(depth[i])
+			if depth[i] > maxDepth {
+				maxDepth = depth[i]
+			}
+		}
+		if maxDepth <= maxLength {
+			return lengths
+		}
+
+		// Flatten counts until the tree fits
+		for s := range counts {
+			if counts[s] > 0 {
+				counts[s] = (counts[s] + 1) / 2
+			}
+		}
+	}
+}
+
+// canonicalCodes returns codes bit reversed, webp bit stream is LSB first
+func canonicalCodes(lengths []uint8) []uint32 {
+	var count [16]int
+	for _, l := range lengths {
+		if l > 0 {
+			count[l]++
+		}
+	}
+
+	var nextCode [16]uint32
+	code := uint32(0)
+	for bits := 1; bits < 16; bits++ {
+		code = (code + uint32(count[bits-1])) << 1
+		nextCode[bits] = code
+	}
+
+	codes := make([]uint32, len(lengths))
+	for s, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := nextCode[l]
+		nextCode[l]++
+
+		var reversed uint32
+		for i := uint8(0); i < l; i++ {
+			reversed = reversed<<1 | (c>>i)&1
+		}
+		codes[s] = reversed
+	}
+	return codes
+}
@@ -0,0 +1,159 @@
+package imaging
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"math/rand"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func gradientImage(w, h int, alpha bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			a := uint8(0xff)
+			if alpha {
+				a = uint8((x + y) * 7)
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 3), G: uint8(y * 5), B: uint8(x ^ y), A: a})
+		}
+	}
+	return img
+}
+
+func noiseImage(w, h int, seed int64) *image.NRGBA {
+	rnd := rand.New(rand.NewSource(seed))
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	rnd.Read(img.Pix)
+	return img
+}
+
+// tiledImage repeats a small pattern, so LZ77 matches are found
+func tiledImage(w, h int) *image.NRGBA {
+	tile := noiseImage(7, 5, 1)
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, tile.At(x%7, y%5))
+		}
+	}
+	return img
+}
+
+// assertRoundTrip encodes img and decodes it by x/image, lossless keeps every pixel
+func assertRoundTrip(t *testing.T, img image.Image, quality int) int {
+	t.Helper()
+
+	buf := new(bytes.Buffer)
+	if err := EncodeWebp(buf, img, quality); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	size := buf.Len()
+
+	if DetectFormat(buf.Bytes()) != FormatWebp {
+		t.Fatalf("encoded data is not detected as webp")
+	}
+
+	got, err := webp.Decode(buf)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	b := img.Bounds()
+	if got.Bounds().Dx() != b.Dx() || got.Bounds().Dy() != b.Dy() {
+		t.Fatalf("size = %v, want %v", got.Bounds(), b)
+	}
+	for y := 0; y < b.Dy(); y++ {
+		for x := 0; x < b.Dx(); x++ {
+			want := color.NRGBAModel.Convert(img.At(b.Min.X+x, b.Min.Y+y)).(color.NRGBA)
+			have := color.NRGBAModel.Convert(got.At(got.Bounds().Min.X+x, got.Bounds().Min.Y+y)).(color.NRGBA)
+			if want.A == 0 && have.A == 0 {
+				continue
+			}
+			if want != have {
+				t.Fatalf("pixel (%d,%d) = %v, want %v", x, y, have, want)
+			}
+		}
+	}
+	return size
+}
+
+func TestEncodeWebpRoundTrip(t *testing.T) {
+	tests := map[string]image.Image{
+		"1x1":            gradientImage(1, 1, false),
+		"single row":     gradientImage(97, 1, false),
+		"single column":  gradientImage(1, 61, false),
+		"gradient":       gradientImage(123, 77, false),
+		"gradient alpha": gradientImage(64, 48, true),
+		"noise":          noiseImage(50, 33, 42),
+		"tiled":          tiledImage(200, 150),
+		"solid":          image.NewUniform(color.NRGBA{R: 10, G: 200, B: 30, A: 255}),
+		"gray":           image.NewGray(image.Rect(0, 0, 40, 30)),
+		"offset bounds":  gradientImage(80, 60, false).SubImage(image.Rect(13, 7, 70, 55)),
+	}
+	for name, img := range tests {
+		t.Run(name, func(t *testing.T) {
+			if u, ok := img.(*image.Uniform); ok {
+				img = &boundedUniform{u, image.Rect(0, 0, 33, 21)}
+			}
+			for _, quality := range []int{1, 85, 100} {
+				assertRoundTrip(t, img, quality)
+			}
+		})
+	}
+}
+
+// boundedUniform gives uniform image finite bounds
+type boundedUniform struct {
+	*image.Uniform
+	bounds image.Rectangle
+}
+
+func (u *boundedUniform) Bounds() image.Rectangle { return u.bounds }
+
+func TestEncodeWebpQuality(t *testing.T) {
+	img := tiledImage(256, 256)
+	low := assertRoundTrip(t, img, 1)
+	high := assertRoundTrip(t, img, 100)
+	if high > low {
+		t.Errorf("size at quality 100 = %d, larger than %d at quality 1", high, low)
+	}
+}
+
+func TestEncodeWebpSizeLimit(t *testing.T) {
+	for _, r := range []image.Rectangle{
+		image.Rect(0, 0, WebpMaxSize+1, 1),
+		image.Rect(0, 0, 1, WebpMaxSize+1),
+		image.Rect(0, 0, 0, 10),
+	} {
+		img := image.NewGray(r)
+		if CanEncodeWebp(img) {
+			t.Errorf("CanEncodeWebp(%v) = true", r)
+		}
+		if err := EncodeWebp(new(bytes.Buffer), img, 85); err == nil {
+			t.Errorf("EncodeWebp(%v) is accepted", r)
+		}
+	}
+
+	if !CanEncodeWebp(image.NewGray(image.Rect(0, 0, WebpMaxSize, 1))) {
+		t.Error("CanEncodeWebp of max width = false")
+	}
+}
+
+func TestDecodeWebp(t *testing.T) {
+	buf := new(bytes.Buffer)
+	if err := Encode(buf, gradientImage(30, 20, false), FormatWebp, 85); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	img, format, err := Decode(buf.Bytes(), 1000)
+	if err != nil || format != FormatWebp || img.Bounds().Dx() != 30 {
+		t.Fatalf("decode = %v, %q, %v", img.Bounds(), format, err)
+	}
+	if _, _, err := Decode(buf.Bytes(), 599); err == nil {
+		t.Error("image over max pixels is accepted")
+	}
+}
@@ -1,16 +1,79 @@
 package logger
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
 	"time"
 
-	"github.com/codepnw/go-ecommerce/pkg/utils"
+	"github.com/codepnw/go-ecommerce/config"
 	"github.com/gofiber/fiber/v2"
 )
 
+var (
+	base   = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	writer *asyncWriter
+	level  = new(slog.LevelVar)
+	policy = func() *redactor {
+		r, _ := newRedactor(config.DefaultRedactFields, config.DefaultRedactRoutes)
+		return r
+	}()
+)
+
+// Init writes json logs to rotating files in background, also to stdout if enabled
+func Init(cfg config.LogConfig) error {
+	r, err := newRedactor(cfg.RedactFields(), cfg.RedactRoutes())
+	if err != nil {
+		return err
+	}
+	policy = r
+
+	file, err := newRotatingWriter(cfg.Dir(), cfg.MaxSize(), cfg.MaxAge())
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = file
+	if cfg.Stdout() {
+		out = io.MultiWriter(os.Stdout, file)
+	}
+	writer = newAsyncWriter(out, file, cfg.BufferSize())
+
+	if err := SetLevel(cfg.Level()); err != nil {
+		return err
+	}
+
+	base = slog.New(slog.NewJSONHandler(writer, &slog.HandlerOptions{Level: level}))
+	slog.SetDefault(base)
+	return nil
+}
+
+// SetLevel changes level of running logger, e.g. on config reload
+func SetLevel(name string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil {
+		return fmt.Errorf("log level is invalid: %v", err)
+	}
+	level.Set(l)
+	return nil
+}
+
+// Flush writes buffered logs and closes log file or returns when ctx is done
+func Flush(ctx context.Context) error {
+	if writer == nil {
+		return nil
+	}
+	err := writer.Close(ctx)
+
+	// Logs after flush go to stdout
+	base = slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	slog.SetDefault(base)
+	return err
+}
+
 type ILogger interface {
 	Print() ILogger
 	Save()
@@ -20,69 +83,165 @@ type ILogger interface {
 }
 
 type Logger struct {
-	Time       string `json:"time"`
-	Ip         string `json:"ip"`
-	Method     string `json:"method"`
-	StatusCode int    `json:"status_code"`
-	Path       string `json:"path"`
-	Query      any    `json:"query"`
-	Body       any    `json:"body"`
-	Response   any    `json:"response"`
+	Time       string        `json:"time"`
+	RequestId  string        `json:"request_id"`
+	UserId     string        `json:"user_id"`
+	ApiKeyId   string        `json:"api_key_id"`
+	Ip         string        `json:"ip"`
+	Method     string        `json:"method"`
+	StatusCode int           `json:"status_code"`
+	Path       string        `json:"path"`
+	Latency    time.Duration `json:"latency"`
+	Query      any           `json:"query"`
+	Body       any           `json:"body"`
+	Response   any           `json:"response"`
+	route      string        // registered path of route, redaction matches it
 }
 
 func InitLogger(c *fiber.Ctx, res any, code int) *Logger {
 	log := &Logger{
 		Time:       time.Now().Local().Format("2006-01-02 15:04:05"),
+		RequestId:  RequestId(c),
+		UserId:     userId(c),
+		ApiKeyId:   apiKeyId(c),
 		Ip:         c.IP(),
 		Method:     c.Method(),
 		Path:       c.Path(),
 		StatusCode: code,
+		Latency:    latency(c),
+		route:      c.Route().Path,
 	}
 	log.SetQuery(c)
 	log.SetBody(c)
 	log.SetResponse(res)
+	log.redact()
 	return log
 }
 
+// Print logs request with payload at debug level
 func (l *Logger) Print() ILogger {
-	utils.Debug(l)
+	base.LogAttrs(context.Background(), slog.LevelDebug, "response", l.attrs(true)...)
 	return l
 }
 
+// Save logs request with payload at level of status code
 func (l *Logger) Save() {
-	data := utils.Output(l)
-
-	filename := fmt.Sprintf("./assets/logs/logger_%v.txt", strings.ReplaceAll(time.Now().Format("2006-01-02"), "-", ""))
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
-	}
-	defer file.Close()
-	file.WriteString(string(data) + "\n")
+	base.LogAttrs(context.Background(), statusLevel(l.StatusCode), "response", l.attrs(true)...)
 }
 
 func (l *Logger) SetQuery(c *fiber.Ctx) {
-	var body any
-	if err := c.QueryParser(&body); err != nil {
-		log.Printf("query parser error: %v", err)
+	if queries := c.Queries(); len(queries) > 0 {
+		l.Query = queries
 	}
-	l.Query = body
 }
 
 func (l *Logger) SetBody(c *fiber.Ctx) {
+	// Multipart and other bodies are not logged
+	if !strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEApplicationJSON) || len(c.Body()) == 0 {
+		return
+	}
+
 	var body any
 	if err := c.BodyParser(&body); err != nil {
-		log.Printf("body parser error: %v", err)
+		base.Debug("body parser error", slog.String("request_id", l.RequestId), slog.Any("error", err))
+	}
+	l.Body = body
+}
+
+func (l *Logger) SetResponse(res any) {
+	l.Response = res
+}
+
+// redact masks query, body and response by redaction policy. Route is
+// matched too, routing ignores case and trailing slash of path
+func (l *Logger) redact() {
+	if policy.matchRoute(l.route) || policy.matchRoute(l.Path) {
+		for _, v := range []*any{&l.Query, &l.Body, &l.Response} {
+			if *v != nil {
+				*v = redacted
+			}
+		}
+		return
 	}
 
-	switch l.Path {
-	case "v1/users/signup":
-		l.Body = "never gonna give you up"
+	l.Query = policy.redact(l.Query)
+	l.Body = policy.redact(l.Body)
+	l.Response = policy.redact(l.Response)
+}
+
+func (l *Logger) attrs(payload bool) []slog.Attr {
+	attrs := []slog.Attr{
+		slog.String("request_id", l.RequestId),
+		slog.String("user_id", l.UserId),
+		slog.String("api_key_id", l.ApiKeyId),
+		slog.String("ip", l.Ip),
+		slog.String("method", l.Method),
+		slog.String("path", l.Path),
+		slog.Int("status", l.StatusCode),
+		slog.Float64("latency_ms", float64(l.Latency.Microseconds())/1000),
+	}
+	if payload {
+		attrs = append(attrs,
+			slog.Any("query", l.Query),
+			slog.Any("body", l.Body),
+			slog.Any("response", l.Response),
+		)
+	}
+	return attrs
+}
+
+// Access logs one record per request without payload
+func Access(c *fiber.Ctx, err error) {
+	l := &Logger{
+		RequestId:  RequestId(c),
+		UserId:     userId(c),
+		ApiKeyId:   apiKeyId(c),
+		Ip:         c.IP(),
+		Method:     c.Method(),
+		Path:       c.Path(),
+		StatusCode: c.Response().StatusCode(),
+		Latency:    latency(c),
+	}
+
+	attrs := l.attrs(false)
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+	}
+	base.LogAttrs(context.Background(), statusLevel(l.StatusCode), "request", attrs...)
+}
+
+func statusLevel(code int) slog.Level {
+	switch {
+	case code >= 500:
+		return slog.LevelError
+	case code >= 400:
+		return slog.LevelWarn
 	default:
-		l.Body = body
+		return slog.LevelInfo
 	}
 }
 
-func (l *Logger) SetResponse(res any) {
-	l.Response = res
+// RequestId is set by logger middleware
+func RequestId(c *fiber.Ctx) string {
+	id, _ := c.Locals("requestId").(string)
+	return id
+}
+
+func userId(c *fiber.Ctx) string {
+	id, _ := c.Locals("userId").(string)
+	return id
+}
+
+// apiKeyId is set by api key middleware
+func apiKeyId(c *fiber.Ctx) string {
+	id, _ := c.Locals("apiKeyId").(string)
+	return id
+}
+
+func latency(c *fiber.Ctx) time.Duration {
+	start, ok := c.Locals("requestStart").(time.Time)
+	if !ok {
+		return 0
+	}
+	return time.Since(start)
 }
@@ -0,0 +1,105 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// redactor masks sensitive fields of query, body and response before logging
+type redactor struct {
+	fields map[string]bool
+	routes []string
+}
+
+func newRedactor(fields, routes []string) (*redactor, error) {
+	r := &redactor{
+		fields: make(map[string]bool),
+		routes: make([]string, 0, len(routes)),
+	}
+	for _, f := range fields {
+		r.fields[normalizeField(f)] = true
+	}
+	for _, p := range routes {
+		if _, err := path.Match(p, "/"); err != nil {
+			return nil, fmt.Errorf("redact route %s is invalid: %v", p, err)
+		}
+		r.routes = append(r.routes, normalizeRoute(p))
+	}
+	return r, nil
+}
+
+// normalizeField makes X-Api-Key, x_api_key and xApiKey the same field
+func normalizeField(name string) string {
+	return strings.ToLower(strings.NewReplacer("-", "", "_", "").Replace(name))
+}
+
+// normalizeRoute makes /V1/ApiKeys/ and /v1/apikeys the same route, like fiber routing
+func normalizeRoute(p string) string {
+	p = strings.ToLower(p)
+	if len(p) > 1 {
+		p = strings.TrimSuffix(p, "/")
+	}
+	return p
+}
+
+func (r *redactor) matchRoute(p string) bool {
+	if p == "" {
+		return false
+	}
+	p = normalizeRoute(p)
+	for _, pattern := range r.routes {
+		if ok, _ := path.Match(pattern, p); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *redactor) redact(v any) any {
+	if v == nil {
+		return nil
+	}
+
+	// Structs are converted to json values so fields are checked by json name
+	var data any
+	switch v.(type) {
+	case map[string]any, []any, string, float64, bool:
+		data = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return redacted
+		}
+		if err := json.Unmarshal(b, &data); err != nil {
+			return redacted
+		}
+	}
+	return r.walk(data)
+}
+
+func (r *redactor) walk(v any) any {
+	switch t := v.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(t))
+		for k, value := range t {
+			if r.fields[normalizeField(k)] {
+				result[k] = redacted
+				continue
+			}
+			result[k] = r.walk(value)
+		}
+		return result
+	case []any:
+		result := make([]any, len(t))
+		for i, value := range t {
+			result[i] = r.walk(value)
+		}
+		return result
+	default:
+		return v
+	}
+}
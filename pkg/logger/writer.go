@@ -0,0 +1,207 @@
+package logger
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	logFilePrefix = "app-"
+	logFileExt    = ".log"
+)
+
+// asyncWriter writes records in background, requests never wait for disk.
+// Records are dropped when the buffer is full.
+type asyncWriter struct {
+	out     io.Writer
+	closer  io.Closer
+	records chan []byte
+	done    chan struct{}
+	mu      sync.RWMutex
+	closed  bool
+	dropped atomic.Int64
+}
+
+func newAsyncWriter(out io.Writer, closer io.Closer, size int) *asyncWriter {
+	w := &asyncWriter{
+		out:     out,
+		closer:  closer,
+		records: make(chan []byte, size),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *asyncWriter) run() {
+	defer close(w.done)
+	for record := range w.records {
+		if _, err := w.out.Write(record); err != nil {
+			fmt.Fprintf(os.Stderr, "write log failed: %v\n", err)
+		}
+
+		if dropped := w.dropped.Swap(0); dropped > 0 {
+			fmt.Fprintf(w.out, `{"time":%q,"level":"WARN","msg":"log buffer is full","dropped":%d}`+"\n", time.Now().Format(time.RFC3339Nano), dropped)
+		}
+	}
+}
+
+func (w *asyncWriter) Write(p []byte) (int, error) {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return 0, fmt.Errorf("logger is closed")
+	}
+
+	// slog reuses its buffer after Write returns
+	record := make([]byte, len(p))
+	copy(record, p)
+
+	select {
+	case w.records <- record:
+	default:
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+// Close writes buffered records then closes output
+func (w *asyncWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.records)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		return fmt.Errorf("flush logs failed: %v", ctx.Err())
+	}
+
+	return w.closer.Close()
+}
+
+// rotatingWriter writes to dir/app-YYYYMMDD.log, a new file is opened every day
+// or when maxSize is exceeded, files older than maxAge days are removed
+type rotatingWriter struct {
+	dir     string
+	maxSize int64
+	maxAge  int
+	file    *os.File
+	size    int64
+	day     string
+	index   int
+}
+
+func newRotatingWriter(dir string, maxSize, maxAge int) (*rotatingWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s failed: %v", dir, err)
+	}
+
+	w := &rotatingWriter{
+		dir:     dir,
+		maxSize: int64(maxSize),
+		maxAge:  maxAge,
+	}
+	if err := w.rotate(time.Now(), 0); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	now := time.Now()
+	switch {
+	case now.Format("20060102") != w.day:
+		if err := w.rotate(now, 0); err != nil {
+			return 0, err
+		}
+	case w.maxSize > 0 && w.size+int64(len(p)) > w.maxSize && w.size > 0:
+		if err := w.rotate(now, w.index+1); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) Close() error {
+	if w.file == nil {
+		return nil
+	}
+	return w.file.Close()
+}
+
+func (w *rotatingWriter) rotate(now time.Time, index int) error {
+	if w.file != nil {
+		w.file.Close()
+		w.file = nil
+	}
+
+	day := now.Format("20060102")
+	for {
+		name := filepath.Join(w.dir, logFilePrefix+day+logFileExt)
+		if index > 0 {
+			name = filepath.Join(w.dir, fmt.Sprintf("%s%s-%d%s", logFilePrefix, day, index, logFileExt))
+		}
+
+		file, err := os.OpenFile(name, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return fmt.Errorf("open log file failed: %v", err)
+		}
+
+		stat, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("open log file failed: %v", err)
+		}
+
+		// Continue the file of previous run if it is not full
+		if w.maxSize > 0 && stat.Size() >= w.maxSize {
+			file.Close()
+			index++
+			continue
+		}
+
+		w.file, w.size, w.day, w.index = file, stat.Size(), day, index
+		break
+	}
+
+	w.removeOld(now)
+	return nil
+}
+
+func (w *rotatingWriter) removeOld(now time.Time) {
+	if w.maxAge <= 0 {
+		return
+	}
+
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return
+	}
+
+	expired := now.AddDate(0, 0, -w.maxAge)
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), logFilePrefix) || !strings.HasSuffix(e.Name(), logFileExt) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil || !info.ModTime().Before(expired) {
+			continue
+		}
+		os.Remove(filepath.Join(w.dir, e.Name()))
+	}
+}
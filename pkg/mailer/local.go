@@ -0,0 +1,71 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+var unsafeFileChars = regexp.MustCompile(`[^a-zA-Z0-9@._-]`)
+
+// fileMailer writes each message to an .eml file, for local testing
+type fileMailer struct {
+	dir  string
+	from string
+}
+
+func newFileMailer(cfg config.MailConfig) (Mailer, error) {
+	dir, err := filepath.Abs(cfg.Dir())
+	if err != nil {
+		return nil, fmt.Errorf("mail dir is invalid: %v", err)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s failed: %v", dir, err)
+	}
+
+	return &fileMailer{
+		dir:  dir,
+		from: cfg.From(),
+	}, nil
+}
+
+func (m *fileMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), unsafeFileChars.ReplaceAllString(msg.To, "_"))
+	if err := os.WriteFile(filepath.Join(m.dir, name), data, 0600); err != nil {
+		return fmt.Errorf("write mail failed: %v", err)
+	}
+	return nil
+}
+
+// logMailer logs recipient and subject only, bodies have sign in links which
+// must not be in logs. File driver keeps bodies for local testing
+type logMailer struct {
+	from string
+}
+
+func newLogMailer(cfg config.MailConfig) Mailer {
+	return &logMailer{from: cfg.From()}
+}
+
+func (m *logMailer) Send(ctx context.Context, msg *Message) error {
+	if _, err := build(m.from, msg); err != nil {
+		return err
+	}
+
+	slog.Info("mail",
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+	)
+	return nil
+}
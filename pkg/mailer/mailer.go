@@ -0,0 +1,60 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+type Mailer interface {
+	Send(ctx context.Context, msg *Message) error
+}
+
+// Message is plain text mail
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+func NewMailer(cfg config.MailConfig) (Mailer, error) {
+	switch cfg.Driver() {
+	case "smtp":
+		return newSmtpMailer(cfg), nil
+	case "file":
+		return newFileMailer(cfg)
+	case "log":
+		return newLogMailer(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknow mail driver: %s", cfg.Driver())
+	}
+}
+
+// build returns message in RFC 5322 format, CR and LF of headers are refused
+func build(from string, msg *Message) ([]byte, error) {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return nil, fmt.Errorf("mail address %q is invalid", msg.To)
+	}
+	if strings.ContainsAny(msg.Subject, "\r\n") {
+		return nil, fmt.Errorf("mail subject is invalid")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", to.String())
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return b.Bytes(), nil
+}
@@ -0,0 +1,98 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+// Port of implicit tls, other ports start tls when server offers it
+const smtpsPort = 465
+
+type smtpMailer struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+func newSmtpMailer(cfg config.MailConfig) Mailer {
+	return &smtpMailer{
+		host:     cfg.SmtpHost(),
+		port:     cfg.SmtpPort(),
+		username: cfg.SmtpUsername(),
+		password: cfg.SmtpPassword(),
+		from:     cfg.From(),
+	}
+}
+
+func (m *smtpMailer) Send(ctx context.Context, msg *Message) error {
+	data, err := build(m.from, msg)
+	if err != nil {
+		return err
+	}
+	from, _ := mail.ParseAddress(m.from)
+	to, _ := mail.ParseAddress(msg.To)
+
+	addr := net.JoinHostPort(m.host, strconv.Itoa(m.port))
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	var conn net.Conn
+	if m.port == smtpsPort {
+		conn, err = (&tls.Dialer{NetDialer: dialer, Config: &tls.Config{ServerName: m.host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("dial smtp %s failed: %v", addr, err)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp hello failed: %v", err)
+	}
+	defer client.Close()
+
+	if m.port != smtpsPort {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: m.host}); err != nil {
+				return fmt.Errorf("smtp starttls failed: %v", err)
+			}
+		}
+	}
+	if m.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", m.username, m.password, m.host)); err != nil {
+			return fmt.Errorf("smtp auth failed: %v", err)
+		}
+	}
+
+	if err := client.Mail(from.Address); err != nil {
+		return fmt.Errorf("smtp mail from failed: %v", err)
+	}
+	if err := client.Rcpt(to.Address); err != nil {
+		return fmt.Errorf("smtp rcpt to failed: %v", err)
+	}
+	w, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("smtp data failed: %v", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return fmt.Errorf("write mail failed: %v", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("send mail failed: %v", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,151 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+// Expired entries are removed at most once per interval
+const sweepInterval = time.Minute
+
+// memoryStore is a Store of one instance
+type memoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	counters map[string]*counter
+	locks    map[string]time.Time
+	swept    time.Time
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // bucket is full again, safe to remove after
+}
+
+type counter struct {
+	count   int
+	expires time.Time
+}
+
+func newMemoryStore() Store {
+	return &memoryStore{
+		buckets:  make(map[string]*bucket),
+		counters: make(map[string]*counter),
+		locks:    make(map[string]time.Time),
+		swept:    time.Now(),
+	}
+}
+
+func (s *memoryStore) Take(ctx context.Context, key string, limit config.RateLimit) (*Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.sweep(now)
+
+	burst := float64(limit.Requests)
+	rate := burst / limit.Period.Seconds() // tokens per second
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+
+	res := &Result{Limit: limit.Requests}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = seconds((1 - b.tokens) / rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = seconds((burst - b.tokens) / rate)
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+func (s *memoryStore) Fail(ctx context.Context, key string, window time.Duration) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	c, ok := s.counters[key]
+	if !ok || now.After(c.expires) {
+		c = &counter{}
+		s.counters[key] = c
+	}
+	c.count++
+	c.expires = now.Add(window)
+	return c.count, nil
+}
+
+func (s *memoryStore) Reset(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.counters, key)
+	delete(s.locks, key)
+	return nil
+}
+
+func (s *memoryStore) Lock(ctx context.Context, key string, d time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.locks[key] = time.Now().Add(d)
+	return nil
+}
+
+func (s *memoryStore) Locked(ctx context.Context, key string) (time.Duration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	until, ok := s.locks[key]
+	if !ok {
+		return 0, nil
+	}
+	d := time.Until(until)
+	if d <= 0 {
+		delete(s.locks, key)
+		return 0, nil
+	}
+	return d, nil
+}
+
+func (s *memoryStore) sweep(now time.Time) {
+	if now.Sub(s.swept) < sweepInterval {
+		return
+	}
+	s.swept = now
+
+	for key, b := range s.buckets {
+		if now.After(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, c := range s.counters {
+		if now.After(c.expires) {
+			delete(s.counters, key)
+		}
+	}
+	for key, until := range s.locks {
+		if now.After(until) {
+			delete(s.locks, key)
+		}
+	}
+}
+
+// seconds rounds up to whole seconds, as used in headers
+func seconds(sec float64) time.Duration {
+	return time.Duration(math.Ceil(sec)) * time.Second
+}
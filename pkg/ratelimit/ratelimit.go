@@ -0,0 +1,113 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+// Store keeps buckets and failed attempts, a shared store e.g. redis
+// lets many instances use the same limits
+type Store interface {
+	// Take removes one token from bucket of key
+	Take(ctx context.Context, key string, limit config.RateLimit) (*Result, error)
+	// Fail counts a failed attempt of key, counter expires after window of no failures
+	Fail(ctx context.Context, key string, window time.Duration) (int, error)
+	// Reset clears failed attempts and lock of key
+	Reset(ctx context.Context, key string) error
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Locked returns remaining lock time of key, 0 if not locked
+	Locked(ctx context.Context, key string) (time.Duration, error)
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // until bucket is full
+	RetryAfter time.Duration // until next token, when not allowed
+}
+
+func NewStore(cfg config.RateLimitConfig) (Store, error) {
+	switch cfg.Store() {
+	case "memory":
+		return newMemoryStore(), nil
+	default:
+		return nil, fmt.Errorf("unknow rate limit store: %s", cfg.Store())
+	}
+}
+
+// LockedError is returned while key is locked out
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockedError) Error() string {
+	return fmt.Sprintf("too many failed attempts, try again in %d seconds", int(math.Ceil(e.RetryAfter.Seconds())))
+}
+
+type ILockout interface {
+	Check(key string) error
+	Fail(key string) error
+	Reset(key string)
+}
+
+// lockout locks key after threshold failed attempts, lock time is doubled on every next failure
+type lockout struct {
+	store Store
+	cfg   config.RateLimitConfig
+}
+
+func NewLockout(store Store, cfg config.RateLimitConfig) ILockout {
+	return &lockout{
+		store: store,
+		cfg:   cfg,
+	}
+}
+
+// Check returns *LockedError while key is locked, store errors are ignored
+func (l *lockout) Check(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	d, err := l.store.Locked(ctx, "lock:"+key)
+	if err != nil || d <= 0 {
+		return nil
+	}
+	return &LockedError{RetryAfter: d}
+}
+
+// Fail returns *LockedError when key is locked by this failure
+func (l *lockout) Fail(key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	count, err := l.store.Fail(ctx, "fail:"+key, l.cfg.LockoutWindow())
+	if err != nil || count < l.cfg.LockoutThreshold() {
+		return nil
+	}
+
+	d := l.cfg.LockoutBase()
+	for i := l.cfg.LockoutThreshold(); i < count && d < l.cfg.LockoutMax(); i++ {
+		d *= 2
+	}
+	if d > l.cfg.LockoutMax() {
+		d = l.cfg.LockoutMax()
+	}
+
+	if err := l.store.Lock(ctx, "lock:"+key, d); err != nil {
+		return nil
+	}
+	return &LockedError{RetryAfter: d}
+}
+
+func (l *lockout) Reset(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	l.store.Reset(ctx, "fail:"+key)
+	l.store.Reset(ctx, "lock:"+key)
+}
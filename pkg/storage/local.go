@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+type localStorage struct {
+	root    string
+	baseUrl string
+	signKey []byte
+}
+
+func newLocalStorage(cfg config.StorageConfig) (Storage, error) {
+	root, err := filepath.Abs(cfg.LocalPath())
+	if err != nil {
+		return nil, fmt.Errorf("local storage path is invalid: %v", err)
+	}
+
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s failed: %v", root, err)
+	}
+
+	return &localStorage{
+		root:    root,
+		baseUrl: strings.TrimSuffix(cfg.BaseUrl(), "/"),
+		signKey: cfg.SignKey(),
+	}, nil
+}
+
+func (s *localStorage) path(key string) (string, string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	return key, filepath.Join(s.root, filepath.FromSlash(key)), nil
+}
+
+func (s *localStorage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	key, dest, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return nil, fmt.Errorf("mkdir %s failed: %v", filepath.Dir(dest), err)
+	}
+
+	// Write to temp file then rename, readers never see a partial file
+	tmp, err := os.CreateTemp(filepath.Dir(dest), ".upload-*")
+	if err != nil {
+		return nil, fmt.Errorf("create file failed: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return nil, fmt.Errorf("write file failed: %v", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		return nil, fmt.Errorf("write file failed: %v", err)
+	}
+
+	if err := os.Rename(tmp.Name(), dest); err != nil {
+		return nil, fmt.Errorf("write file failed: %v", err)
+	}
+
+	return s.Stat(ctx, key)
+}
+
+func (s *localStorage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	info, err := s.Stat(ctx, key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	_, src, _ := s.path(key)
+	file, err := os.Open(src)
+	if err != nil {
+		return nil, nil, fmt.Errorf("open file failed: %v", err)
+	}
+
+	return file, info, nil
+}
+
+func (s *localStorage) Delete(ctx context.Context, key string) error {
+	_, src, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(src); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return ErrNotFound
+		}
+		return fmt.Errorf("remove file: %s failed: %v", key, err)
+	}
+	return nil
+}
+
+func (s *localStorage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, src, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	stat, err := os.Stat(src)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("stat file failed: %v", err)
+	}
+
+	if stat.IsDir() {
+		return nil, ErrNotFound
+	}
+
+	contentType := mime.TypeByExtension(filepath.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		ContentType:  contentType,
+		ETag:         fmt.Sprintf(`"%x-%x"`, stat.ModTime().UnixNano(), stat.Size()),
+		LastModified: stat.ModTime(),
+	}, nil
+}
+
+func (s *localStorage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	exp := time.Now().Add(expires).Unix()
+	return fmt.Sprintf("%s?expires=%d&signature=%s", s.Url(key), exp, Sign(s.signKey, key, exp)), nil
+}
+
+func (s *localStorage) Url(key string) string {
+	return fmt.Sprintf("%s/%s", s.baseUrl, strings.TrimPrefix(key, "/"))
+}
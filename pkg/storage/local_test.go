@@ -0,0 +1,77 @@
+package storage
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestLocal(t *testing.T) (Storage, string) {
+	root := t.TempDir()
+	s, err := NewStorage(&testConfig{
+		driver:    "local",
+		localPath: root,
+		baseUrl:   "http://localhost:3000/",
+		signKey:   "sign-key",
+	})
+	if err != nil {
+		t.Fatalf("new local storage: %v", err)
+	}
+	return s, root
+}
+
+func TestLocalStorage(t *testing.T) {
+	s, _ := newTestLocal(t)
+	testStorage(t, s)
+}
+
+func TestLocalStorageKeyStaysInRoot(t *testing.T) {
+	s, root := newTestLocal(t)
+
+	if _, err := s.Put(context.Background(), "../../escape.png", strings.NewReader("x"), 1, "image/png"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "escape.png")); err != nil {
+		t.Errorf("object is not stored in root: %v", err)
+	}
+}
+
+func TestLocalStorageUrl(t *testing.T) {
+	s, _ := newTestLocal(t)
+
+	if got := s.Url("/images/a.png"); got != "http://localhost:3000/images/a.png" {
+		t.Errorf("url = %q", got)
+	}
+
+	signed, err := s.SignedURL(context.Background(), "slips/order-1/slip.png", time.Minute)
+	if err != nil {
+		t.Fatalf("signed url: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed url: %v", err)
+	}
+	if u.Path != "/slips/order-1/slip.png" {
+		t.Errorf("signed url path = %q", u.Path)
+	}
+	expires, err := strconv.ParseInt(u.Query().Get("expires"), 10, 64)
+	if err != nil {
+		t.Fatalf("parse expires: %v", err)
+	}
+	if !VerifySignature([]byte("sign-key"), "slips/order-1/slip.png", expires, u.Query().Get("signature")) {
+		t.Error("signature of signed url is rejected")
+	}
+}
+
+func TestLocalStorageDeleteMissing(t *testing.T) {
+	s, _ := newTestLocal(t)
+
+	if err := s.Delete(context.Background(), "slips/missing.png"); err != ErrNotFound {
+		t.Errorf("delete missing = %v, want ErrNotFound", err)
+	}
+}
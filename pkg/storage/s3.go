@@ -0,0 +1,327 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+const (
+	s3Algorithm       = "AWS4-HMAC-SHA256"
+	s3UnsignedPayload = "UNSIGNED-PAYLOAD"
+	s3DateFormat      = "20060102T150405Z"
+)
+
+// s3Storage talks to S3 compatible services (AWS S3, MinIO) with path-style
+// urls and signature version 4.
+type s3Storage struct {
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	baseUrl   string
+	client    *http.Client
+}
+
+func newS3Storage(cfg config.StorageConfig) (Storage, error) {
+	if cfg.Endpoint() == "" || cfg.Bucket() == "" {
+		return nil, fmt.Errorf("s3 endpoint and bucket are required")
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(cfg.Endpoint(), "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("s3 endpoint is invalid: %s", cfg.Endpoint())
+	}
+
+	region := cfg.Region()
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	return &s3Storage{
+		endpoint:  endpoint,
+		region:    region,
+		bucket:    cfg.Bucket(),
+		accessKey: cfg.AccessKey(),
+		secretKey: cfg.SecretKey(),
+		baseUrl:   strings.TrimSuffix(cfg.BaseUrl(), "/"),
+		client:    &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+func (s *s3Storage) objectUrl(key string) *url.URL {
+	u := *s.endpoint
+	u.Path = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.endpoint.Path, "/"), s.bucket, key)
+	u.RawPath = fmt.Sprintf("%s/%s/%s", strings.TrimSuffix(s.endpoint.Path, "/"), uriEncode(s.bucket, true), uriEncode(key, false))
+	return &u
+}
+
+func (s *s3Storage) newRequest(ctx context.Context, method, key string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, s.objectUrl(key).String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3DateFormat))
+	req.Header.Set("X-Amz-Content-Sha256", s3UnsignedPayload)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf(
+		"host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n",
+		req.URL.Host,
+		s3UnsignedPayload,
+		now.Format(s3DateFormat),
+	)
+
+	canonicalRequest := strings.Join([]string{
+		method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		s3UnsignedPayload,
+	}, "\n")
+
+	scope := s.scope(now)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm,
+		s.accessKey,
+		scope,
+		signedHeaders,
+		s.signature(now, canonicalRequest),
+	))
+
+	return req, nil
+}
+
+func (s *s3Storage) scope(t time.Time) string {
+	return fmt.Sprintf("%s/%s/s3/aws4_request", t.Format("20060102"), s.region)
+}
+
+func (s *s3Storage) signature(t time.Time, canonicalRequest string) string {
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		s3Algorithm,
+		t.Format(s3DateFormat),
+		s.scope(t),
+		hex.EncodeToString(hash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), t.Format("20060102"))
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func (s *s3Storage) Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, key, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("put object failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, s3Error("put object", res)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         size,
+		ContentType:  contentType,
+		ETag:         res.Header.Get("ETag"),
+		LastModified: time.Now(),
+	}, nil
+}
+
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, key, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("get object failed: %v", err)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, nil, s3Error("get object", res)
+	}
+
+	return res.Body, objectInfo(key, res), nil
+}
+
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	key, err := CleanKey(key)
+	if err != nil {
+		return err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodDelete, key, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("delete object failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK {
+		return s3Error("delete object", res)
+	}
+	return nil
+}
+
+func (s *s3Storage) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := s.newRequest(ctx, http.MethodHead, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("stat object failed: %v", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, s3Error("stat object", res)
+	}
+
+	return objectInfo(key, res), nil
+}
+
+func (s *s3Storage) SignedURL(ctx context.Context, key string, expires time.Duration) (string, error) {
+	key, err := CleanKey(key)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now().UTC()
+	u := s.objectUrl(key)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     s3Algorithm,
+		"X-Amz-Credential":    fmt.Sprintf("%s/%s", s.accessKey, s.scope(now)),
+		"X-Amz-Date":          now.Format(s3DateFormat),
+		"X-Amz-Expires":       strconv.Itoa(int(expires.Seconds())),
+		"X-Amz-SignedHeaders": "host",
+	}
+
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	params := make([]string, 0, len(keys))
+	for _, k := range keys {
+		params = append(params, uriEncode(k, true)+"="+uriEncode(query[k], true))
+	}
+	canonicalQuery := strings.Join(params, "&")
+
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet,
+		u.EscapedPath(),
+		canonicalQuery,
+		fmt.Sprintf("host:%s\n", u.Host),
+		"host",
+		s3UnsignedPayload,
+	}, "\n")
+
+	u.RawQuery = canonicalQuery + "&X-Amz-Signature=" + s.signature(now, canonicalRequest)
+	return u.String(), nil
+}
+
+func (s *s3Storage) Url(key string) string {
+	key = strings.TrimPrefix(key, "/")
+	if s.baseUrl != "" {
+		return fmt.Sprintf("%s/%s", s.baseUrl, key)
+	}
+	return s.objectUrl(key).String()
+}
+
+func objectInfo(key string, res *http.Response) *ObjectInfo {
+	lastModified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+	return &ObjectInfo{
+		Key:          key,
+		Size:         res.ContentLength,
+		ContentType:  res.Header.Get("Content-Type"),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: lastModified,
+	}
+}
+
+func s3Error(action string, res *http.Response) error {
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNotFound
+	}
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("%s failed: %s %s", action, res.Status, strings.TrimSpace(string(body)))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// uriEncode encodes string as required by signature version 4
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
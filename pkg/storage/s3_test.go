@@ -0,0 +1,167 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeObject struct {
+	body        []byte
+	contentType string
+}
+
+// fakeS3 is path-style S3 of one bucket, requests must be signed by access key
+type fakeS3 struct {
+	t       *testing.T
+	bucket  string
+	mu      sync.Mutex
+	objects map[string]*fakeObject
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, s3Algorithm+" Credential=access/") ||
+		!strings.Contains(auth, "/us-east-1/s3/aws4_request") ||
+		!strings.Contains(auth, "SignedHeaders=host;x-amz-content-sha256;x-amz-date") ||
+		r.Header.Get("X-Amz-Date") == "" {
+		f.t.Errorf("%s %s is not signed: %q", r.Method, r.URL.Path, auth)
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+
+	prefix := "/" + f.bucket + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, prefix)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		f.objects[key] = &fakeObject{body: body, contentType: r.Header.Get("Content-Type")}
+		w.Header().Set("ETag", etag(body))
+		w.WriteHeader(http.StatusOK)
+	case http.MethodGet, http.MethodHead:
+		obj, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", obj.contentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(obj.body)))
+		w.Header().Set("ETag", etag(obj.body))
+		w.Header().Set("Last-Modified", time.Now().UTC().Format(http.TimeFormat))
+		w.WriteHeader(http.StatusOK)
+		if r.Method == http.MethodGet {
+			w.Write(obj.body)
+		}
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func etag(body []byte) string {
+	sum := md5.Sum(body)
+	return `"` + hex.EncodeToString(sum[:]) + `"`
+}
+
+func newTestS3(t *testing.T) (Storage, *fakeS3, *httptest.Server) {
+	fake := &fakeS3{t: t, bucket: "shop", objects: make(map[string]*fakeObject)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	s, err := NewStorage(&testConfig{
+		driver:   "s3",
+		endpoint: server.URL + "/",
+		bucket:   "shop",
+	})
+	if err != nil {
+		t.Fatalf("new s3 storage: %v", err)
+	}
+	return s, fake, server
+}
+
+func TestS3Storage(t *testing.T) {
+	s, _, _ := newTestS3(t)
+	testStorage(t, s)
+}
+
+func TestS3StorageEncodesKey(t *testing.T) {
+	s, fake, _ := newTestS3(t)
+
+	if _, err := s.Put(context.Background(), "images/a b+c.png", strings.NewReader("x"), 1, "image/png"); err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if _, ok := fake.objects["images/a b+c.png"]; !ok {
+		t.Errorf("objects = %v", fake.objects)
+	}
+}
+
+func TestS3StorageError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		io.WriteString(w, "<Error><Code>AccessDenied</Code></Error>")
+	}))
+	defer server.Close()
+
+	s, err := NewStorage(&testConfig{driver: "s3", endpoint: server.URL, bucket: "shop"})
+	if err != nil {
+		t.Fatalf("new s3 storage: %v", err)
+	}
+
+	_, err = s.Stat(context.Background(), "a.png")
+	if err == nil || err == ErrNotFound || !strings.Contains(err.Error(), "403") {
+		t.Errorf("stat = %v, want 403 error", err)
+	}
+	if err := s.Delete(context.Background(), "a.png"); err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("delete = %v, want AccessDenied", err)
+	}
+}
+
+func TestS3StorageUrl(t *testing.T) {
+	s, _, server := newTestS3(t)
+
+	if got, want := s.Url("images/a.png"), server.URL+"/shop/images/a.png"; got != want {
+		t.Errorf("url = %q, want %q", got, want)
+	}
+
+	signed, err := s.SignedURL(context.Background(), "slips/a.png", 5*time.Minute)
+	if err != nil {
+		t.Fatalf("signed url: %v", err)
+	}
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatalf("parse signed url: %v", err)
+	}
+	q := u.Query()
+	if u.Path != "/shop/slips/a.png" || q.Get("X-Amz-Algorithm") != s3Algorithm || q.Get("X-Amz-Expires") != "300" ||
+		q.Get("X-Amz-SignedHeaders") != "host" || len(q.Get("X-Amz-Signature")) != 64 {
+		t.Errorf("signed url = %q", signed)
+	}
+}
+
+func TestS3StorageRequiresBucket(t *testing.T) {
+	if _, err := NewStorage(&testConfig{driver: "s3", endpoint: "http://localhost:9000"}); err == nil {
+		t.Error("s3 without bucket is accepted")
+	}
+	if _, err := NewStorage(&testConfig{driver: "s3", endpoint: "localhost", bucket: "shop"}); err == nil {
+		t.Error("s3 endpoint without scheme is accepted")
+	}
+}
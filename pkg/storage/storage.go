@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/codepnw/go-ecommerce/config"
+)
+
+var ErrNotFound = errors.New("object not found")
+
+type Storage interface {
+	Put(ctx context.Context, key string, body io.Reader, size int64, contentType string) (*ObjectInfo, error)
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	Delete(ctx context.Context, key string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	SignedURL(ctx context.Context, key string, expires time.Duration) (string, error)
+	Url(key string) string
+}
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+}
+
+func NewStorage(cfg config.StorageConfig) (Storage, error) {
+	switch cfg.Driver() {
+	case "local":
+		return newLocalStorage(cfg)
+	case "s3":
+		return newS3Storage(cfg)
+	default:
+		return nil, fmt.Errorf("unknow storage driver: %s", cfg.Driver())
+	}
+}
+
+// CleanKey prevents keys from escaping the storage root
+func CleanKey(key string) (string, error) {
+	cleaned := strings.TrimPrefix(path.Clean("/"+key), "/")
+	if cleaned == "" || cleaned == "." {
+		return "", fmt.Errorf("object key is invalid")
+	}
+	return cleaned, nil
+}
+
+// Sign returns signature of key for signed url of local storage
+func Sign(signKey []byte, key string, expires int64) string {
+	mac := hmac.New(sha256.New, signKey)
+	mac.Write([]byte(fmt.Sprintf("%s\n%d", key, expires)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func VerifySignature(signKey []byte, key string, expires int64, signature string) bool {
+	if time.Now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(signKey, key, expires)), []byte(signature))
+}
@@ -0,0 +1,122 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// testConfig is storage config of tests, only fields read by drivers are set
+type testConfig struct {
+	driver    string
+	localPath string
+	baseUrl   string
+	signKey   string
+	endpoint  string
+	region    string
+	bucket    string
+}
+
+func (c *testConfig) Driver() string                { return c.driver }
+func (c *testConfig) LocalPath() string             { return c.localPath }
+func (c *testConfig) BaseUrl() string               { return c.baseUrl }
+func (c *testConfig) SignKey() []byte               { return []byte(c.signKey) }
+func (c *testConfig) Endpoint() string              { return c.endpoint }
+func (c *testConfig) Region() string                { return c.region }
+func (c *testConfig) Bucket() string                { return c.bucket }
+func (c *testConfig) AccessKey() string             { return "access" }
+func (c *testConfig) SecretKey() string             { return "secret" }
+func (c *testConfig) PublicDestinations() []string  { return nil }
+func (c *testConfig) PrivateDestinations() []string { return nil }
+func (c *testConfig) CacheMaxAge() int              { return 0 }
+
+// testStorage runs the same put, get, stat and delete on a driver
+func testStorage(t *testing.T, s Storage) {
+	ctx := context.Background()
+	body := "transfer slip"
+
+	info, err := s.Put(ctx, "slips/order-1/slip.png", strings.NewReader(body), int64(len(body)), "image/png")
+	if err != nil {
+		t.Fatalf("put: %v", err)
+	}
+	if info.Key != "slips/order-1/slip.png" {
+		t.Errorf("put key = %q", info.Key)
+	}
+
+	stat, err := s.Stat(ctx, "slips/order-1/slip.png")
+	if err != nil {
+		t.Fatalf("stat: %v", err)
+	}
+	if stat.Size != int64(len(body)) || stat.ContentType != "image/png" || stat.ETag == "" {
+		t.Errorf("stat = %+v", stat)
+	}
+
+	rc, _, err := s.Get(ctx, "slips/order-1/slip.png")
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil || string(got) != body {
+		t.Errorf("get = %q, %v", got, err)
+	}
+
+	if err := s.Delete(ctx, "slips/order-1/slip.png"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if _, err := s.Stat(ctx, "slips/order-1/slip.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("stat after delete = %v, want ErrNotFound", err)
+	}
+	if _, _, err := s.Get(ctx, "slips/order-1/slip.png"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("get after delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestCleanKey(t *testing.T) {
+	tests := map[string]string{
+		"slips/a.png":          "slips/a.png",
+		"/slips/a.png":         "slips/a.png",
+		"../../etc/passwd":     "etc/passwd",
+		"slips/../../a.png":    "a.png",
+		"slips//order/./a.png": "slips/order/a.png",
+	}
+	for key, want := range tests {
+		got, err := CleanKey(key)
+		if err != nil || got != want {
+			t.Errorf("CleanKey(%q) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+
+	for _, key := range []string{"", "/", ".", ".."} {
+		if _, err := CleanKey(key); err == nil {
+			t.Errorf("CleanKey(%q) is accepted", key)
+		}
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	key := []byte("sign-key")
+	expires := int64(1 << 40)
+	signature := Sign(key, "slips/a.png", expires)
+
+	if !VerifySignature(key, "slips/a.png", expires, signature) {
+		t.Error("valid signature is rejected")
+	}
+	if VerifySignature(key, "slips/b.png", expires, signature) {
+		t.Error("signature of other key is accepted")
+	}
+	if VerifySignature([]byte("other"), "slips/a.png", expires, signature) {
+		t.Error("signature of other sign key is accepted")
+	}
+	if VerifySignature(key, "slips/a.png", 1, Sign(key, "slips/a.png", 1)) {
+		t.Error("expired signature is accepted")
+	}
+}
+
+func TestNewStorageUnknownDriver(t *testing.T) {
+	if _, err := NewStorage(&testConfig{driver: "ftp"}); err == nil {
+		t.Error("unknown driver is accepted")
+	}
+}